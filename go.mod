@@ -11,8 +11,9 @@ require (
 	github.com/alibaba/sentinel-golang v1.0.2
 	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/alicebob/miniredis v2.5.0+incompatible
+	github.com/alicebob/miniredis/v2 v2.17.0
 	github.com/bluele/gcache v0.0.2
-	github.com/bradfitz/gomemcache v0.0.0-20190913173617-a41fca850d0b
+	github.com/bradfitz/gomemcache v0.0.0-20230905024940-24af94b03874
 	github.com/djimenez/iconv-go v0.0.0-20160305225143-8960e66bd3da
 	github.com/gin-gonic/gin v1.7.1
 	github.com/go-redis/redis/v8 v8.8.2
@@ -29,9 +30,12 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/valyala/bytebufferpool v1.0.0
 	github.com/valyala/fasthttp v1.18.0
+	github.com/vmihailenco/msgpack/v4 v4.3.12
+	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c
 	github.com/xxl-job/xxl-job-executor-go v1.0.0
 	github.com/yuin/gopher-lua v0.0.0-20210529063254-f4c35e4016d9 // indirect
 	go.uber.org/automaxprocs v1.4.0
+	golang.org/x/sync v0.0.0-20220907140024-f12130a52804
 	gorm.io/driver/mysql v1.0.3
 	gorm.io/gorm v1.20.6
 )
@@ -25,6 +25,8 @@ type RatelimiterOptions struct {
 	DefaultMsg    string
 	ErrorHttpCode int
 	ErrorHandler  gin.HandlerFunc
+	// KeyFunc 返回请求的限流key，只用于RedisRateLimiter，为空时所有请求共享限流
+	KeyFunc func(c *gin.Context) string
 }
 
 // Optional parameters
@@ -54,3 +56,10 @@ func WithErrorHandler(f gin.HandlerFunc) Option {
 		o.ErrorHandler = f
 	}
 }
+
+// Optional parameters
+func WithKeyFunc(f func(c *gin.Context) string) Option {
+	return func(o *RatelimiterOptions) {
+		o.KeyFunc = f
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimiter
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/dlock"
+	"github.com/gin-gonic/gin"
+)
+
+// RedisRateLimiter 使用基于redis的分布式限流器，所有实例共享限流。
+// redis出错时放行请求，避免限流器故障影响业务
+func RedisRateLimiter(limiter *dlock.Limiter, opts ...Option) gin.HandlerFunc {
+	o := NewDefaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(c *gin.Context) {
+		var key string
+		if o.KeyFunc != nil {
+			key = o.KeyFunc(c)
+		}
+		res, err := limiter.Allow(c.Request.Context(), key)
+		if err != nil || res == nil {
+			log.Errorf("rate limiter %s failed: %v", limiter.Name(), err)
+			c.Next()
+			return
+		}
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if res.Allowed {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+		if o.ErrorHandler != nil {
+			o.ErrorHandler(c)
+			c.Abort()
+		} else {
+			c.AbortWithStatusJSON(o.ErrorHttpCode, o.DefaultMsg)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ngoredis "github.com/NetEase-Media/ngo/pkg/client/redis"
+	"github.com/NetEase-Media/ngo/pkg/dlock"
+	"github.com/NetEase-Media/ngo/pkg/dlock/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisRateLimiter(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+	rc := ngoredis.NewClient(&ngoredis.Options{Name: "ratelimiter", Addr: []string{s.Addr()}})
+	defer rc.Close()
+	limiter := dlock.New(redis.NewPool(rc)).NewLimiter("api", dlock.PerMinute(1))
+
+	r := gin.New()
+	r.GET("/", RedisRateLimiter(limiter, WithKeyFunc(func(c *gin.Context) string {
+		return c.Query("user")
+	}), WithErrorHandler(func(c *gin.Context) {
+		c.String(http.StatusTooManyRequests, "limit exceeded")
+	})), func(c *gin.Context) {
+		c.String(http.StatusOK, "success")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?user=1", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?user=1", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "limit exceeded", w.Body.String())
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// 其他key不受影响
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?user=2", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// redis不可用时放行
+	s.Close()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?user=1", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
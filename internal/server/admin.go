@@ -0,0 +1,167 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/cron"
+	"github.com/NetEase-Media/ngo/pkg/adapter/protocol"
+	"github.com/NetEase-Media/ngo/pkg/client/redis"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOptions 是内置管理接口的配置，管理接口会暴露内部组件信息，默认关闭
+type AdminOptions struct {
+	Enabled bool
+	Path    string
+	// Token 是修改状态的接口要求的 Authorization: Bearer 令牌，为空时这些接口只接受本机请求
+	Token string
+}
+
+func NewDefaultAdminOptions() *AdminOptions {
+	return &AdminOptions{
+		Enabled: false,
+		Path:    "/admin",
+	}
+}
+
+// addAdminHandler 注册管理相关route
+func (s *Server) addAdminHandler() *Server {
+	admin := s.Group(s.opt.Admin.Path)
+	admin.GET("/redis", s.redisClientsHandler)
+	admin.GET("/redis/:name", s.redisClientHandler)
+	admin.GET("/cron", s.cronsHandler)
+	admin.GET("/cron/:name", s.cronHandler)
+	admin.POST("/cron/:name/:entry/:action", s.adminAuth, s.cronActionHandler)
+	return s
+}
+
+// adminAuth 校验修改状态的管理接口，配置了Token时校验令牌，否则只允许本机访问
+func (s *Server) adminAuth(c *gin.Context) {
+	if token := s.opt.Admin.Token; token != "" {
+		auth := c.GetHeader("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+			return
+		}
+	} else if isLoopback(c.Request.RemoteAddr) {
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, &protocol.HttpBody{
+		Code:    protocol.PermissionDenied,
+		Message: "permission denied",
+	})
+}
+
+// isLoopback 判断请求是否来自本机，不信任X-Forwarded-For等代理头
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// redisClientsHandler 返回所有redis客户端的拓扑信息
+func (s *Server) redisClientsHandler(c *gin.Context) {
+	c.JSON(protocol.JsonBody(redis.Clients()))
+}
+
+// redisClientHandler 返回指定redis客户端的拓扑信息
+func (s *Server) redisClientHandler(c *gin.Context) {
+	info, ok := redis.GetClientInfo(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, &protocol.HttpBody{
+			Code:    protocol.ResourceNotExist,
+			Message: "redis client not found",
+		})
+		return
+	}
+	c.JSON(protocol.JsonBody(info))
+}
+
+// cronsHandler 返回所有定时任务调度器的任务和执行记录
+func (s *Server) cronsHandler(c *gin.Context) {
+	c.JSON(protocol.JsonBody(cron.Crons()))
+}
+
+// cronHandler 返回指定调度器的任务和执行记录
+func (s *Server) cronHandler(c *gin.Context) {
+	cr := cron.GetCron(c.Param("name"))
+	if cr == nil {
+		c.JSON(http.StatusNotFound, &protocol.HttpBody{
+			Code:    protocol.ResourceNotExist,
+			Message: "cron not found",
+		})
+		return
+	}
+	c.JSON(protocol.JsonBody(cron.Info{Name: cr.Name(), Entries: cr.Entries()}))
+}
+
+// cronActionHandler 暂停(pause)、恢复(resume)或立即触发(trigger)任务，entry为任务id或名称
+func (s *Server) cronActionHandler(c *gin.Context) {
+	cr := cron.GetCron(c.Param("name"))
+	if cr == nil {
+		c.JSON(http.StatusNotFound, &protocol.HttpBody{
+			Code:    protocol.ResourceNotExist,
+			Message: "cron not found",
+		})
+		return
+	}
+	id, ok := findCronEntry(cr, c.Param("entry"))
+	if !ok {
+		c.JSON(http.StatusNotFound, &protocol.HttpBody{
+			Code:    protocol.ResourceNotExist,
+			Message: "cron entry not found",
+		})
+		return
+	}
+	var err error
+	switch c.Param("action") {
+	case "pause":
+		err = cr.Pause(id)
+	case "resume":
+		err = cr.Resume(id)
+	case "trigger":
+		err = cr.Trigger(id)
+	default:
+		c.JSON(http.StatusBadRequest, &protocol.HttpBody{
+			Code:    protocol.ParamsNotValid,
+			Message: "unknown action",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(protocol.Fail(protocol.SystemError, err.Error()))
+		return
+	}
+	c.JSON(protocol.JsonBody(cr.Entry(id)))
+}
+
+// findCronEntry 按id或名称查找任务
+func findCronEntry(cr *cron.Cron, entry string) (cron.EntryID, bool) {
+	for _, e := range cr.Entries() {
+		if e.Name == entry || strconv.Itoa(int(e.ID)) == entry {
+			return e.ID, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,99 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandler(t *testing.T) {
+	opt := NewDefaultOptions()
+	s := newServer(opt)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/redis", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	opt.Admin.Enabled = true
+	s = newServer(opt)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/redis", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"data":[]`)
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/redis/none", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	c := cron.NewCron(cron.WithName("admin"))
+	_, _ = c.AddNamedFunc("job", "@daily", func() {})
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/cron", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"admin"`)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/cron/admin", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"job","spec":"@daily"`)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/cron/none", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 未配置token时只接受本机请求
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/cron/admin/job/pause", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	local := func(method, target string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		r.RemoteAddr = "127.0.0.1:12345"
+		return r
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, local(http.MethodPost, "/admin/cron/admin/job/pause"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":true`)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, local(http.MethodPost, "/admin/cron/admin/1/resume"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":false`)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, local(http.MethodPost, "/admin/cron/admin/none/trigger"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, local(http.MethodPost, "/admin/cron/admin/job/stop"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 配置token后校验令牌，本机请求也需要令牌
+	opt.Admin.Token = "secret"
+	s = newServer(opt)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, local(http.MethodPost, "/admin/cron/admin/job/pause"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	r := httptest.NewRequest(http.MethodPost, "/admin/cron/admin/job/pause", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	r = httptest.NewRequest(http.MethodPost, "/admin/cron/admin/job/pause", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":true`)
+}
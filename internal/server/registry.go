@@ -0,0 +1,70 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
+	"github.com/NetEase-Media/ngo/pkg/util"
+)
+
+// register 开启服务注册时，将本实例注册到zookeeper
+func (s *Server) register() error {
+	opt := registryOptions
+	if opt == nil || !opt.Enabled {
+		return nil
+	}
+	client := zookeeper.GetZkClient(opt.Zookeeper)
+	if client == nil {
+		return fmt.Errorf("zookeeper client %s not found", opt.Zookeeper)
+	}
+
+	addr := opt.Address
+	if addr == "" {
+		ip, err := util.GetOutBoundIP()
+		if err != nil {
+			return err
+		}
+		addr = net.JoinHostPort(ip, strconv.Itoa(s.opt.Port))
+	}
+
+	registry := zookeeper.NewRegistry(client, opt.Root)
+	err := registry.Register(zookeeper.Instance{
+		AppName:     s.serviceOptions.AppName,
+		ClusterName: s.serviceOptions.ClusterName,
+		Instance:    s.serviceOptions.Instance,
+		Address:     addr,
+		Metadata:    opt.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	s.registry = registry
+	return nil
+}
+
+// deregister 注销本实例
+func (s *Server) deregister() {
+	if s.registry == nil {
+		return
+	}
+	if err := s.registry.Deregister(); err != nil {
+		log.Errorf("deregister from zookeeper error: %v", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -30,6 +31,7 @@ import (
 	"github.com/NetEase-Media/ngo/internal/middlewares"
 	"github.com/NetEase-Media/ngo/internal/service"
 	"github.com/NetEase-Media/ngo/pkg/adapter/config"
+	"github.com/NetEase-Media/ngo/pkg/adapter/cron"
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 	"github.com/NetEase-Media/ngo/pkg/adapter/sentinel"
 	"github.com/NetEase-Media/ngo/pkg/adapter/xxljob"
@@ -39,6 +41,7 @@ import (
 	"github.com/NetEase-Media/ngo/pkg/client/memcache"
 	"github.com/NetEase-Media/ngo/pkg/client/multicache"
 	"github.com/NetEase-Media/ngo/pkg/client/redis"
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
 	"github.com/NetEase-Media/ngo/pkg/dlock"
 	"github.com/NetEase-Media/ngo/pkg/util"
 	"github.com/gin-gonic/gin"
@@ -88,6 +91,9 @@ type Server struct {
 	PreStop  func(context.Context) error
 
 	shutdownTimeout time.Duration
+
+	// registry 只在开启服务注册时存在
+	registry *zookeeper.Registry
 }
 
 type MiddlewaresOptions struct {
@@ -99,6 +105,7 @@ type Options struct {
 	Mode            string
 	ShutdownTimeout time.Duration
 	Middlewares     *MiddlewaresOptions
+	Admin           *AdminOptions
 }
 
 // PprofOptions 用于开启调试模式
@@ -115,6 +122,7 @@ func NewDefaultOptions() *Options {
 		Middlewares: &MiddlewaresOptions{
 			AccessLog: middlewares.NewDefaultAccessLogOptions(),
 		},
+		Admin: NewDefaultAdminOptions(),
 	}
 }
 
@@ -133,8 +141,9 @@ const (
 )
 
 var (
-	server      *Server
-	pprofServer *http.Server
+	server          *Server
+	pprofServer     *http.Server
+	registryOptions *zookeeper.RegistryOptions
 )
 
 func init() {
@@ -165,6 +174,17 @@ func initComponents() {
 	err = log.Init(logOptions, server.serviceOptions.AppName)
 	util.CheckError(err)
 
+	// Init Zookeeper
+	var zkOptions []zookeeper.Options
+	err = config.Unmarshal("zookeeper", &zkOptions)
+	util.CheckError(err)
+	err = zookeeper.Init(zkOptions)
+	util.CheckError(err)
+
+	// 合并zookeeper中的配置，需要在其他组件初始化之前
+	err = zookeeper.InitConfigSource(config.DefaultConfig())
+	util.CheckError(err)
+
 	// Init Redis
 	var redisOptions []redis.Options
 	err = config.Unmarshal("redis", &redisOptions)
@@ -179,6 +199,11 @@ func initComponents() {
 	err = memcache.Init(memOptions)
 	util.CheckError(err)
 
+	// Init Registry
+	registryOptions = zookeeper.NewDefaultRegistryOptions()
+	err = config.Unmarshal("registry", registryOptions)
+	util.CheckError(err)
+
 	// Init DB
 	var dbOptions []*db.Options
 	err = config.Unmarshal("db", &dbOptions)
@@ -212,6 +237,13 @@ func initComponents() {
 	util.CheckError(err)
 	dlock.Init(dlockOptions)
 
+	// Init cron
+	cronOptions := cron.NewDefaultOptions()
+	err = config.Unmarshal("cron", cronOptions)
+	util.CheckError(err)
+	err = cron.Init(cronOptions, server.serviceOptions.AppName)
+	util.CheckError(err)
+
 	// Init pprof
 	var pprof PprofOptions
 	err = config.Unmarshal("pprof", &pprof)
@@ -242,12 +274,23 @@ func initComponents() {
 
 // stopComponents 停止所有外部组件
 func stopComponents(ctx context.Context) {
+	// Stop cron，先于其他组件停止，正在运行的任务可能还在使用它们
+	if err := cron.Shutdown(ctx); err != nil {
+		log.Errorf("shutting down cron error: %v", err)
+	}
+
+	// Stop multicache invalidation bus，依赖redis和kafka客户端
+	multicache.StopAll()
+
 	// Stop Redis
 	redis.StopAll()
 
 	// Stop Kafka
 	kafka.StopAll()
 
+	// Stop Zookeeper
+	zookeeper.StopAll()
+
 	// Close HTTPClient
 	httplib.Close()
 
@@ -322,6 +365,9 @@ func newServer(opt *Options) *Server {
 	}
 
 	s.addServerHandler()
+	if opt.Admin != nil && opt.Admin.Enabled {
+		s.addAdminHandler()
+	}
 	return s
 }
 
@@ -347,7 +393,16 @@ func (s *Server) Start() {
 			}
 		}
 		log.WithField("port", s.opt.Port).Info("Start HTTPServer!")
-		err := s.ListenAndServe()
+		ln, err := net.Listen("tcp", s.Addr)
+		if err != nil {
+			panic(fmt.Sprintf("start s failed: %s", err.Error()))
+		}
+		// 开始监听后再注册，避免调用方连接失败
+		if err := s.register(); err != nil {
+			panic(fmt.Sprintf("register server failed: %s", err.Error()))
+		}
+		cron.Default().Start()
+		err = s.Serve(ln)
 		if err != nil && err.Error() != "http: Server closed" {
 			panic(fmt.Sprintf("start s failed: %s", err.Error()))
 		}
@@ -378,6 +433,9 @@ func (s *Server) Stop(ctx context.Context) error {
 		ch := make(chan struct{})
 
 		go func() {
+			// 先注销，使调用方不再路由到本实例
+			s.deregister()
+
 			if s.PreStop != nil {
 				log.Info("PreStop start...")
 				if e := s.PreStop(ctx); e != nil {
@@ -442,6 +500,12 @@ func (s *Server) AddRouteWithMethods(methods []Method, path string, handlers ...
 	return s
 }
 
+// AddCronJob 向server管理的调度器添加定时任务，调度器在server启动时开始调度，停止时等待正在运行的任务完成，
+// 超过ShutdownTimeout时取消传给任务的context。配置见cron
+func (s *Server) AddCronJob(name, spec string, fn func(ctx context.Context) error) (cron.EntryID, error) {
+	return cron.Default().AddNamedContextFunc(name, spec, fn)
+}
+
 // StoppingNotify 返回一个channel，它会在server停止时被关闭
 func (s *Server) StoppingNotify() <-chan struct{} { return s.stopping }
 
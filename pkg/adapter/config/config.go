@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 	"github.com/spf13/viper"
@@ -31,8 +32,10 @@ var (
 	gConfigDir string
 )
 
+// Config 是对viper的封装，Config上的读写方法是并发安全的，直接通过Viper字段访问则不受保护
 type Config struct {
 	*viper.Viper
+	mu sync.RWMutex
 }
 
 func Init(configName string) (err error) {
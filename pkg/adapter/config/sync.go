@@ -0,0 +1,126 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 以下方法在读写锁的保护下调用viper，配置可以在运行时被合并（如zookeeper配置源的监听）
+
+func (c *Config) Get(key string) interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.Get(key)
+}
+
+func (c *Config) GetString(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetString(key)
+}
+
+func (c *Config) GetBool(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetBool(key)
+}
+
+func (c *Config) GetInt(key string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetInt(key)
+}
+
+func (c *Config) GetInt64(key string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetInt64(key)
+}
+
+func (c *Config) GetFloat64(key string) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetFloat64(key)
+}
+
+func (c *Config) GetDuration(key string) time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetDuration(key)
+}
+
+func (c *Config) GetStringSlice(key string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetStringSlice(key)
+}
+
+func (c *Config) GetStringMap(key string) map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetStringMap(key)
+}
+
+func (c *Config) GetStringMapString(key string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.GetStringMapString(key)
+}
+
+func (c *Config) IsSet(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.IsSet(key)
+}
+
+func (c *Config) AllKeys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.AllKeys()
+}
+
+func (c *Config) AllSettings() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.AllSettings()
+}
+
+func (c *Config) Unmarshal(rawVal interface{}, opts ...viper.DecoderConfigOption) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.Unmarshal(rawVal, opts...)
+}
+
+func (c *Config) UnmarshalKey(key string, rawVal interface{}, opts ...viper.DecoderConfigOption) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Viper.UnmarshalKey(key, rawVal, opts...)
+}
+
+func (c *Config) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Viper.Set(key, value)
+}
+
+// MergeConfigMap 合并配置，合并期间的读取会被阻塞
+func (c *Config) MergeConfigMap(cfg map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Viper.MergeConfigMap(cfg)
+}
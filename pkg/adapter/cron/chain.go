@@ -0,0 +1,160 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+// ErrSkipped 是SkipIfStillRunning跳过执行时返回的错误
+var ErrSkipped = errors.New("cron: skipped because the previous run is still running")
+
+// ContextJob 是接收context并返回错误的任务，错误记录在执行历史中，context在Timeout时被取消
+type ContextJob interface {
+	Job
+	RunContext(ctx context.Context) error
+}
+
+// ContextFunc 将函数转换为ContextJob
+type ContextFunc func(ctx context.Context) error
+
+func (f ContextFunc) Run() {
+	_ = f(context.Background())
+}
+
+func (f ContextFunc) RunContext(ctx context.Context) error {
+	return f(ctx)
+}
+
+// runJob 执行任务，普通Job没有错误
+func runJob(ctx context.Context, j Job) error {
+	if cj, ok := j.(ContextJob); ok {
+		return cj.RunContext(ctx)
+	}
+	j.Run()
+	return nil
+}
+
+// Chain 是JobWrapper的序列，NewChain(m1, m2, m3).Then(job) 相当于 m1(m2(m3(job)))
+type Chain struct {
+	wrappers []JobWrapper
+}
+
+func NewChain(wrappers ...JobWrapper) Chain {
+	return Chain{wrappers: wrappers}
+}
+
+// Then 使用所有JobWrapper包装任务
+func (c Chain) Then(j Job) Job {
+	for i := len(c.wrappers) - 1; i >= 0; i-- {
+		j = c.wrappers[i](j)
+	}
+	return j
+}
+
+// Recover 捕获任务的panic，打印日志并作为错误返回，logger为nil时使用默认logger
+func Recover(logger *log.NgoLogger) JobWrapper {
+	logger = orDefault(logger)
+	return func(j Job) Job {
+		return ContextFunc(func(ctx context.Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					buf := make([]byte, 64<<10)
+					buf = buf[:runtime.Stack(buf, false)]
+					logger.Errorf("cron: job panic: %v\n%s", r, buf)
+					err = fmt.Errorf("cron: job panic: %v", r)
+				}
+			}()
+			return runJob(ctx, j)
+		})
+	}
+}
+
+// DelayIfStillRunning 上一次执行未完成时，等待其完成后再执行，等待超过1分钟时打印日志
+func DelayIfStillRunning(logger *log.NgoLogger) JobWrapper {
+	logger = orDefault(logger)
+	return func(j Job) Job {
+		var mu sync.Mutex
+		return ContextFunc(func(ctx context.Context) error {
+			start := time.Now()
+			mu.Lock()
+			defer mu.Unlock()
+			if delay := time.Since(start); delay > time.Minute {
+				logger.Infof("cron: job delayed %s", delay)
+			}
+			return runJob(ctx, j)
+		})
+	}
+}
+
+// SkipIfStillRunning 上一次执行未完成时，跳过本次执行并返回ErrSkipped
+func SkipIfStillRunning(logger *log.NgoLogger) JobWrapper {
+	logger = orDefault(logger)
+	return func(j Job) Job {
+		ch := make(chan struct{}, 1)
+		ch <- struct{}{}
+		return ContextFunc(func(ctx context.Context) error {
+			select {
+			case v := <-ch:
+				defer func() { ch <- v }()
+				return runJob(ctx, j)
+			default:
+				logger.Info("cron: job skipped because the previous run is still running")
+				return ErrSkipped
+			}
+		})
+	}
+}
+
+// Timeout 限制任务的执行时间，超时后取消传给ContextJob的context并返回context.DeadlineExceeded。
+// 普通Job无法被取消，超时后会继续在后台执行
+func Timeout(d time.Duration) JobWrapper {
+	return func(j Job) Job {
+		return ContextFunc(func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				// 任务在新的goroutine中执行，外层的Recover无法捕获panic
+				defer func() {
+					if r := recover(); r != nil {
+						done <- fmt.Errorf("cron: job panic: %v", r)
+					}
+				}()
+				done <- runJob(ctx, j)
+			}()
+			select {
+			case err := <-done:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+}
+
+func orDefault(logger *log.NgoLogger) *log.NgoLogger {
+	if logger == nil {
+		return log.Logger()
+	}
+	return logger
+}
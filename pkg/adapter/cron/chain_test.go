@@ -0,0 +1,164 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	var order []int
+	wrapper := func(i int) JobWrapper {
+		return func(j Job) Job {
+			return ContextFunc(func(ctx context.Context) error {
+				order = append(order, i)
+				return runJob(ctx, j)
+			})
+		}
+	}
+	NewChain(wrapper(1), wrapper(2), wrapper(3)).Then(ContextFunc(func(ctx context.Context) error {
+		order = append(order, 0)
+		return nil
+	})).Run()
+	assert.Equal(t, []int{1, 2, 3, 0}, order)
+}
+
+func TestRecover(t *testing.T) {
+	err := runJob(context.Background(), Recover(nil)(DummyJob{}))
+	assert.EqualError(t, err, "cron: job panic: YOLO")
+
+	// 超时的goroutine中的panic也会被捕获
+	err = runJob(context.Background(), Recover(nil)(Timeout(time.Second)(DummyJob{})))
+	assert.EqualError(t, err, "cron: job panic: YOLO")
+}
+
+func TestStillRunning(t *testing.T) {
+	block := make(chan struct{})
+	var n int32
+	job := ContextFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&n, 1)
+		<-block
+		return nil
+	})
+
+	skip := SkipIfStillRunning(nil)(job)
+	go runJob(context.Background(), skip)
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, ErrSkipped, runJob(context.Background(), skip))
+
+	delay := DelayIfStillRunning(nil)(job)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, runJob(context.Background(), delay))
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	// 一个被跳过，delay中只有一个在执行
+	assert.Equal(t, int32(2), atomic.LoadInt32(&n))
+	close(block)
+	wg.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&n))
+}
+
+func TestTimeout(t *testing.T) {
+	var cancelled int32
+	err := runJob(context.Background(), Timeout(time.Millisecond*50)(ContextFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		atomic.StoreInt32(&cancelled, 1)
+		return ctx.Err()
+	})))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cancelled))
+
+	err = runJob(context.Background(), Timeout(time.Second)(ContextFunc(func(ctx context.Context) error {
+		return errors.New("failed")
+	})))
+	assert.EqualError(t, err, "failed")
+}
+
+func TestHistory(t *testing.T) {
+	c := NewCron(WithSeconds(), WithName("history"), WithChain(Recover(nil), SkipIfStillRunning(nil)))
+	var n int32
+	id, err := c.AddNamedContextFunc("job", "* * * * * *", func(ctx context.Context) error {
+		if atomic.AddInt32(&n, 1) == 1 {
+			panic("first")
+		}
+		return errors.New("failed")
+	})
+	assert.NoError(t, err)
+	okID, _ := c.AddFunc("* * * * * *", func() {})
+	c.Start()
+	assert.Equal(t, c, GetCron("history"))
+	var found bool
+	for _, info := range Crons() {
+		if info.Name == "history" {
+			found = true
+			assert.Len(t, info.Entries, 2)
+		}
+	}
+	assert.True(t, found)
+	time.Sleep(time.Millisecond * 2500)
+	<-c.Stop().Done()
+	assert.Nil(t, GetCron("history"))
+
+	e := c.Entry(id)
+	assert.Equal(t, "job", e.Name)
+	assert.Equal(t, "* * * * * *", e.Spec)
+	assert.GreaterOrEqual(t, e.History.Runs, int64(2))
+	assert.Equal(t, e.History.Runs, e.History.Failures)
+	assert.Equal(t, "failed", e.History.LastError)
+	assert.False(t, e.History.LastStart.IsZero())
+	assert.Equal(t, 0, e.History.Running)
+
+	e = c.Entry(okID)
+	assert.Equal(t, "entry-2", e.Name)
+	assert.Equal(t, int64(0), e.History.Failures)
+	assert.Empty(t, e.History.LastError)
+}
+
+func TestRegister(t *testing.T) {
+	c, err := New(WithName("register"))
+	assert.NoError(t, err)
+	_, err = New(WithName("register"))
+	assert.EqualError(t, err, "cron: duplicated cron name register")
+	assert.Panics(t, func() { NewCron(WithName("register")) })
+
+	a, b := NewCron(), NewCron()
+	assert.NotEqual(t, a.Name(), b.Name())
+	<-a.Stop().Done()
+	assert.Nil(t, GetCron(a.Name()))
+	assert.NotEqual(t, a.Name(), NewCron().Name())
+
+	<-c.Stop().Done()
+	assert.Nil(t, GetCron("register"))
+	c.Start()
+	assert.Equal(t, c, GetCron("register"))
+	assert.NoError(t, c.Shutdown(context.Background()))
+	assert.Nil(t, GetCron("register"))
+	c2, err := New(WithName("register"))
+	assert.NoError(t, err)
+	assert.NoError(t, c2.Shutdown(context.Background()))
+}
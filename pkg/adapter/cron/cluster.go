@@ -0,0 +1,264 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
+	"github.com/NetEase-Media/ngo/pkg/dlock"
+	cron3 "github.com/robfig/cron/v3"
+)
+
+// Cluster 协调集群中的多个节点，保证每次调度只在一个节点上执行
+type Cluster interface {
+	// Acquire 尝试获取任务name在fireTime这次调度的执行权，ttl为执行记录至少需要保留的时间
+	Acquire(ctx context.Context, name string, fireTime time.Time, ttl time.Duration) (bool, error)
+	// Executed 返回任务name在fireTime这次调度是否已被执行，用于确定补偿的起点
+	Executed(ctx context.Context, name string, fireTime time.Time) (bool, error)
+}
+
+// electionNotifier 是通过选主执行任务的Cluster，当选后需要补偿错过的调度
+type electionNotifier interface {
+	OnElected(f func())
+}
+
+// DlockCluster 为每次调度获取以任务名和调度时间命名的redis锁，锁不会主动释放，
+// 在ttl内作为执行记录，避免时钟偏差或补偿执行时重复执行
+type DlockCluster struct {
+	d      *dlock.Dlock
+	prefix string
+}
+
+// NewDlockCluster 使用dlock创建Cluster，d为nil时使用默认的Dlock
+func NewDlockCluster(d *dlock.Dlock) *DlockCluster {
+	return &DlockCluster{d: d, prefix: "cron:"}
+}
+
+// WithPrefix 设置锁名的前缀，默认为 cron:
+func (c *DlockCluster) WithPrefix(prefix string) *DlockCluster {
+	c.prefix = prefix
+	return c
+}
+
+// Acquire 锁的值为调度时间，Executed可以通过值判断执行记录是否存在
+func (c *DlockCluster) Acquire(ctx context.Context, name string, fireTime time.Time, ttl time.Duration) (bool, error) {
+	m, fire := c.mutex(name, fireTime)
+	return m.WithTries(1).WithExpiry(ttl).WithGenValueFunc(func() (string, error) {
+		return fire, nil
+	}).LockContext(ctx)
+}
+
+func (c *DlockCluster) Executed(ctx context.Context, name string, fireTime time.Time) (bool, error) {
+	m, fire := c.mutex(name, fireTime)
+	return m.WithValue(fire).ValidContext(ctx)
+}
+
+func (c *DlockCluster) mutex(name string, fireTime time.Time) (*dlock.Mutex, string) {
+	fire := strconv.FormatInt(fireTime.Unix(), 10)
+	key := c.prefix + name + ":" + fire
+	if c.d != nil {
+		return c.d.NewMutex(key, nil), fire
+	}
+	return dlock.NewMutex(key, nil), fire
+}
+
+// ZkCluster 通过zookeeper选主，只有主节点执行任务。
+// 主节点在 root/jobs/name 中记录最近执行的调度时间，切换主节点时不会重复执行
+type ZkCluster struct {
+	client *zookeeper.ZookeeperProxy
+	root   string
+	leader int32
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu        sync.Mutex
+	listeners []func()
+}
+
+// NewZkCluster 创建ZkCluster并在后台参与 root/leader 下的选主，不再使用时需要调用Close
+func NewZkCluster(client *zookeeper.ZookeeperProxy, root string) *ZkCluster {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &ZkCluster{
+		client: client,
+		root:   root,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		_ = client.Elect(ctx, path.Join(root, "leader"), func(ctx context.Context) {
+			c.mu.Lock()
+			atomic.StoreInt32(&c.leader, 1)
+			listeners := append([]func(){}, c.listeners...)
+			c.mu.Unlock()
+			for _, f := range listeners {
+				go f()
+			}
+		}, func() {
+			atomic.StoreInt32(&c.leader, 0)
+		})
+	}()
+	return c
+}
+
+// IsLeader 返回当前节点是否为主节点
+func (c *ZkCluster) IsLeader() bool {
+	return atomic.LoadInt32(&c.leader) == 1
+}
+
+// OnElected 添加当选主节点后在后台执行的回调，当前已经是主节点时立即执行一次
+func (c *ZkCluster) OnElected(f func()) {
+	c.mu.Lock()
+	c.listeners = append(c.listeners, f)
+	leader := c.IsLeader()
+	c.mu.Unlock()
+	if leader {
+		go f()
+	}
+}
+
+// Close 退出选主
+func (c *ZkCluster) Close() {
+	c.cancel()
+	<-c.done
+}
+
+func (c *ZkCluster) Acquire(ctx context.Context, name string, fireTime time.Time, ttl time.Duration) (bool, error) {
+	if !c.IsLeader() {
+		return false, nil
+	}
+	node := path.Join(c.root, "jobs", name)
+	fire := []byte(strconv.FormatInt(fireTime.Unix(), 10))
+	data, stat, err := c.client.Get(node)
+	if err == zk.ErrNoNode {
+		_, err = c.client.CreateRecursive(node, fire, 0)
+		if err == zk.ErrNodeExists {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	last, _ := strconv.ParseInt(string(data), 10, 64)
+	if fireTime.Unix() <= last {
+		return false, nil
+	}
+	if _, err = c.client.Set(node, fire, stat.Version); err != nil {
+		if err == zk.ErrBadVersion {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *ZkCluster) Executed(ctx context.Context, name string, fireTime time.Time) (bool, error) {
+	data, _, err := c.client.Get(path.Join(c.root, "jobs", name))
+	if err == zk.ErrNoNode {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	last, _ := strconv.ParseInt(string(data), 10, 64)
+	return fireTime.Unix() <= last, nil
+}
+
+// clusterJob 在执行前获取本次调度的执行权
+type clusterJob struct {
+	c        *Cron
+	name     string
+	schedule cron3.Schedule
+	job      Job
+}
+
+func (j *clusterJob) Run() {
+	j.runAt(fireTime(j.schedule, time.Now()))
+}
+
+func (j *clusterJob) runAt(t time.Time) {
+	ok, err := j.c.cluster.Acquire(context.Background(), j.name, t, j.c.recordTTL())
+	if err != nil {
+		log.Errorf("cron: acquire %s at %s failed: %s", j.name, t, err)
+		return
+	}
+	if !ok {
+		log.Debugf("cron: %s at %s is executed by other node", j.name, t)
+		return
+	}
+	j.job.Run()
+}
+
+// misfire 按策略补偿停机期间错过的调度，只补偿window内最近一次执行记录之后的调度。
+// 没有执行记录时（首次部署或记录已过期）不补偿，固定间隔的调度没有确定的调度时间，也不做补偿
+func (j *clusterJob) misfire(now time.Time) {
+	if _, ok := j.schedule.(cron3.ConstantDelaySchedule); ok {
+		return
+	}
+	var missed []time.Time
+	for t := j.schedule.Next(now.Add(-j.c.misfireWindow)); !t.After(now); t = j.schedule.Next(t) {
+		missed = append(missed, t)
+	}
+	// 从最近的调度向前查找执行记录
+	last := -1
+	for i := len(missed) - 1; i >= 0; i-- {
+		ok, err := j.c.cluster.Executed(context.Background(), j.name, missed[i])
+		if err != nil {
+			log.Errorf("cron: check execution of %s at %s failed: %s", j.name, missed[i], err)
+			return
+		}
+		if ok {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		if len(missed) > 0 {
+			log.Infof("cron: no execution record of %s in misfire window, skip", j.name)
+		}
+		return
+	}
+	missed = missed[last+1:]
+	if len(missed) == 0 {
+		return
+	}
+	switch j.c.misfirePolicy {
+	case MisfireRunOnce:
+		j.runAt(missed[len(missed)-1])
+	case MisfireCatchUp:
+		for _, t := range missed {
+			j.runAt(t)
+		}
+	}
+}
+
+// fireTime 返回t对应的调度时间，所有节点对同一次调度得到相同的结果。
+// 固定间隔的调度在各节点的启动时间不同，按间隔对齐
+func fireTime(schedule cron3.Schedule, t time.Time) time.Time {
+	if s, ok := schedule.(cron3.ConstantDelaySchedule); ok && s.Delay > 0 {
+		return t.Truncate(s.Delay)
+	}
+	return t.Truncate(time.Second)
+}
@@ -0,0 +1,199 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ngoredis "github.com/NetEase-Media/ngo/pkg/client/redis"
+	"github.com/NetEase-Media/ngo/pkg/dlock"
+	"github.com/NetEase-Media/ngo/pkg/dlock/redis"
+	"github.com/alicebob/miniredis/v2"
+	cron3 "github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// memCluster 在内存中记录执行过的调度
+type memCluster struct {
+	mu    sync.Mutex
+	fired map[string]map[int64]bool
+}
+
+func (c *memCluster) Acquire(ctx context.Context, name string, fireTime time.Time, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fired == nil {
+		c.fired = make(map[string]map[int64]bool)
+	}
+	if c.fired[name] == nil {
+		c.fired[name] = make(map[int64]bool)
+	}
+	if c.fired[name][fireTime.Unix()] {
+		return false, nil
+	}
+	c.fired[name][fireTime.Unix()] = true
+	return true, nil
+}
+
+func (c *memCluster) Executed(ctx context.Context, name string, fireTime time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fired[name][fireTime.Unix()], nil
+}
+
+// electCluster 模拟选主的Cluster，elect时执行OnElected的回调
+type electCluster struct {
+	memCluster
+	elected []func()
+}
+
+func (c *electCluster) OnElected(f func()) {
+	c.elected = append(c.elected, f)
+}
+
+func (c *electCluster) elect() {
+	for _, f := range c.elected {
+		f()
+	}
+}
+
+func TestDlockCluster(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+	rc := ngoredis.NewClient(&ngoredis.Options{Name: "cron", Addr: []string{s.Addr()}})
+	defer rc.Close()
+	cluster := NewDlockCluster(dlock.New(redis.NewPool(rc)))
+
+	var n int32
+	var crons []*Cron
+	for i := 0; i < 3; i++ {
+		c := NewCron(WithSeconds(), WithCluster(cluster))
+		_, err := c.AddNamedFunc("job", "* * * * * *", func() {
+			atomic.AddInt32(&n, 1)
+		})
+		assert.NoError(t, err)
+		c.Start()
+		crons = append(crons, c)
+	}
+	time.Sleep(time.Millisecond * 2500)
+	for _, c := range crons {
+		<-c.Stop().Done()
+	}
+	// 每秒只在一个节点上执行
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&n), int32(2))
+	assert.LessOrEqual(t, atomic.LoadInt32(&n), int32(3))
+
+	_, err = NewCron(WithCluster(cluster)).AddNamedFunc("", "* * * * *", func() {})
+	assert.Error(t, err)
+}
+
+func TestMisfire(t *testing.T) {
+	schedule, _ := cron3.ParseStandard("0 * * * *")
+	for _, tt := range []struct {
+		policy MisfirePolicy
+		runs   int32
+	}{
+		{MisfireSkip, 0},
+		{MisfireRunOnce, 1},
+		{MisfireCatchUp, 4},
+	} {
+		cluster := &memCluster{}
+		var n int32
+		start := func() {
+			c := NewCron(WithCluster(cluster), WithMisfire(tt.policy, time.Hour*5))
+			_, err := c.AddNamedFunc("job", "0 * * * *", func() {
+				atomic.AddInt32(&n, 1)
+			})
+			assert.NoError(t, err)
+			c.Start()
+			assert.NoError(t, c.Shutdown(context.Background()))
+		}
+
+		// 没有执行记录时（首次部署）不补偿
+		start()
+		assert.Equal(t, int32(0), atomic.LoadInt32(&n), tt.policy)
+
+		// 只补偿最近一次执行记录之后的调度
+		first := schedule.Next(time.Now().Add(-time.Hour * 5))
+		_, _ = cluster.Acquire(context.Background(), "job", first, time.Hour)
+		start()
+		assert.Equal(t, tt.runs, atomic.LoadInt32(&n), tt.policy)
+
+		// 已经执行过的调度不会重复补偿
+		start()
+		assert.Equal(t, tt.runs, atomic.LoadInt32(&n), tt.policy)
+	}
+}
+
+func TestMisfire_Elected(t *testing.T) {
+	schedule, _ := cron3.ParseStandard("0 * * * *")
+	cluster := &electCluster{}
+	_, _ = cluster.Acquire(context.Background(), "job", schedule.Next(time.Now().Add(-time.Hour*3)), time.Hour)
+
+	var n int32
+	c := NewCron(WithCluster(cluster), WithMisfire(MisfireCatchUp, time.Hour*3))
+	_, err := c.AddNamedFunc("job", "0 * * * *", func() {
+		atomic.AddInt32(&n, 1)
+	})
+	assert.NoError(t, err)
+	c.Start()
+	// 当选主节点后才补偿
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&n))
+	cluster.elect()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&n) == 2
+	}, time.Second, time.Millisecond*10)
+
+	// Shutdown后当选不再补偿
+	assert.NoError(t, c.Shutdown(context.Background()))
+	cluster.elect()
+}
+
+func TestDlockCluster_Executed(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+	rc := ngoredis.NewClient(&ngoredis.Options{Name: "cron", Addr: []string{s.Addr()}})
+	defer rc.Close()
+	cluster := NewDlockCluster(dlock.New(redis.NewPool(rc)))
+	ctx := context.Background()
+
+	fire := time.Now().Truncate(time.Second)
+	ok, err := cluster.Executed(ctx, "job", fire)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = cluster.Acquire(ctx, "job", fire, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cluster.Executed(ctx, "job", fire)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = cluster.Executed(ctx, "job", fire.Add(time.Second))
+	assert.False(t, ok)
+}
+
+func TestFireTime(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, int(time.Millisecond*3), time.Local)
+	schedule, _ := cron3.ParseStandard("* * * * *")
+	assert.Equal(t, time.Date(2021, 1, 1, 10, 0, 0, 0, time.Local), fireTime(schedule, now))
+	every := cron3.Every(time.Hour)
+	assert.Equal(t, fireTime(every, now), fireTime(every, now.Add(time.Minute*30)))
+}
@@ -0,0 +1,175 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
+	"github.com/NetEase-Media/ngo/pkg/dlock"
+)
+
+const (
+	// DefaultName 是server管理的调度器的默认名称
+	DefaultName = "default"
+	// DefaultZkRoot 是zookeeper集群模式的默认根路径，实际路径后会加上应用名
+	DefaultZkRoot = "/ngo/cron"
+)
+
+// Options 是server管理的调度器的配置
+type Options struct {
+	Name          string
+	Seconds       bool          // 是否支持秒级表达式
+	Location      string        // 时区，如Asia/Shanghai，为空时使用本地时区
+	Cluster       string        // 集群模式，可选dlock和zookeeper，为空时每个节点都执行
+	Zookeeper     string        // zookeeper集群模式使用的zookeeper配置名
+	ZkRoot        string        // zookeeper集群模式的根路径，默认为 DefaultZkRoot/应用名
+	Misfire       string        // 错过调度的处理策略，可选skip、run_once和catch_up
+	MisfireWindow time.Duration // 补偿的时间范围
+	Recover       bool          // 是否捕获任务的panic
+	Jobs          []JobOptions
+}
+
+// JobOptions 按名称覆盖代码中添加的任务
+type JobOptions struct {
+	Name     string
+	Spec     string // 不为空时替换代码中的表达式
+	Disabled bool   // 为true时任务添加后处于暂停状态
+}
+
+func NewDefaultOptions() *Options {
+	return &Options{
+		Name:          DefaultName,
+		Misfire:       "skip",
+		MisfireWindow: defaultMisfireWindow,
+		Recover:       true,
+	}
+}
+
+var (
+	defaultMu      sync.Mutex
+	defaultCron    *Cron
+	defaultCluster *ZkCluster
+)
+
+// Init 根据配置创建server管理的调度器，appName用于隔离不同应用的集群数据
+func Init(opt *Options, appName string) error {
+	opts, cluster, err := opt.cronOptions(appName)
+	if err != nil {
+		return err
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultCron != nil {
+		if cluster != nil {
+			cluster.Close()
+		}
+		return errors.New("duplicated init cron")
+	}
+	c, err := New(opts...)
+	if err != nil {
+		if cluster != nil {
+			cluster.Close()
+		}
+		return err
+	}
+	defaultCron = c
+	defaultCluster = cluster
+	return nil
+}
+
+func (opt *Options) cronOptions(appName string) ([]Option, *ZkCluster, error) {
+	opts := []Option{WithName(opt.Name), WithJobs(opt.Jobs)}
+	if opt.Seconds {
+		opts = append(opts, WithSeconds())
+	}
+	if opt.Location != "" {
+		loc, err := time.LoadLocation(opt.Location)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, WithLocation(loc))
+	}
+	if opt.Recover {
+		opts = append(opts, WithChain(Recover(nil)))
+	}
+	var policy MisfirePolicy
+	switch opt.Misfire {
+	case "", "skip":
+		policy = MisfireSkip
+	case "run_once":
+		policy = MisfireRunOnce
+	case "catch_up":
+		policy = MisfireCatchUp
+	default:
+		return nil, nil, fmt.Errorf("unknown cron misfire policy %s", opt.Misfire)
+	}
+	opts = append(opts, WithMisfire(policy, opt.MisfireWindow))
+
+	switch opt.Cluster {
+	case "":
+		return opts, nil, nil
+	case "dlock":
+		d := dlock.Default()
+		if d == nil {
+			return nil, nil, errors.New("dlock must be initialized for cron cluster")
+		}
+		cluster := NewDlockCluster(d).WithPrefix("cron:" + appName + ":")
+		return append(opts, WithCluster(cluster)), nil, nil
+	case "zookeeper":
+		client := zookeeper.GetZkClient(opt.Zookeeper)
+		if client == nil {
+			return nil, nil, fmt.Errorf("zookeeper client %s not found", opt.Zookeeper)
+		}
+		root := opt.ZkRoot
+		if root == "" {
+			root = path.Join(DefaultZkRoot, appName)
+		}
+		cluster := NewZkCluster(client, root)
+		return append(opts, WithCluster(cluster)), cluster, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cron cluster %s", opt.Cluster)
+	}
+}
+
+// Default 返回server管理的调度器，未调用Init时使用默认配置创建
+func Default() *Cron {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultCron == nil {
+		defaultCron = NewCron(WithName(DefaultName), WithChain(Recover(nil)))
+	}
+	return defaultCron
+}
+
+// Shutdown 停止server管理的调度器，在ctx结束前等待正在运行的任务完成
+func Shutdown(ctx context.Context) error {
+	defaultMu.Lock()
+	c, cluster := defaultCron, defaultCluster
+	defaultMu.Unlock()
+	if c == nil {
+		return nil
+	}
+	err := c.Shutdown(ctx)
+	if cluster != nil {
+		cluster.Close()
+	}
+	return err
+}
@@ -16,6 +16,9 @@ package cron
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
@@ -23,9 +26,48 @@ import (
 )
 
 type Cron struct {
-	cron *cron3.Cron
+	name   string
+	cron   *cron3.Cron
+	parser cron3.Parser
+	chain  Chain
+
+	cluster       Cluster
+	misfirePolicy MisfirePolicy
+	misfireWindow time.Duration
+
+	mu      sync.Mutex
+	lastID  EntryID
+	entries map[EntryID]*entry
+	jobs    map[string]JobOptions
+
+	// ctx 在Shutdown超时时取消，传给ContextJob
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg 跟踪补偿执行和手动触发的任务，stopped后不再添加
+	wg      sync.WaitGroup
+	stopped bool
 }
 
+// ErrEntryNotFound 是任务不存在时返回的错误
+var ErrEntryNotFound = errors.New("cron: entry not found")
+
+// ErrStopped 是调度器Shutdown后手动触发任务时返回的错误
+var ErrStopped = errors.New("cron: stopped")
+
+// MisfirePolicy 是集群模式下对停机期间错过的调度的处理策略
+type MisfirePolicy int
+
+const (
+	// MisfireSkip 跳过错过的调度
+	MisfireSkip MisfirePolicy = iota
+	// MisfireRunOnce 最近一次调度错过时，启动后执行一次
+	MisfireRunOnce
+	// MisfireCatchUp 启动后按顺序补偿执行所有错过的调度
+	MisfireCatchUp
+)
+
+const defaultMisfireWindow = time.Hour
+
 type Job interface {
 	Run()
 }
@@ -37,61 +79,275 @@ type Option func(*Cron)
 type EntryID cron3.EntryID
 
 type Entry struct {
-	ID   EntryID
-	Next time.Time
-	Prev time.Time
+	ID      EntryID   `json:"id"`
+	Name    string    `json:"name"`
+	Spec    string    `json:"spec"`
+	Next    time.Time `json:"next"`
+	Prev    time.Time `json:"prev"`
+	Paused  bool      `json:"paused"`
+	History History   `json:"history"`
 }
 
 // cron 开始部分
 
+// NewCron 创建调度器，名称与已登记的调度器重复时panic
 func NewCron(opts ...Option) *Cron {
-	c := &Cron{}
+	c, err := New(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// New 创建调度器并按名称登记，名称与已登记的调度器重复时返回错误。
+// 调度器在Stop或Shutdown后注销，Stop后再次Start时重新登记
+func New(opts ...Option) (*Cron, error) {
+	c := &Cron{
+		parser:        cron3.NewParser(cron3.Minute | cron3.Hour | cron3.Dom | cron3.Month | cron3.Dow | cron3.Descriptor),
+		misfireWindow: defaultMisfireWindow,
+		entries:       make(map[EntryID]*entry),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 	c.cron = cron3.New()
 	for _, opt := range opts {
 		opt(c)
 	}
-	return c
+	if err := register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Name 返回调度器的名称，未通过WithName设置时为 cron-<序号>
+func (c *Cron) Name() string {
+	return c.name
 }
 
 func (c *Cron) Location() *time.Location {
 	return c.cron.Location()
 }
 
+// Start 开始调度，集群模式下按MisfirePolicy在后台补偿停机期间错过的调度。
+// 通过选主执行任务的Cluster（如ZkCluster）在当选主节点后补偿
 func (c *Cron) Start() {
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	if !stopped {
+		if err := register(c); err != nil {
+			log.Errorf("cron: register %s failed: %s", c.name, err)
+		}
+	}
 	c.cron.Start()
+	if c.cluster == nil || c.misfirePolicy == MisfireSkip {
+		return
+	}
+	if n, ok := c.cluster.(electionNotifier); ok {
+		n.OnElected(c.misfire)
+		return
+	}
+	c.misfire()
+}
+
+// misfire 在后台补偿所有任务错过的调度
+func (c *Cron) misfire() {
+	now := time.Now().In(c.Location())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	for _, e := range c.entries {
+		c.wg.Add(1)
+		go func(e *entry) {
+			defer c.wg.Done()
+			if !e.isPaused() {
+				e.cluster.misfire(now)
+			}
+		}(e)
+	}
 }
 
+// Stop 停止调度，不会停止正在运行的任务，返回的context在任务完成后结束
 func (c *Cron) Stop() context.Context {
+	unregister(c)
 	return c.cron.Stop()
 }
 
+// Shutdown 停止调度并等待正在运行的任务完成。ctx结束时取消传给ContextJob的context并返回ctx.Err()，
+// Shutdown后不能再次Start
+func (c *Cron) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	unregister(c)
+	stopped := c.cron.Stop()
+	done := make(chan struct{})
+	go func() {
+		<-stopped.Done()
+		c.wg.Wait()
+		close(done)
+	}()
+	defer c.cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause 暂停任务的调度，不影响正在运行的任务和手动触发
+func (c *Cron) Pause(id EntryID) error {
+	return c.setPaused(id, true)
+}
+
+// Resume 恢复任务的调度
+func (c *Cron) Resume(id EntryID) error {
+	return c.setPaused(id, false)
+}
+
+func (c *Cron) setPaused(id EntryID, paused bool) error {
+	e := c.getEntry(id)
+	if e == nil {
+		return ErrEntryNotFound
+	}
+	e.mu.Lock()
+	e.paused = paused
+	e.mu.Unlock()
+	return nil
+}
+
+// Trigger 在当前节点上立即异步执行一次任务，集群模式下也不会获取执行权
+func (c *Cron) Trigger(id EntryID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return ErrStopped
+	}
+	e := c.entries[id]
+	if e == nil {
+		return ErrEntryNotFound
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		e.record.Run()
+	}()
+	return nil
+}
+
+func (c *Cron) getEntry(id EntryID) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[id]
+}
+
 func (c *Cron) AddFunc(spec string, cmd func()) (EntryID, error) {
-	entryId, err := c.cron.AddFunc(spec, cmd)
-	return EntryID(entryId), err
+	return c.AddJob(spec, cron3.FuncJob(cmd))
 }
 
+// AddJob 添加任务，集群模式下任务名为 entry-<EntryID>，依赖各节点按相同顺序添加任务，建议使用AddNamedJob
 func (c *Cron) AddJob(spec string, cmd Job) (EntryID, error) {
-	entryId, err := c.cron.AddJob(spec, cmd)
-	return EntryID(entryId), err
+	return c.addJob("", spec, cmd)
+}
+
+// AddContextFunc 添加接收context并返回错误的任务，错误记录在执行历史中
+func (c *Cron) AddContextFunc(spec string, cmd func(ctx context.Context) error) (EntryID, error) {
+	return c.AddJob(spec, ContextFunc(cmd))
+}
+
+// AddNamedFunc 添加有名称的任务，集群模式下同名任务的每次调度只在一个节点上执行
+func (c *Cron) AddNamedFunc(name, spec string, cmd func()) (EntryID, error) {
+	return c.AddNamedJob(name, spec, cron3.FuncJob(cmd))
+}
+
+// AddNamedJob 添加有名称的任务，集群模式下同名任务的每次调度只在一个节点上执行。
+// WithJobs中有同名配置时使用配置的表达式，配置为disabled的任务添加后处于暂停状态
+func (c *Cron) AddNamedJob(name, spec string, cmd Job) (EntryID, error) {
+	if name == "" {
+		return 0, errors.New("cron: empty job name")
+	}
+	o := c.jobs[name]
+	if o.Spec != "" {
+		spec = o.Spec
+	}
+	id, err := c.addJob(name, spec, cmd)
+	if err == nil && o.Disabled {
+		err = c.Pause(id)
+	}
+	return id, err
+}
+
+// AddNamedContextFunc 添加有名称的接收context并返回错误的任务
+func (c *Cron) AddNamedContextFunc(name, spec string, cmd func(ctx context.Context) error) (EntryID, error) {
+	return c.AddNamedJob(name, spec, ContextFunc(cmd))
+}
+
+// addJob 依次使用chain、执行记录和集群包装任务
+func (c *Cron) addJob(name, spec string, cmd Job) (EntryID, error) {
+	schedule, err := c.parser.Parse(spec)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 任务只通过addJob添加，EntryID与robfig cron中的序号一致
+	c.lastID++
+	if name == "" {
+		name = "entry-" + strconv.Itoa(int(c.lastID))
+	}
+	e := &entry{name: name, spec: spec}
+	e.record = &recordJob{c: c, entry: e, job: c.chain.Then(cmd)}
+	if c.cluster != nil {
+		e.cluster = &clusterJob{c: c, name: name, schedule: schedule, job: e.record}
+	}
+	id := EntryID(c.cron.Schedule(schedule, e))
+	c.entries[id] = e
+	return id, nil
+}
+
+// recordTTL 是集群模式下执行记录保留的时间，至少覆盖补偿的时间范围
+func (c *Cron) recordTTL() time.Duration {
+	if c.misfireWindow < time.Minute {
+		return time.Minute
+	}
+	return c.misfireWindow
 }
 
+// Entries 返回所有任务及其执行记录
 func (c *Cron) Entries() []*Entry {
 	entries := c.cron.Entries()
 	result := make([]*Entry, 0)
 	for _, e := range entries {
-		e1 := &Entry{ID: EntryID(e.ID), Next: e.Next, Prev: e.Prev}
-		result = append(result, e1)
+		result = append(result, c.entry(e))
 	}
 	return result
 }
 
 func (c *Cron) Entry(id EntryID) *Entry {
-	e := c.cron.Entry(cron3.EntryID(id))
-	return &Entry{ID: EntryID(e.ID), Next: e.Next, Prev: e.Prev}
+	return c.entry(c.cron.Entry(cron3.EntryID(id)))
+}
+
+func (c *Cron) entry(e cron3.Entry) *Entry {
+	result := &Entry{ID: EntryID(e.ID), Next: e.Next, Prev: e.Prev}
+	c.mu.Lock()
+	meta, ok := c.entries[result.ID]
+	c.mu.Unlock()
+	if ok {
+		result.Name = meta.name
+		result.Spec = meta.spec
+		result.Paused = meta.isPaused()
+		result.History = meta.History()
+	}
+	return result
 }
 
 func (c *Cron) Remove(id EntryID) {
 	c.cron.Remove(cron3.EntryID(id))
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
 }
 
 // Cron 结束部分
@@ -106,13 +362,49 @@ func WithLocation(loc *time.Location) Option {
 //秒级cron支持
 func WithSeconds() Option {
 	return func(c *Cron) {
-		cron3.WithSeconds()(c.cron)
+		c.parser = cron3.NewParser(cron3.Second | cron3.Minute | cron3.Hour | cron3.Dom | cron3.Month | cron3.Dow | cron3.Descriptor)
+		cron3.WithParser(c.parser)(c.cron)
+	}
+}
+
+// WithCluster 开启集群模式，每次调度通过cluster获取执行权，同一任务只在一个节点上执行
+func WithCluster(cluster Cluster) Option {
+	return func(c *Cron) {
+		c.cluster = cluster
+	}
+}
+
+// WithMisfire 设置集群模式下对停机期间错过的调度的处理策略，只补偿Start前window内的调度，window默认为1小时
+func WithMisfire(policy MisfirePolicy, window time.Duration) Option {
+	return func(c *Cron) {
+		c.misfirePolicy = policy
+		if window > 0 {
+			c.misfireWindow = window
+		}
 	}
 }
 
+// WithChain 设置所有任务使用的JobWrapper，见NewChain
 func WithChain(wrappers ...JobWrapper) Option {
 	return func(c *Cron) {
-		cron3.WithChain()(c.cron)
+		c.chain = NewChain(wrappers...)
+	}
+}
+
+// WithJobs 设置任务的配置，按名称覆盖AddNamedJob等方法添加的任务
+func WithJobs(jobs []JobOptions) Option {
+	return func(c *Cron) {
+		c.jobs = make(map[string]JobOptions, len(jobs))
+		for _, j := range jobs {
+			c.jobs[j.Name] = j
+		}
+	}
+}
+
+// WithName 设置调度器的名称，用于管理接口
+func WithName(name string) Option {
+	return func(c *Cron) {
+		c.name = name
 	}
 }
 
@@ -15,8 +15,10 @@
 package cron
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -70,3 +72,95 @@ func TestNgoLoggerWrapper(t *testing.T) {
 	alogger.Info("test", 1, 2)
 	alogger.Error(errors.New("test"), "test error", 2, 3)
 }
+
+func TestPauseAndTrigger(t *testing.T) {
+	var runs int32
+	c := NewCron(WithSeconds())
+	id, err := c.AddNamedFunc("job", "@every 1s", func() { atomic.AddInt32(&runs, 1) })
+	assert.Nil(t, err)
+	assert.Nil(t, c.Pause(id))
+	assert.True(t, c.Entry(id).Paused)
+	c.Start()
+	defer c.Stop()
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&runs))
+
+	// 暂停的任务也可以手动触发
+	assert.Nil(t, c.Trigger(id))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), c.Entry(id).History.Runs)
+
+	assert.Nil(t, c.Resume(id))
+	assert.False(t, c.Entry(id).Paused)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) > 1 }, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, ErrEntryNotFound, c.Pause(100))
+	assert.Equal(t, ErrEntryNotFound, c.Trigger(100))
+}
+
+func TestShutdown(t *testing.T) {
+	c := NewCron()
+	id, _ := c.AddContextFunc("@daily", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Start()
+	assert.Nil(t, c.Trigger(id))
+	assert.Eventually(t, func() bool { return c.Entry(id).History.Running == 1 }, time.Second, 10*time.Millisecond)
+
+	// 超时后取消任务的context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.Shutdown(ctx))
+	assert.Eventually(t, func() bool { return c.Entry(id).History.Failures == 1 }, time.Second, 10*time.Millisecond)
+	// Shutdown后不能再手动触发
+	assert.Equal(t, ErrStopped, c.Trigger(id))
+
+	c = NewCron()
+	_, _ = c.AddFunc("@daily", func() {})
+	c.Start()
+	assert.Nil(t, c.Shutdown(context.Background()))
+}
+
+func TestJobs(t *testing.T) {
+	c := NewCron(WithJobs([]JobOptions{
+		{Name: "spec", Spec: "@hourly"},
+		{Name: "disabled", Disabled: true},
+	}))
+	id, err := c.AddNamedFunc("spec", "@daily", func() {})
+	assert.Nil(t, err)
+	assert.Equal(t, "@hourly", c.Entry(id).Spec)
+	assert.False(t, c.Entry(id).Paused)
+	id, err = c.AddNamedFunc("disabled", "@daily", func() {})
+	assert.Nil(t, err)
+	assert.Equal(t, "@daily", c.Entry(id).Spec)
+	assert.True(t, c.Entry(id).Paused)
+}
+
+func TestOptions(t *testing.T) {
+	opt := NewDefaultOptions()
+	opt.Seconds = true
+	opt.Location = "Asia/Shanghai"
+	opt.Misfire = "catch_up"
+	opts, cluster, err := opt.cronOptions("app")
+	assert.Nil(t, err)
+	assert.Nil(t, cluster)
+	c := NewCron(opts...)
+	assert.Equal(t, DefaultName, c.Name())
+	assert.Equal(t, "Asia/Shanghai", c.Location().String())
+	assert.Equal(t, MisfireCatchUp, c.misfirePolicy)
+	_, err = c.AddFunc("*/5 * * * * *", func() {})
+	assert.Nil(t, err)
+
+	opt.Misfire = "none"
+	_, _, err = opt.cronOptions("app")
+	assert.NotNil(t, err)
+	opt.Misfire = ""
+	opt.Cluster = "zookeeper"
+	opt.Zookeeper = "none"
+	_, _, err = opt.cronOptions("app")
+	assert.NotNil(t, err)
+	opt.Cluster = "etcd"
+	_, _, err = opt.cronOptions("app")
+	assert.NotNil(t, err)
+}
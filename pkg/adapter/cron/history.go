@@ -0,0 +1,185 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// History 是任务在当前节点上的执行记录，集群模式下未获取执行权的调度不计入
+type History struct {
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+	Skips        int64         `json:"skips"`
+	Running      int           `json:"running"`
+	LastStart    time.Time     `json:"lastStart"`
+	LastDuration time.Duration `json:"lastDuration"`
+	LastError    string        `json:"lastError,omitempty"`
+}
+
+// entry 是调度的任务，保存任务的名称、状态和执行记录
+type entry struct {
+	name    string
+	spec    string
+	record  *recordJob
+	cluster *clusterJob
+	mu      sync.Mutex
+	paused  bool
+	history History
+}
+
+// Run 跳过暂停的任务，集群模式下先获取执行权
+func (e *entry) Run() {
+	if e.isPaused() {
+		return
+	}
+	if e.cluster != nil {
+		e.cluster.Run()
+		return
+	}
+	e.record.Run()
+}
+
+func (e *entry) isPaused() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.paused
+}
+
+func (e *entry) History() History {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.history
+}
+
+func (e *entry) begin() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history.Running++
+}
+
+func (e *entry) end(start time.Time, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history.Running--
+	if err == ErrSkipped {
+		e.history.Skips++
+		return
+	}
+	e.history.Runs++
+	e.history.LastStart = start
+	e.history.LastDuration = time.Since(start)
+	e.history.LastError = ""
+	if err != nil {
+		e.history.Failures++
+		e.history.LastError = err.Error()
+	}
+}
+
+// recordJob 记录任务的执行，panic会被记录后继续抛出
+type recordJob struct {
+	c     *Cron
+	entry *entry
+	job   Job
+}
+
+func (j *recordJob) Run() {
+	_ = j.RunContext(j.c.ctx)
+}
+
+func (j *recordJob) RunContext(ctx context.Context) (err error) {
+	start := time.Now()
+	j.entry.begin()
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("cron: job panic: %v", r)
+		}
+		j.entry.end(start, err)
+		if r != nil {
+			panic(r)
+		}
+	}()
+	return runJob(ctx, j.job)
+}
+
+// Info 是调度器及其任务的信息
+type Info struct {
+	Name    string   `json:"name"`
+	Entries []*Entry `json:"entries"`
+}
+
+var (
+	cronsMu sync.Mutex
+	crons   = make(map[string]*Cron)
+	cronSeq uint32
+)
+
+// register 登记调度器，未设置名称时生成 cron-<序号>，名称已被其他调度器占用时返回错误
+func register(c *Cron) error {
+	cronsMu.Lock()
+	defer cronsMu.Unlock()
+	for c.name == "" {
+		name := fmt.Sprintf("cron-%d", atomic.AddUint32(&cronSeq, 1))
+		if _, ok := crons[name]; !ok {
+			c.name = name
+		}
+	}
+	if o, ok := crons[c.name]; ok && o != c {
+		return fmt.Errorf("cron: duplicated cron name %s", c.name)
+	}
+	crons[c.name] = c
+	return nil
+}
+
+// unregister 注销调度器，名称已被其他调度器使用时不做处理
+func unregister(c *Cron) {
+	cronsMu.Lock()
+	defer cronsMu.Unlock()
+	if crons[c.name] == c {
+		delete(crons, c.name)
+	}
+}
+
+// Crons 返回所有调度器的信息
+func Crons() []Info {
+	cronsMu.Lock()
+	infos := make([]Info, 0, len(crons))
+	for _, c := range crons {
+		infos = append(infos, Info{Name: c.name})
+	}
+	cronsMu.Unlock()
+	for i := range infos {
+		if c := GetCron(infos[i].Name); c != nil {
+			infos[i].Entries = c.Entries()
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// GetCron 返回指定名称的调度器
+func GetCron(name string) *Cron {
+	cronsMu.Lock()
+	defer cronsMu.Unlock()
+	return crons[name]
+}
@@ -16,73 +16,138 @@ package job
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 	"github.com/NetEase-Media/ngo/pkg/client/httplib"
-	"github.com/NetEase-Media/ngo/pkg/util"
 )
 
 const (
 	maxRetries = 3
+
+	// DefaultIndexEnv 是kubernetes indexed job设置的分片序号环境变量
+	DefaultIndexEnv = "JOB_COMPLETION_INDEX"
+)
+
+// 分片来源
+const (
+	ShardCenter    = "center"
+	ShardStatic    = "static"
+	ShardEnv       = "env"
+	ShardRedis     = "redis"
+	ShardZookeeper = "zookeeper"
 )
 
 type Args struct {
 	SharedNum int
+	// SharedTotal 是分片总数，分片来源无法提供时为0
+	SharedTotal int
+	// Lost 在分片的租约丢失（被其他pod占用或续约超时）时关闭，不使用租约的分片来源为nil
+	Lost <-chan struct{}
 }
 
 type Callback func(*Args) (string, error)
 
 type Options struct {
-	CenterUrl string
-	Namespace string
+	CenterUrl   string
+	Namespace   string
+	Shard       string        // 分片来源，配置了CenterUrl时默认为center，否则为static
+	SharedNum   int           // static的分片序号
+	SharedTotal int           // 分片总数，redis和zookeeper必填
+	IndexEnv    string        // env读取的环境变量，默认为JOB_COMPLETION_INDEX
+	Redis       string        // redis使用的客户端名
+	Zookeeper   string        // zookeeper使用的客户端名
+	Key         string        // redis的key前缀或zookeeper的根路径，默认为 ngo:job:namespace 或 /ngo/job/namespace
+	LeaseTTL    time.Duration // redis分片的租约时长，运行期间自动续约
 }
 
-func (o *Options) check() {
-	if o.CenterUrl == "" {
-		log.Fatalf("empty center url")
-	}
+func (o *Options) check() error {
 	if o.Namespace == "" {
 		o.Namespace = "default"
 	}
+	if o.Shard == "" {
+		o.Shard = ShardStatic
+		if o.CenterUrl != "" {
+			o.Shard = ShardCenter
+		}
+	}
+	if o.Shard == ShardCenter && o.CenterUrl == "" {
+		return errors.New("empty center url")
+	}
+	if o.IndexEnv == "" {
+		o.IndexEnv = DefaultIndexEnv
+	}
+	if o.LeaseTTL <= 0 {
+		o.LeaseTTL = time.Minute
+	}
+	return nil
 }
 
 type job struct {
-	opt      *Options
 	f        Callback
 	hostname string
+	provider ShardProvider
+	reporter Reporter
+}
+
+// RunWith 使用指定的分片来源和上报方式运行函数，返回获取分片的错误或函数的错误，不会退出进程。
+// reporter为nil时只打印日志，适用于本地运行和测试
+func RunWith(ctx context.Context, f Callback, provider ShardProvider, reporter Reporter) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	j := &job{
+		f:        f,
+		hostname: hostname,
+		provider: provider,
+		reporter: reporter,
+	}
+	return j.run(ctx)
 }
 
-func (t *job) run() {
+func (t *job) run(ctx context.Context) error {
 	// 准备环境，获取分片信息
-	res := t.setUp()
+	args, err := t.setUp(ctx)
+	if err != nil {
+		return err
+	}
+	return t.execute(args)
+}
+
+// execute 运行函数，上报结果并释放分片
+func (t *job) execute(args *Args) (err error) {
+	if r, ok := t.provider.(ShardReleaser); ok {
+		defer func() {
+			if err := r.Release(context.Background(), t.hostname, args); err != nil {
+				log.Errorf("release shard failed: %s", err.Error())
+			}
+		}()
+	}
 
 	var retString string
-	var err error
 
 	// 结束处理
 	startTime := time.Now()
 	defer t.tearDown(startTime, &retString, &err)
 
-	args := &Args{
-		SharedNum: res.Data.SharedNum,
-	}
 	retString, err = t.f(args)
+	return err
 }
 
-func (t *job) setUp() *GetShareNumResponse {
-	var res *GetShareNumResponse
+func (t *job) setUp(ctx context.Context) (*Args, error) {
+	var args *Args
 	var err error
 	for i := 0; i < maxRetries; i++ {
-		res, err = t.getArgs()
+		args, err = t.provider.Shard(ctx, t.hostname)
 		if err == nil {
 			break
 		}
 	}
-
-	util.CheckError(err)
-	return res
+	return args, err
 }
 
 func (t *job) tearDown(startTime time.Time, retString *string, retErr *error) {
@@ -94,6 +159,7 @@ func (t *job) tearDown(startTime time.Time, retString *string, retErr *error) {
 	}
 	if r := recover(); r != nil {
 		req.Exception = fmt.Sprintf("%v", r)
+		*retErr = fmt.Errorf("job panic: %v", r)
 	} else {
 		if (*retErr) != nil {
 			req.Exception = (*retErr).Error()
@@ -108,9 +174,12 @@ func (t *job) tearDown(startTime time.Time, retString *string, retErr *error) {
 		"exception", req.Exception,
 	).Info("report job")
 
+	if t.reporter == nil {
+		return
+	}
 	var err error
 	for i := 0; i < maxRetries; i++ {
-		err = t.report(req)
+		err = t.reporter.Report(context.Background(), req)
 		if err == nil {
 			break
 		}
@@ -120,6 +189,17 @@ func (t *job) tearDown(startTime time.Time, retString *string, retErr *error) {
 	}
 }
 
+// Center 从调度中心获取分片并上报结果
+type Center struct {
+	url       string
+	namespace string
+}
+
+// NewCenter 创建调度中心的ShardProvider和Reporter
+func NewCenter(url, namespace string) *Center {
+	return &Center{url: url, namespace: namespace}
+}
+
 type GetShareNumResponse struct {
 	Status  int             `json:"status"`
 	Message string          `json:"message"`
@@ -130,14 +210,14 @@ type GetShareNumData struct {
 	SharedNum int `json:"sharedNum"`
 }
 
-func (t *job) getArgs() (*GetShareNumResponse, error) {
-	url := fmt.Sprintf("%s/api/v1/%s/podshared/getSharedNum", t.opt.CenterUrl, t.opt.Namespace)
+func (c *Center) Shard(ctx context.Context, podName string) (*Args, error) {
+	url := fmt.Sprintf("%s/api/v1/%s/podshared/getSharedNum", c.url, c.namespace)
 	var res GetShareNumResponse
-	_, err := httplib.Get(url).AddQuery("podName", t.hostname).BindJson(&res).Do(context.Background())
+	_, err := httplib.Get(url).AddQuery("podName", podName).BindJson(&res).Do(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &res, nil
+	return &Args{SharedNum: res.Data.SharedNum}, nil
 }
 
 // ReportRequest 是结果上报结构
@@ -154,9 +234,9 @@ type ReportResponse struct {
 	Message string `json:"message"`
 }
 
-func (t *job) report(req *ReportRequest) error {
-	url := fmt.Sprintf("%s/api/v1/%s/podshared/report", t.opt.CenterUrl, t.opt.Namespace)
+func (c *Center) Report(ctx context.Context, req *ReportRequest) error {
+	url := fmt.Sprintf("%s/api/v1/%s/podshared/report", c.url, c.namespace)
 	var res ReportResponse
-	_, err := httplib.Post(url).SetJson(req).BindJson(&res).Do(context.Background())
+	_, err := httplib.Post(url).SetJson(req).BindJson(&res).Do(ctx)
 	return err
 }
@@ -15,15 +15,20 @@
 package job
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/NetEase-Media/ngo/pkg/client/httplib"
@@ -120,18 +125,141 @@ func TestJob(t *testing.T) {
 		}))
 
 		opt.CenterUrl = s.URL
+		center := NewCenter(opt.CenterUrl, opt.Namespace)
 
 		j := &job{
-			opt:      opt,
 			f:        args.f,
 			hostname: args.hostname,
+			provider: center,
+			reporter: center,
 		}
-		j.run()
+		_ = j.run(context.Background())
 
 		s.Close()
 	}
 }
 
-func testRun(t *testing.T, hostname string, f Callback, err error, panic interface{}) {
+func TestRunWith(t *testing.T) {
+	var reqs []*ReportRequest
+	reporter := ReporterFunc(func(ctx context.Context, req *ReportRequest) error {
+		reqs = append(reqs, req)
+		return nil
+	})
 
+	err := RunWith(context.Background(), func(a *Args) (string, error) {
+		return strconv.Itoa(a.SharedNum) + "/" + strconv.Itoa(a.SharedTotal), nil
+	}, NewStaticShard(1, 3), reporter)
+	assert.Nil(t, err)
+	assert.Equal(t, "1/3", reqs[0].Result)
+
+	err = RunWith(context.Background(), func(a *Args) (string, error) {
+		panic("fake panic")
+	}, NewStaticShard(0, 0), reporter)
+	assert.EqualError(t, err, "job panic: fake panic")
+	assert.Equal(t, "fake panic", reqs[1].Exception)
+
+	// 获取分片失败时不运行函数
+	err = RunWith(context.Background(), func(a *Args) (string, error) {
+		assert.Fail(t, "should not run")
+		return "", nil
+	}, NewEnvShard("NGO_JOB_TEST_INDEX", 0), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(reqs))
+}
+
+func TestEnvShard(t *testing.T) {
+	os.Setenv("NGO_JOB_TEST_INDEX", "2")
+	defer os.Unsetenv("NGO_JOB_TEST_INDEX")
+	args, err := NewEnvShard("NGO_JOB_TEST_INDEX", 4).Shard(context.Background(), "pod")
+	assert.Nil(t, err)
+	assert.Equal(t, &Args{SharedNum: 2, SharedTotal: 4}, args)
+
+	os.Setenv("NGO_JOB_TEST_INDEX", "x")
+	_, err = NewEnvShard("NGO_JOB_TEST_INDEX", 4).Shard(context.Background(), "pod")
+	assert.NotNil(t, err)
+}
+
+func TestRedisShard(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.Nil(t, err)
+	defer mr.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctx := context.Background()
+	s := NewRedisShard(client, "job", 2, 300*time.Millisecond)
+	a1, err := s.Shard(ctx, "pod1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, a1.SharedNum)
+	a2, err := s.Shard(ctx, "pod2")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, a2.SharedNum)
+	_, err = s.Shard(ctx, "pod3")
+	assert.Equal(t, ErrNoShard, err)
+
+	// 同名pod继续使用原来的分片
+	a, err := s.Shard(ctx, "pod1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, a.SharedNum)
+
+	// 运行期间自动续约
+	for i := 0; i < 3; i++ {
+		time.Sleep(150 * time.Millisecond)
+		mr.FastForward(200 * time.Millisecond)
+	}
+	_, err = s.Shard(ctx, "pod3")
+	assert.Equal(t, ErrNoShard, err)
+
+	assert.Nil(t, s.Release(ctx, "pod2", a2))
+	a3, err := s.Shard(ctx, "pod3")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, a3.SharedNum)
+
+	// 分片被其他pod占用后通知租约丢失
+	select {
+	case <-a.Lost:
+		t.Fatal("lease should not be lost")
+	default:
+	}
+	assert.Nil(t, mr.Set("job:0", "pod4"))
+	select {
+	case <-a.Lost:
+	case <-time.After(time.Second):
+		t.Fatal("lease lost is not notified")
+	}
+	_, err = s.Shard(ctx, "pod1")
+	assert.Equal(t, ErrNoShard, err)
+}
+
+func TestOptions(t *testing.T) {
+	opt := &Options{}
+	assert.Nil(t, opt.check())
+	assert.Equal(t, ShardStatic, opt.Shard)
+	assert.Equal(t, "default", opt.Namespace)
+	provider, reporter, err := newProvider(opt)
+	assert.Nil(t, err)
+	assert.IsType(t, &StaticShard{}, provider)
+	assert.Nil(t, reporter)
+
+	opt = &Options{CenterUrl: "http://center"}
+	assert.Nil(t, opt.check())
+	assert.Equal(t, ShardCenter, opt.Shard)
+	provider, reporter, err = newProvider(opt)
+	assert.Nil(t, err)
+	assert.IsType(t, &Center{}, provider)
+	assert.IsType(t, &Center{}, reporter)
+
+	opt = &Options{Shard: ShardCenter}
+	assert.NotNil(t, opt.check())
+
+	opt = &Options{Shard: ShardEnv}
+	assert.Nil(t, opt.check())
+	assert.Equal(t, DefaultIndexEnv, opt.IndexEnv)
+
+	for _, shard := range []string{ShardRedis, ShardZookeeper, "none"} {
+		opt = &Options{Shard: shard}
+		assert.Nil(t, opt.check())
+		_, _, err = newProvider(opt)
+		assert.NotNil(t, err)
+	}
 }
@@ -15,28 +15,36 @@
 package job
 
 import (
+	"context"
 	"os"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/config"
 	"github.com/NetEase-Media/ngo/pkg/util"
 )
 
-// Run 运行函数并退出进程
+// Run 运行函数并退出进程，分片来源和上报方式见Options
 func Run(f Callback) {
 	var opt Options
 	err := config.Unmarshal("job", &opt)
 	util.CheckError(err)
-	opt.check()
+	util.CheckError(opt.check())
+
+	provider, reporter, err := newProvider(&opt)
+	util.CheckError(err)
 
 	hostname, err := os.Hostname()
 	util.CheckError(err)
 
 	j := &job{
-		opt:      &opt,
 		f:        f,
 		hostname: hostname,
+		provider: provider,
+		reporter: reporter,
 	}
-	j.run()
+	args, err := j.setUp(context.Background())
+	util.CheckError(err)
+	// 函数的错误已经上报
+	_ = j.execute(args)
 
 	os.Exit(0)
 }
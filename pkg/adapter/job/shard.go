@@ -0,0 +1,318 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/go-zookeeper/zk"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/client/redis"
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
+)
+
+// ErrNoShard 是所有分片都已被占用时返回的错误
+var ErrNoShard = errors.New("job: no free shard")
+
+// ShardProvider 为pod分配分片
+type ShardProvider interface {
+	Shard(ctx context.Context, podName string) (*Args, error)
+}
+
+// ShardReleaser 是分片需要在运行结束后释放的ShardProvider
+type ShardReleaser interface {
+	ShardProvider
+	Release(ctx context.Context, podName string, args *Args) error
+}
+
+// Reporter 上报运行结果
+type Reporter interface {
+	Report(ctx context.Context, req *ReportRequest) error
+}
+
+// ReporterFunc 将函数转换为Reporter
+type ReporterFunc func(ctx context.Context, req *ReportRequest) error
+
+func (f ReporterFunc) Report(ctx context.Context, req *ReportRequest) error {
+	return f(ctx, req)
+}
+
+// StaticShard 是固定的分片
+type StaticShard Args
+
+// NewStaticShard 返回固定的分片，total未知时为0
+func NewStaticShard(num, total int) *StaticShard {
+	return &StaticShard{SharedNum: num, SharedTotal: total}
+}
+
+func (s *StaticShard) Shard(ctx context.Context, podName string) (*Args, error) {
+	args := Args(*s)
+	return &args, nil
+}
+
+// EnvShard 从环境变量读取分片序号，如kubernetes indexed job的JOB_COMPLETION_INDEX
+type EnvShard struct {
+	name  string
+	total int
+}
+
+// NewEnvShard 返回读取环境变量name的分片，name为空时为DefaultIndexEnv
+func NewEnvShard(name string, total int) *EnvShard {
+	if name == "" {
+		name = DefaultIndexEnv
+	}
+	return &EnvShard{name: name, total: total}
+}
+
+func (s *EnvShard) Shard(ctx context.Context, podName string) (*Args, error) {
+	v, ok := os.LookupEnv(s.name)
+	if !ok {
+		return nil, fmt.Errorf("job: env %s not set", s.name)
+	}
+	num, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("job: invalid env %s=%s", s.name, v)
+	}
+	return &Args{SharedNum: num, SharedTotal: s.total}, nil
+}
+
+// RedisShard 在redis中为pod分配空闲的最小分片序号，分片以租约的形式保存，运行期间自动续约，
+// 进程异常退出时租约过期后分片可以被重新分配
+type RedisShard struct {
+	client redis.Redis
+	prefix string
+	total  int
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	cancels map[int]context.CancelFunc
+}
+
+// NewRedisShard 创建RedisShard，分片key为 prefix:序号
+func NewRedisShard(client redis.Redis, prefix string, total int, ttl time.Duration) *RedisShard {
+	return &RedisShard{
+		client:  client,
+		prefix:  prefix,
+		total:   total,
+		ttl:     ttl,
+		cancels: make(map[int]context.CancelFunc),
+	}
+}
+
+func (s *RedisShard) Shard(ctx context.Context, podName string) (*Args, error) {
+	if s.total <= 0 {
+		return nil, errors.New("job: shared total must be positive")
+	}
+	for i := 0; i < s.total; i++ {
+		// 同名pod重启后继续使用原来的分片
+		ok, err := s.client.Eval(ctx, redisAcquireScript, []string{s.key(i)}, podName, s.ttl.Milliseconds()).Bool()
+		if err != nil && err != goredis.Nil {
+			return nil, err
+		}
+		if ok {
+			return &Args{SharedNum: i, SharedTotal: s.total, Lost: s.keepAlive(i, podName)}, nil
+		}
+	}
+	return nil, ErrNoShard
+}
+
+func (s *RedisShard) Release(ctx context.Context, podName string, args *Args) error {
+	s.mu.Lock()
+	if cancel, ok := s.cancels[args.SharedNum]; ok {
+		cancel()
+		delete(s.cancels, args.SharedNum)
+	}
+	s.mu.Unlock()
+	return s.client.Eval(ctx, redisReleaseScript, []string{s.key(args.SharedNum)}, podName).Err()
+}
+
+// keepAlive 每ttl/3续约一次，直到Release。分片被其他pod占用或超过ttl未能续约时关闭返回的channel并停止续约
+func (s *RedisShard) keepAlive(num int, podName string) <-chan struct{} {
+	ctx, cancel := context.WithCancel(context.Background())
+	lost := make(chan struct{})
+	s.mu.Lock()
+	if c, ok := s.cancels[num]; ok {
+		c()
+	}
+	s.cancels[num] = cancel
+	s.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(s.ttl / 3)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ok, err := s.client.Eval(ctx, redisAcquireScript, []string{s.key(num)}, podName, s.ttl.Milliseconds()).Bool()
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Errorf("renew shard %d failed: %s", num, err.Error())
+					if time.Since(renewed) < s.ttl {
+						continue
+					}
+				} else if ok {
+					renewed = time.Now()
+					continue
+				}
+				log.Errorf("lease of shard %d is lost", num)
+				close(lost)
+				return
+			}
+		}
+	}()
+	return lost
+}
+
+func (s *RedisShard) key(num int) string {
+	return s.prefix + ":" + strconv.Itoa(num)
+}
+
+// redisAcquireScript 分片空闲或属于同名pod时占用并设置过期时间
+const redisAcquireScript = `
+	local owner = redis.call("GET", KEYS[1])
+	if owner and owner ~= ARGV[1] then
+		return 0
+	end
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+`
+
+const redisReleaseScript = `
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`
+
+// ZkShard 在zookeeper中以临时节点 root/序号 为pod分配空闲的最小分片序号，会话断开后分片可以被重新分配
+type ZkShard struct {
+	client *zookeeper.ZookeeperProxy
+	root   string
+	total  int
+}
+
+// NewZkShard 创建ZkShard
+func NewZkShard(client *zookeeper.ZookeeperProxy, root string, total int) *ZkShard {
+	return &ZkShard{client: client, root: root, total: total}
+}
+
+func (s *ZkShard) Shard(ctx context.Context, podName string) (*Args, error) {
+	if s.total <= 0 {
+		return nil, errors.New("job: shared total must be positive")
+	}
+	for i := 0; i < s.total; i++ {
+		node := path.Join(s.root, strconv.Itoa(i))
+		ok, err := s.create(node, podName)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &Args{SharedNum: i, SharedTotal: s.total}, nil
+		}
+	}
+	return nil, ErrNoShard
+}
+
+// create 创建分片节点，节点属于同名pod时（如pod重启后旧会话尚未过期）删除后以当前会话重新创建，
+// 节点属于其他pod时返回false
+func (s *ZkShard) create(node, podName string) (bool, error) {
+	_, err := s.client.CreateRecursive(node, []byte(podName), zk.FlagEphemeral)
+	if err != zk.ErrNodeExists {
+		return err == nil, err
+	}
+	data, stat, err := s.client.Get(node)
+	switch {
+	case err == zk.ErrNoNode:
+	case err != nil:
+		return false, err
+	case string(data) != podName:
+		return false, nil
+	default:
+		if err := s.client.Remove(node, stat.Version); err != nil && err != zk.ErrNoNode && err != zk.ErrBadVersion {
+			return false, err
+		}
+	}
+	_, err = s.client.CreateRecursive(node, []byte(podName), zk.FlagEphemeral)
+	if err == zk.ErrNodeExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *ZkShard) Release(ctx context.Context, podName string, args *Args) error {
+	node := path.Join(s.root, strconv.Itoa(args.SharedNum))
+	data, stat, err := s.client.Get(node)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(data) != podName {
+		return nil
+	}
+	return s.client.Remove(node, stat.Version)
+}
+
+// newProvider 根据配置创建分片来源和上报方式
+func newProvider(opt *Options) (ShardProvider, Reporter, error) {
+	var reporter Reporter
+	if opt.CenterUrl != "" {
+		reporter = NewCenter(opt.CenterUrl, opt.Namespace)
+	}
+	switch opt.Shard {
+	case ShardCenter:
+		return NewCenter(opt.CenterUrl, opt.Namespace), reporter, nil
+	case ShardStatic:
+		return NewStaticShard(opt.SharedNum, opt.SharedTotal), reporter, nil
+	case ShardEnv:
+		return NewEnvShard(opt.IndexEnv, opt.SharedTotal), reporter, nil
+	case ShardRedis:
+		client := redis.GetClient(opt.Redis)
+		if client == nil {
+			return nil, nil, fmt.Errorf("redis client %s not found", opt.Redis)
+		}
+		prefix := opt.Key
+		if prefix == "" {
+			prefix = "ngo:job:" + opt.Namespace
+		}
+		return NewRedisShard(client, prefix, opt.SharedTotal, opt.LeaseTTL), reporter, nil
+	case ShardZookeeper:
+		client := zookeeper.GetZkClient(opt.Zookeeper)
+		if client == nil {
+			return nil, nil, fmt.Errorf("zookeeper client %s not found", opt.Zookeeper)
+		}
+		root := opt.Key
+		if root == "" {
+			root = path.Join("/ngo/job", opt.Namespace)
+		}
+		return NewZkShard(client, root, opt.SharedTotal), reporter, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown job shard %s", opt.Shard)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httplib
+
+import (
+	"sync"
+)
+
+// Balancer 为一个服务选择实例地址，如zookeeper.Discovery
+type Balancer interface {
+	// Pick 返回host:port格式的地址
+	Pick() (string, error)
+}
+
+var (
+	targetsMu sync.RWMutex
+	targets   = make(map[string]Balancer)
+)
+
+// RegisterTarget 注册负载均衡目标，请求url的host为name时，会替换为Balancer选择的地址
+//
+//	httplib.RegisterTarget("user-service", discovery)
+//	httplib.Get("http://user-service/api/user").Do(ctx)
+func RegisterTarget(name string, b Balancer) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	targets[name] = b
+}
+
+// UnregisterTarget 删除负载均衡目标
+func UnregisterTarget(name string) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	delete(targets, name)
+}
+
+func getTarget(name string) (Balancer, bool) {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	b, ok := targets[name]
+	return b, ok
+}
+
+// resolveTarget 将url中注册的目标名称替换为实例地址
+func (df *DataFlow) resolveTarget() error {
+	uri := df.req.URI()
+	host := string(uri.Host())
+	b, ok := getTarget(host)
+	if !ok {
+		return nil
+	}
+	addr, err := b.Pick()
+	if err != nil {
+		return err
+	}
+	uri.SetHost(addr)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httplib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBalancer struct {
+	addrs []string
+	next  int
+}
+
+func (b *testBalancer) Pick() (string, error) {
+	if len(b.addrs) == 0 {
+		return "", errors.New("no instance")
+	}
+	addr := b.addrs[b.next%len(b.addrs)]
+	b.next++
+	return addr, nil
+}
+
+func TestRegisterTarget(t *testing.T) {
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + r.URL.Path))
+		}))
+	}
+	s1 := newServer("s1")
+	defer s1.Close()
+	s2 := newServer("s2")
+	defer s2.Close()
+
+	b := &testBalancer{addrs: []string{
+		strings.TrimPrefix(s1.URL, "http://"),
+		strings.TrimPrefix(s2.URL, "http://"),
+	}}
+	RegisterTarget("test-service", b)
+	defer UnregisterTarget("test-service")
+
+	c := New(&Options{})
+	var got []string
+	for i := 0; i < 2; i++ {
+		var body string
+		_, err := c.Get("http://test-service/api").BindString(&body).doInternal()
+		assert.NoError(t, err)
+		got = append(got, body)
+	}
+	assert.Equal(t, []string{"s1/api", "s2/api"}, got)
+
+	b.addrs = nil
+	_, err := c.Get("http://test-service/api").doInternal()
+	assert.EqualError(t, err, "no instance")
+}
@@ -300,6 +300,9 @@ func (df *DataFlow) doInternal() (statusCode int, err error) {
 	}
 
 	df.processRequest()
+	if err = df.resolveTarget(); err != nil {
+		return
+	}
 	res := fasthttp.AcquireResponse()
 
 	defer func() {
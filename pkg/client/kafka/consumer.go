@@ -139,6 +139,16 @@ func NewConsumer(opt *Options) (*Consumer, error) {
 	}, nil
 }
 
+// NewPartitionConsumer 使用opt的地址和安全配置创建不加入消费组的sarama消费者，
+// 适用于每个实例都需要收到全部消息的广播场景，不会在broker上留下消费组
+func NewPartitionConsumer(opt *Options) (sarama.Consumer, error) {
+	config, err := newConsumerConfig(opt)
+	if err != nil {
+		return nil, err
+	}
+	return sarama.NewConsumer(opt.Addr, config)
+}
+
 func newConsumerConfig(opt *Options) (*sarama.Config, error) {
 	config := sarama.NewConfig()
 	version, err := sarama.ParseKafkaVersion(opt.Version)
@@ -153,6 +163,9 @@ func newConsumerConfig(opt *Options) (*sarama.Config, error) {
 	config.Net.DialTimeout = opt.DialTimeout
 	config.Net.ReadTimeout = opt.ReadTimeout
 	config.Net.WriteTimeout = opt.WriteTimeout
+	if err := applySecurity(config, opt); err != nil {
+		return nil, err
+	}
 
 	config.Metadata.Retry.Max = opt.Metadata.Retries
 	config.Metadata.Timeout = opt.Metadata.Timeout
@@ -40,6 +40,8 @@ type Options struct {
 	DialTimeout     time.Duration
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
+	TLS             TLSOptions
+	SASL            SASLOptions
 	Metadata        struct {
 		Retries int
 		Timeout time.Duration
@@ -65,6 +67,7 @@ type Options struct {
 		MaxFlushMessages int
 		FlushFrequency   time.Duration
 		Idempotent       bool
+		Partitioner      string
 	}
 }
 
@@ -103,6 +106,7 @@ func NewDefaultOptions() *Options {
 	opt.Producer.MaxFlushMessages = 0
 	opt.Producer.FlushFrequency = time.Second * 1
 	opt.Producer.Idempotent = false
+	opt.Producer.Partitioner = PartitionerHash
 	return opt
 }
 
@@ -0,0 +1,123 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	PartitionerHash       = "hash"       // sarama默认的fnv-1a哈希分区
+	PartitionerMurmur2    = "murmur2"    // 与java客户端默认分区一致的murmur2哈希分区
+	PartitionerRoundRobin = "roundrobin" // 轮询分区
+	PartitionerRandom     = "random"     // 随机分区
+	PartitionerManual     = "manual"     // 使用ProducerMessage.Partition指定分区
+)
+
+// newPartitioner 根据配置名称返回sarama分区器
+func newPartitioner(name string) (sarama.PartitionerConstructor, error) {
+	switch strings.ToLower(name) {
+	case "", PartitionerHash:
+		return sarama.NewHashPartitioner, nil
+	case PartitionerMurmur2:
+		return sarama.NewCustomPartitioner(
+			sarama.WithAbsFirst(),
+			sarama.WithCustomHashFunction(newMurmur2),
+		), nil
+	case PartitionerRoundRobin:
+		return sarama.NewRoundRobinPartitioner, nil
+	case PartitionerRandom:
+		return sarama.NewRandomPartitioner, nil
+	case PartitionerManual:
+		return sarama.NewManualPartitioner, nil
+	default:
+		return nil, fmt.Errorf("unsupported kafka partitioner: %s", name)
+	}
+}
+
+const (
+	murmur2Seed = 0x9747b28c
+	murmur2M    = 0x5bd1e995
+	murmur2R    = 24
+)
+
+// murmur2 是java客户端 org.apache.kafka.common.utils.Utils#murmur2 的实现，
+// 算法需要完整的数据，因此写入时只做缓存，在Sum32时计算
+type murmur2 struct {
+	data []byte
+}
+
+func newMurmur2() hash.Hash32 {
+	return &murmur2{}
+}
+
+func (m *murmur2) Write(p []byte) (int, error) {
+	m.data = append(m.data, p...)
+	return len(p), nil
+}
+
+func (m *murmur2) Sum(b []byte) []byte {
+	h := m.Sum32()
+	return append(b, byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
+
+func (m *murmur2) Reset() {
+	m.data = m.data[:0]
+}
+
+func (m *murmur2) Size() int {
+	return 4
+}
+
+func (m *murmur2) BlockSize() int {
+	return 4
+}
+
+func (m *murmur2) Sum32() uint32 {
+	data := m.data
+	length := len(data)
+	h := uint32(murmur2Seed) ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= murmur2M
+		k ^= k >> murmur2R
+		k *= murmur2M
+		h *= murmur2M
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= murmur2M
+	}
+
+	h ^= h >> 13
+	h *= murmur2M
+	h ^= h >> 15
+	return h
+}
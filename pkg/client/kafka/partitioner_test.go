@@ -0,0 +1,88 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur2(t *testing.T) {
+	// 测试数据来自kafka java客户端的UtilsTest
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	h := newMurmur2()
+	for k, v := range cases {
+		h.Reset()
+		h.Write([]byte(k))
+		assert.Equal(t, v, int32(h.Sum32()), k)
+	}
+}
+
+func TestNewPartitioner(t *testing.T) {
+	for _, name := range []string{"", PartitionerHash, PartitionerMurmur2, "RoundRobin", PartitionerRandom, PartitionerManual} {
+		_, err := newPartitioner(name)
+		assert.NoError(t, err, name)
+	}
+	_, err := newPartitioner("sticky")
+	assert.Error(t, err)
+
+	c, _ := newPartitioner(PartitionerMurmur2)
+	p := c("test")
+	partition, err := p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("foobar")}, 10)
+	assert.NoError(t, err)
+	// (-790332482 & 0x7fffffff) % 10
+	assert.Equal(t, int32(1357151166%10), partition)
+
+	c, _ = newPartitioner(PartitionerManual)
+	partition, _ = c("test").Partition(newSaramaMessage(ProducerMessage{Partition: 3}, newMetaData()), 10)
+	assert.Equal(t, int32(3), partition)
+}
+
+// blockingProducer 是不会读取input的AsyncProducer，用于模拟缓冲区已满
+type blockingProducer struct {
+	input chan *sarama.ProducerMessage
+}
+
+func (b *blockingProducer) AsyncClose()                               {}
+func (b *blockingProducer) Close() error                              { return nil }
+func (b *blockingProducer) Input() chan<- *sarama.ProducerMessage     { return b.input }
+func (b *blockingProducer) Successes() <-chan *sarama.ProducerMessage { return nil }
+func (b *blockingProducer) Errors() <-chan *sarama.ProducerError      { return nil }
+
+func TestProducer_InputFull(t *testing.T) {
+	p := &Producer{client: &blockingProducer{input: make(chan *sarama.ProducerMessage)}}
+
+	err := p.TrySend("topic", "value", nil)
+	assert.Equal(t, ErrInputFull, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err = p.SendContext(ctx, ProducerMessage{Topic: "topic", Value: "value"}, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	err = p.SyncSendContext(ctx, ProducerMessage{Topic: "topic", Value: "value"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -15,6 +15,7 @@
 package kafka
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -23,10 +24,20 @@ import (
 	"github.com/Shopify/sarama"
 )
 
+const (
+	defaultSyncSendTimeout = time.Second * 10
+)
+
+var (
+	// ErrInputFull 表示生产者缓冲区已满，消息未能放入
+	ErrInputFull = errors.New("kafka producer input is full")
+)
+
 type ProducerMessage struct {
-	Topic string
-	Key   string
-	Value string
+	Topic     string
+	Key       string
+	Value     string
+	Partition int32 // 仅在分区器为manual时生效
 }
 
 type RecordMetadata struct {
@@ -56,20 +67,40 @@ func (p *Producer) Send(topic, value string, cb Callback) {
 	p.SendMessage(ProducerMessage{Topic: topic, Value: value}, cb)
 }
 
-// SendMessage 是异步发送接口
+// SendMessage 是异步发送接口，缓冲区已满时会阻塞
 func (p *Producer) SendMessage(message ProducerMessage, cb Callback) {
 	meta := newMetaData()
 	meta.cb = cb
-	m := &sarama.ProducerMessage{
-		Topic:    message.Topic,
-		Key:      nil,
-		Value:    sarama.StringEncoder(message.Value),
-		Metadata: meta,
+	p.client.Input() <- newSaramaMessage(message, meta)
+}
+
+// TrySend 是非阻塞的异步发送接口，缓冲区已满时返回ErrInputFull
+func (p *Producer) TrySend(topic, value string, cb Callback) error {
+	return p.TrySendMessage(ProducerMessage{Topic: topic, Value: value}, cb)
+}
+
+// TrySendMessage 是非阻塞的异步发送接口，缓冲区已满时返回ErrInputFull
+func (p *Producer) TrySendMessage(message ProducerMessage, cb Callback) error {
+	meta := newMetaData()
+	meta.cb = cb
+	select {
+	case p.client.Input() <- newSaramaMessage(message, meta):
+		return nil
+	default:
+		return ErrInputFull
 	}
-	if len(message.Key) != 0 {
-		m.Key = sarama.StringEncoder(message.Key)
+}
+
+// SendContext 是异步发送接口，缓冲区已满时阻塞直至ctx结束，返回ctx的错误
+func (p *Producer) SendContext(ctx context.Context, message ProducerMessage, cb Callback) error {
+	meta := newMetaData()
+	meta.cb = cb
+	select {
+	case p.client.Input() <- newSaramaMessage(message, meta):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	p.client.Input() <- m
 }
 
 // SyncSend 是同步发送接口。
@@ -77,28 +108,47 @@ func (p *Producer) SyncSend(topic, value string) error {
 	return p.SyncSendMessage(ProducerMessage{Topic: topic, Value: value})
 }
 
-// SyncSendMessage 是同步发送接口。
+// SyncSendMessage 是同步发送接口，最长等待10秒。
 func (p *Producer) SyncSendMessage(message ProducerMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSyncSendTimeout)
+	defer cancel()
+	return p.SyncSendContext(ctx, message)
+}
+
+// SyncSendContext 是同步发送接口，在ctx结束时停止等待并返回ctx的错误。
+// 注意消息已放入缓冲区时，返回错误并不代表消息未发送成功
+func (p *Producer) SyncSendContext(ctx context.Context, message ProducerMessage) error {
 	meta := newMetaData()
-	meta.resChan = make(chan error)
-	m := &sarama.ProducerMessage{
-		Topic:    message.Topic,
-		Key:      nil,
-		Value:    sarama.StringEncoder(message.Value),
-		Metadata: meta,
-	}
-	if len(message.Key) != 0 {
-		m.Key = sarama.StringEncoder(message.Key)
+	// 带缓冲，防止调用方超时返回后handle阻塞
+	meta.resChan = make(chan error, 1)
+
+	select {
+	case p.client.Input() <- newSaramaMessage(message, meta):
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 
-	p.client.Input() <- m
 	select {
 	case err := <-meta.resChan:
 		return err
-	case <-time.NewTimer(time.Second * 10).C:
-		// 防止异常卡死
-		return errors.New("send timeout")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newSaramaMessage 将消息转换为sarama的消息
+func newSaramaMessage(message ProducerMessage, meta *metaData) *sarama.ProducerMessage {
+	m := &sarama.ProducerMessage{
+		Topic:     message.Topic,
+		Key:       nil,
+		Value:     sarama.StringEncoder(message.Value),
+		Partition: message.Partition,
+		Metadata:  meta,
+	}
+	if len(message.Key) != 0 {
+		m.Key = sarama.StringEncoder(message.Key)
 	}
+	return m
 }
 
 // run 启动后台任务，接收结果和错误
@@ -207,6 +257,9 @@ func newProducerConfig(opt *Options) (*sarama.Config, error) {
 	config.Net.DialTimeout = opt.DialTimeout
 	config.Net.ReadTimeout = opt.ReadTimeout
 	config.Net.WriteTimeout = opt.WriteTimeout
+	if err := applySecurity(config, opt); err != nil {
+		return nil, err
+	}
 
 	config.Metadata.Retry.Max = opt.Metadata.Retries
 	config.Metadata.Timeout = opt.Metadata.Timeout
@@ -219,6 +272,11 @@ func newProducerConfig(opt *Options) (*sarama.Config, error) {
 	config.Producer.Flush.Messages = opt.Producer.MaxFlushMessages
 	config.Producer.Flush.Frequency = opt.Producer.FlushFrequency
 	config.Producer.Idempotent = opt.Producer.Idempotent
+	partitioner, err := newPartitioner(opt.Producer.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Partitioner = partitioner
 
 	return config, nil
 }
@@ -0,0 +1,147 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg/scram"
+)
+
+const (
+	SASLMechanismPlain       = sarama.SASLTypePlaintext
+	SASLMechanismSCRAMSHA256 = sarama.SASLTypeSCRAMSHA256
+	SASLMechanismSCRAMSHA512 = sarama.SASLTypeSCRAMSHA512
+)
+
+// TLSOptions 是连接kafka时的TLS配置
+type TLSOptions struct {
+	Enabled            bool
+	CAFile             string // CA证书，为空时使用系统证书
+	CertFile           string // 客户端证书，双向认证时使用
+	KeyFile            string // 客户端私钥，双向认证时使用
+	InsecureSkipVerify bool   // 跳过服务端证书校验
+}
+
+// SASLOptions 是连接kafka时的SASL认证配置
+type SASLOptions struct {
+	Enabled   bool
+	Mechanism string // 可选 PLAIN、SCRAM-SHA-256、SCRAM-SHA-512，默认为 PLAIN
+	User      string
+	Password  string
+}
+
+// applySecurity 将TLS和SASL配置应用到sarama配置中，生产者和消费者共用
+func applySecurity(config *sarama.Config, opt *Options) error {
+	if opt.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(&opt.TLS)
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if opt.SASL.Enabled {
+		if opt.SASL.User == "" || opt.SASL.Password == "" {
+			return errors.New("kafka sasl user and password must not be empty")
+		}
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Handshake = true
+		config.Net.SASL.User = opt.SASL.User
+		config.Net.SASL.Password = opt.SASL.Password
+
+		mechanism := strings.ToUpper(opt.SASL.Mechanism)
+		switch mechanism {
+		case "", SASLMechanismPlain:
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case SASLMechanismSCRAMSHA256:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hashGenerator: sha256.New}
+			}
+		case SASLMechanismSCRAMSHA512:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hashGenerator: sha512.New}
+			}
+		default:
+			return fmt.Errorf("unsupported kafka sasl mechanism: %s", opt.SASL.Mechanism)
+		}
+	}
+	return nil
+}
+
+// newTLSConfig 根据配置加载证书生成tls配置
+func newTLSConfig(opt *TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opt.InsecureSkipVerify,
+	}
+
+	if opt.CAFile != "" {
+		ca, err := ioutil.ReadFile(opt.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid kafka ca file: %s", opt.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opt.CertFile != "" || opt.KeyFile != "" {
+		if opt.CertFile == "" || opt.KeyFile == "" {
+			return nil, errors.New("kafka tls certFile and keyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// scramClient 实现了sarama.SCRAMClient接口
+type scramClient struct {
+	*scram.ClientConversation
+	hashGenerator scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGenerator.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.ClientConversation.Done()
+}
@@ -0,0 +1,75 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplySecurity_SASL(t *testing.T) {
+	opts := NewDefaultOptions()
+	opts.SASL.Enabled = true
+	opts.SASL.User = "ngo"
+	opts.SASL.Password = "secret"
+
+	config, err := newProducerConfig(opts)
+	assert.NoError(t, err)
+	assert.True(t, config.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypePlaintext), config.Net.SASL.Mechanism)
+
+	opts.SASL.Mechanism = "scram-sha-512"
+	config, err = newConsumerConfig(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.NotNil(t, config.Net.SASL.SCRAMClientGeneratorFunc)
+	client := config.Net.SASL.SCRAMClientGeneratorFunc()
+	assert.NoError(t, client.Begin("ngo", "secret", ""))
+	msg, err := client.Step("")
+	assert.NoError(t, err)
+	assert.Contains(t, msg, "n=ngo")
+	assert.False(t, client.Done())
+
+	opts.SASL.Mechanism = "GSSAPI"
+	_, err = newProducerConfig(opts)
+	assert.Error(t, err)
+
+	opts.SASL.Mechanism = SASLMechanismSCRAMSHA256
+	opts.SASL.Password = ""
+	_, err = newProducerConfig(opts)
+	assert.Error(t, err)
+}
+
+func TestApplySecurity_TLS(t *testing.T) {
+	opts := NewDefaultOptions()
+	opts.TLS.Enabled = true
+	opts.TLS.InsecureSkipVerify = true
+
+	config, err := newProducerConfig(opts)
+	assert.NoError(t, err)
+	assert.True(t, config.Net.TLS.Enable)
+	assert.True(t, config.Net.TLS.Config.InsecureSkipVerify)
+
+	opts.TLS.CAFile = "not-exist-ca.pem"
+	_, err = newConsumerConfig(opts)
+	assert.Error(t, err)
+
+	opts.TLS.CAFile = ""
+	opts.TLS.CertFile = "client.pem"
+	_, err = newConsumerConfig(opts)
+	assert.Error(t, err)
+}
@@ -20,36 +20,98 @@ import (
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 )
 
 var (
 	memcacheClients map[string]*MemcacheProxy // 用于保存所有配置的客户端
 )
 
+// Item 是memcache中的一条数据，包含flags、过期时间和CasID
+type Item = memcache.Item
+
+var (
+	ErrCacheMiss   = memcache.ErrCacheMiss   // key不存在
+	ErrCASConflict = memcache.ErrCASConflict // CompareAndSwap时数据已被修改
+	ErrNotStored   = memcache.ErrNotStored   // Add时key已存在，或Replace时key不存在
+)
+
 // Options 可配置的数据
 type Options struct {
 	Name         string        // 客户端名称，需要唯一
 	Timeout      time.Duration // 客户端连接超时时间
 	MaxIdleConns int           // 最大空闲连接
 	Addr         []string      // 集群地址
+
+	// 节点选择方式，可选modulo、ketama，默认为modulo。ketama为一致性哈希，增删节点时只迁移少量key
+	Selector string
+	// ketama每个节点的虚拟节点数，默认160
+	Replicas int
+	// 健康检查间隔，只对ketama有效，0表示不检查
+	HealthCheckInterval time.Duration
+	// 连续探测失败多少次后暂时摘除节点，默认3
+	EjectFailures int
 }
 
 // MemcacheProxy memcache 三方包的包装器类
 type MemcacheProxy struct {
-	base *memcache.Client
+	base     *memcache.Client
+	selector *KetamaSelector // 只在selector为ketama时存在
+	name     string
+	hooks    []Hook
+	metric   *metricHook
 }
 
 // NewMemcacheProxy 根据配置得到客户端
 func NewMemcacheProxy(opt *Options) *MemcacheProxy {
-	c := memcache.New(opt.Addr...)
-	c.Timeout = opt.Timeout
-	c.MaxIdleConns = opt.MaxIdleConns
 	p := &MemcacheProxy{
-		base: c,
+		name:   opt.Name,
+		metric: newMetricHook(),
 	}
+	if opt.Selector == SelectorKetama {
+		ss, err := NewKetamaSelector(opt.Replicas, opt.Addr...)
+		if err != nil {
+			// 与memcache.New一致，地址解析失败时不返回错误，使用时返回ErrNoServers
+			log.Errorf("memcache %s: resolve addr failed: %s", opt.Name, err)
+			ss, _ = NewKetamaSelector(opt.Replicas)
+		}
+		if opt.HealthCheckInterval > 0 {
+			ss.StartHealthCheck(opt.HealthCheckInterval, opt.Timeout, opt.EjectFailures)
+		}
+		p.selector = ss
+		p.base = memcache.NewFromSelector(ss)
+	} else {
+		p.base = memcache.New(opt.Addr...)
+	}
+	p.base.Timeout = opt.Timeout
+	p.base.MaxIdleConns = opt.MaxIdleConns
+	p.AddHook(p.metric)
+	p.AddHook(newTracingHook(opt.Name))
 	return p
 }
 
+// Close 停止健康检查并关闭所有空闲连接
+func (m *MemcacheProxy) Close() error {
+	if m.selector != nil {
+		m.selector.Close()
+	}
+	return m.base.Close()
+}
+
+// Ejected 返回被健康检查暂时摘除的节点
+func (m *MemcacheProxy) Ejected() []string {
+	if m.selector == nil {
+		return nil
+	}
+	return m.selector.Ejected()
+}
+
+// Stats 返回各命令的累计统计，key为命令名称
+func (m *MemcacheProxy) Stats() map[string]CmdStats {
+	return m.metric.snapshot()
+}
+
 func Init(opts []Options) (err error) {
 	if memcacheClients != nil {
 		panic("memcache client has initialed, you should not initial it again!")
@@ -90,6 +152,12 @@ func newClientFromOption(opts []Options) (map[string]*MemcacheProxy, error) {
 		if len(opt.Addr) == 0 {
 			return nil, errors.New("memcache addr can not be empty!")
 		}
+
+		switch opt.Selector {
+		case "", SelectorModulo, SelectorKetama:
+		default:
+			return nil, fmt.Errorf("unknown memcache selector %s", opt.Selector)
+		}
 		cs[opt.Name] = NewMemcacheProxy(opt)
 	}
 	return cs, nil
@@ -0,0 +1,91 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"context"
+)
+
+// Cmd 是一次memcache命令，供Hook使用
+type Cmd struct {
+	Name string   // 命令名称，如get、set、cas
+	Keys []string // 命令涉及的key
+	Err  error    // 命令执行结果，AfterProcess中可用
+}
+
+// Hook 与redis.Hook类似，在每次命令执行前后调用
+type Hook interface {
+	BeforeProcess(ctx context.Context, cmd *Cmd) (context.Context, error)
+	AfterProcess(ctx context.Context, cmd *Cmd) error
+}
+
+// AddHook 添加Hook，需要在使用客户端之前调用
+func (m *MemcacheProxy) AddHook(hook Hook) {
+	m.hooks = append(m.hooks, hook)
+}
+
+// process 依次执行BeforeProcess、命令和AfterProcess，AfterProcess按相反顺序执行
+func (m *MemcacheProxy) process(ctx context.Context, cmd *Cmd, fn func() (interface{}, error)) (interface{}, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var ret interface{}
+	n := 0
+	for _, h := range m.hooks {
+		c, err := h.BeforeProcess(ctx, cmd)
+		if err != nil {
+			cmd.Err = err
+			break
+		}
+		ctx = c
+		n++
+	}
+	if cmd.Err == nil {
+		ret, cmd.Err = do(ctx, fn)
+	}
+	for i := n - 1; i >= 0; i-- {
+		if err := m.hooks[i].AfterProcess(ctx, cmd); err != nil {
+			cmd.Err = err
+		}
+	}
+	return ret, cmd.Err
+}
+
+// do 执行命令，gomemcache不支持context，ctx结束时直接返回，命令在后台继续执行完成
+func do(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	type result struct {
+		ret interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ret, err := fn()
+		done <- result{ret, err}
+	}()
+	select {
+	case r := <-done:
+		return r.ret, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHook struct {
+	before func(cmd *Cmd) error
+	cmds   []Cmd
+}
+
+func (h *testHook) BeforeProcess(ctx context.Context, cmd *Cmd) (context.Context, error) {
+	if h.before != nil {
+		return ctx, h.before(cmd)
+	}
+	return ctx, nil
+}
+
+func (h *testHook) AfterProcess(ctx context.Context, cmd *Cmd) error {
+	h.cmds = append(h.cmds, *cmd)
+	return nil
+}
+
+func TestHook(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	c := NewMemcacheProxy(&Options{Name: "fake", Addr: []string{s.Addr()}})
+	defer c.Close()
+
+	h := &testHook{}
+	c.AddHook(h)
+	assert.NoError(t, c.Set("k1", "v1"))
+	_, err := c.Get("k2")
+	assert.Equal(t, ErrCacheMiss, err)
+	assert.Equal(t, []Cmd{
+		{Name: "set", Keys: []string{"k1"}},
+		{Name: "get", Keys: []string{"k2"}, Err: ErrCacheMiss},
+	}, h.cmds)
+
+	// BeforeProcess 返回错误时不执行命令
+	reject := errors.New("rejected")
+	h.before = func(cmd *Cmd) error { return reject }
+	assert.Equal(t, reject, c.Set("k1", "v2"))
+	h.before = nil
+	v, _ := c.Get("k1")
+	assert.Equal(t, "v1", v)
+}
+
+func TestTracingHook(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	s := newFakeServer(t)
+	defer s.Close()
+	c := NewMemcacheProxy(&Options{Name: "fake", Addr: []string{s.Addr()}})
+	defer c.Close()
+
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	assert.NoError(t, c.SetContext(ctx, "k1", "v1"))
+	_, err := c.IncrementContext(ctx, "k1", 1)
+	assert.Error(t, err)
+	parent.Finish()
+
+	spans := tracer.FinishedSpans()
+	assert.Equal(t, 3, len(spans))
+	assert.Equal(t, "memcache.set", spans[0].OperationName)
+	assert.Equal(t, "memcache", spans[0].Tag("db.type"))
+	assert.Equal(t, "set k1", spans[0].Tag("db.statement"))
+	assert.Nil(t, spans[0].Tag("error"))
+	assert.Equal(t, "memcache.incr", spans[1].OperationName)
+	assert.Equal(t, true, spans[1].Tag("error"))
+	assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, spans[1].ParentID)
+}
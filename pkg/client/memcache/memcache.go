@@ -15,12 +15,19 @@
 package memcache
 
 import (
+	"context"
+
 	"github.com/bradfitz/gomemcache/memcache"
 )
 
 // Get 根据Key获取缓存数值
 func (m *MemcacheProxy) Get(key string) (string, error) {
-	item, err := m.base.Get(key)
+	return m.GetContext(context.Background(), key)
+}
+
+// GetContext 根据Key获取缓存数值
+func (m *MemcacheProxy) GetContext(ctx context.Context, key string) (string, error) {
+	item, err := m.GetItemContext(ctx, key)
 	if err != nil {
 		return "", err
 	}
@@ -29,9 +36,12 @@ func (m *MemcacheProxy) Get(key string) (string, error) {
 
 // MGet 获取多个数值
 func (m *MemcacheProxy) MGet(keys []string) (map[string]string, error) {
-	//缓存是否命中。针对修改类操作，如set，hits总是为true
-	var hits bool
-	rets, err := m.base.GetMulti(keys)
+	return m.MGetContext(context.Background(), keys)
+}
+
+// MGetContext 获取多个数值，不存在的key不在结果中
+func (m *MemcacheProxy) MGetContext(ctx context.Context, keys []string) (map[string]string, error) {
+	rets, err := m.GetItemsContext(ctx, keys)
 	if err != nil {
 		return nil, err
 	}
@@ -42,9 +52,6 @@ func (m *MemcacheProxy) MGet(keys []string) (map[string]string, error) {
 
 	r := make(map[string]string, len(rets))
 	for _, v := range rets {
-		if !hits {
-			hits = v != nil && len(v.Value) > 0
-		}
 		r[v.Key] = string(v.Value)
 	}
 	return r, nil
@@ -52,28 +59,162 @@ func (m *MemcacheProxy) MGet(keys []string) (map[string]string, error) {
 
 // Set 设置缓存
 func (m *MemcacheProxy) Set(key string, value string) error {
-	item := memcache.Item{
-		Key:   key,
-		Value: []byte(value),
-	}
-	err := m.base.Set(&item)
-	return err
+	return m.SetWithExpire(key, value, 0)
+}
+
+// SetContext 设置缓存
+func (m *MemcacheProxy) SetContext(ctx context.Context, key string, value string) error {
+	return m.SetWithExpireContext(ctx, key, value, 0)
 }
 
 // SetWithExpire 设置缓存，并且添加超时
 // expire 以s为单位
 func (m *MemcacheProxy) SetWithExpire(key string, value string, expire int) error {
-	item := memcache.Item{
+	return m.SetWithExpireContext(context.Background(), key, value, expire)
+}
+
+// SetWithExpireContext 设置缓存，并且添加超时
+// expire 以s为单位
+func (m *MemcacheProxy) SetWithExpireContext(ctx context.Context, key string, value string, expire int) error {
+	return m.SetItemContext(ctx, &Item{
 		Key:        key,
 		Value:      []byte(value),
 		Expiration: int32(expire),
-	}
-	err := m.base.Set(&item)
-	return err
+	})
 }
 
 // Delete 删除操作
 func (m *MemcacheProxy) Delete(key string) error {
-	err := m.base.Delete(key)
+	return m.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext 删除操作，key不存在时返回ErrCacheMiss
+func (m *MemcacheProxy) DeleteContext(ctx context.Context, key string) error {
+	_, err := m.process(ctx, &Cmd{Name: "delete", Keys: []string{key}}, func() (interface{}, error) {
+		return nil, m.base.Delete(key)
+	})
+	return err
+}
+
+// GetItem 获取完整的数据，包括[]byte类型的值、flags和CasID
+func (m *MemcacheProxy) GetItem(key string) (*Item, error) {
+	return m.GetItemContext(context.Background(), key)
+}
+
+// GetItemContext 获取完整的数据，包括[]byte类型的值、flags和CasID
+func (m *MemcacheProxy) GetItemContext(ctx context.Context, key string) (*Item, error) {
+	ret, err := m.process(ctx, &Cmd{Name: "get", Keys: []string{key}}, func() (interface{}, error) {
+		return m.base.Get(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret.(*Item), nil
+}
+
+// GetItems 批量获取完整的数据
+func (m *MemcacheProxy) GetItems(keys []string) (map[string]*Item, error) {
+	return m.GetItemsContext(context.Background(), keys)
+}
+
+// GetItemsContext 批量获取完整的数据，不存在的key不在结果中
+func (m *MemcacheProxy) GetItemsContext(ctx context.Context, keys []string) (map[string]*Item, error) {
+	ret, err := m.process(ctx, &Cmd{Name: "mget", Keys: keys}, func() (interface{}, error) {
+		return m.base.GetMulti(keys)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret.(map[string]*Item), nil
+}
+
+// SetItem 无条件写入数据
+func (m *MemcacheProxy) SetItem(item *Item) error {
+	return m.SetItemContext(context.Background(), item)
+}
+
+// SetItemContext 无条件写入数据
+func (m *MemcacheProxy) SetItemContext(ctx context.Context, item *Item) error {
+	return m.store(ctx, "set", item, m.base.Set)
+}
+
+// Add 仅在key不存在时写入，否则返回ErrNotStored
+func (m *MemcacheProxy) Add(item *Item) error {
+	return m.AddContext(context.Background(), item)
+}
+
+// AddContext 仅在key不存在时写入，否则返回ErrNotStored
+func (m *MemcacheProxy) AddContext(ctx context.Context, item *Item) error {
+	return m.store(ctx, "add", item, m.base.Add)
+}
+
+// Replace 仅在key存在时写入，否则返回ErrNotStored
+func (m *MemcacheProxy) Replace(item *Item) error {
+	return m.ReplaceContext(context.Background(), item)
+}
+
+// ReplaceContext 仅在key存在时写入，否则返回ErrNotStored
+func (m *MemcacheProxy) ReplaceContext(ctx context.Context, item *Item) error {
+	return m.store(ctx, "replace", item, m.base.Replace)
+}
+
+// CompareAndSwap 仅在数据未被修改时写入，item一般来自GetItem，并以其CasID作为比较依据。
+// 数据已被修改时返回ErrCASConflict，已被删除时返回ErrCacheMiss
+func (m *MemcacheProxy) CompareAndSwap(item *Item) error {
+	return m.CompareAndSwapContext(context.Background(), item)
+}
+
+// CompareAndSwapContext 见CompareAndSwap
+func (m *MemcacheProxy) CompareAndSwapContext(ctx context.Context, item *Item) error {
+	return m.store(ctx, "cas", item, m.base.CompareAndSwap)
+}
+
+func (m *MemcacheProxy) store(ctx context.Context, name string, item *Item, fn func(*memcache.Item) error) error {
+	_, err := m.process(ctx, &Cmd{Name: name, Keys: []string{item.Key}}, func() (interface{}, error) {
+		return nil, fn(item)
+	})
+	return err
+}
+
+// Increment 原子增加数值并返回新值，key不存在时返回ErrCacheMiss，值必须为十进制数字
+func (m *MemcacheProxy) Increment(key string, delta uint64) (uint64, error) {
+	return m.IncrementContext(context.Background(), key, delta)
+}
+
+// IncrementContext 见Increment
+func (m *MemcacheProxy) IncrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return m.incrDecr(ctx, "incr", key, delta, m.base.Increment)
+}
+
+// Decrement 原子减少数值并返回新值，结果最小为0
+func (m *MemcacheProxy) Decrement(key string, delta uint64) (uint64, error) {
+	return m.DecrementContext(context.Background(), key, delta)
+}
+
+// DecrementContext 见Decrement
+func (m *MemcacheProxy) DecrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return m.incrDecr(ctx, "decr", key, delta, m.base.Decrement)
+}
+
+func (m *MemcacheProxy) incrDecr(ctx context.Context, name, key string, delta uint64, fn func(string, uint64) (uint64, error)) (uint64, error) {
+	ret, err := m.process(ctx, &Cmd{Name: name, Keys: []string{key}}, func() (interface{}, error) {
+		return fn(key, delta)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ret.(uint64), nil
+}
+
+// Touch 更新过期时间而不读取数据，seconds 以s为单位，key不存在时返回ErrCacheMiss
+func (m *MemcacheProxy) Touch(key string, seconds int32) error {
+	return m.TouchContext(context.Background(), key, seconds)
+}
+
+// TouchContext 见Touch
+func (m *MemcacheProxy) TouchContext(ctx context.Context, key string, seconds int32) error {
+	_, err := m.process(ctx, &Cmd{Name: "touch", Keys: []string{key}}, func() (interface{}, error) {
+		return nil, m.base.Touch(key, seconds)
+	})
 	return err
 }
@@ -15,7 +15,16 @@
 package memcache
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -76,3 +85,288 @@ func TestCRUD(t *testing.T) {
 	assert.Equal(t, nil, err, "err.")
 	assert.Equal(t, 0, len(m), "delete failed")
 }
+
+func TestItemOperations(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	c := NewMemcacheProxy(&Options{Name: "fake", Addr: []string{s.Addr()}})
+	defer c.Close()
+
+	// flags 与 []byte 值
+	assert.NoError(t, c.SetItem(&Item{Key: "k1", Value: []byte{0, 1, 2}, Flags: 7}))
+	item, err := c.GetItem("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, item.Value)
+	assert.Equal(t, uint32(7), item.Flags)
+
+	// Add/Replace
+	assert.Equal(t, ErrNotStored, c.Add(&Item{Key: "k1", Value: []byte("v")}))
+	assert.NoError(t, c.Add(&Item{Key: "k2", Value: []byte("v2")}))
+	assert.Equal(t, ErrNotStored, c.Replace(&Item{Key: "k3", Value: []byte("v")}))
+	assert.NoError(t, c.Replace(&Item{Key: "k2", Value: []byte("v2-1")}))
+	v, err := c.Get("k2")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2-1", v)
+
+	// CompareAndSwap
+	item, err = c.GetItem("k2")
+	assert.NoError(t, err)
+	stale := *item
+	item.Value = []byte("v2-2")
+	assert.NoError(t, c.CompareAndSwap(item))
+	stale.Value = []byte("v2-3")
+	assert.Equal(t, ErrCASConflict, c.CompareAndSwap(&stale))
+	v, _ = c.Get("k2")
+	assert.Equal(t, "v2-2", v)
+	assert.NoError(t, c.Delete("k2"))
+	assert.Equal(t, ErrCacheMiss, c.CompareAndSwap(item))
+
+	// Increment/Decrement
+	assert.NoError(t, c.Set("n", "10"))
+	n, err := c.Increment("n", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(15), n)
+	n, err = c.Decrement("n", 20)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), n)
+	_, err = c.Increment("missing", 1)
+	assert.Equal(t, ErrCacheMiss, err)
+
+	// Touch
+	assert.NoError(t, c.Touch("n", 100))
+	assert.Equal(t, int32(100), s.expiration("n"))
+	assert.Equal(t, ErrCacheMiss, c.Touch("missing", 100))
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(3), stats["cas"].Calls)
+	assert.Equal(t, uint64(1), stats["cas"].Errors)
+	assert.Equal(t, uint64(1), stats["cas"].Misses)
+	assert.Equal(t, uint64(1), stats["touch"].Misses)
+}
+
+func TestContext(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	c := NewMemcacheProxy(&Options{Name: "fake", Addr: []string{s.Addr()}})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, c.SetContext(ctx, "k1", "v1"))
+	v, err := c.GetContext(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	cancel()
+	_, err = c.GetContext(ctx, "k1")
+	assert.Equal(t, context.Canceled, err)
+
+	// 服务端无响应时按ctx超时返回
+	s.block()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = c.GetContext(ctx, "k1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+// fakeServer 是内存中的memcache文本协议服务端，仅用于测试
+type fakeServer struct {
+	t       *testing.T
+	l       net.Listener
+	mu      sync.Mutex
+	items   map[string]*fakeItem
+	cas     uint64
+	blocked chan struct{}
+}
+
+type fakeItem struct {
+	value      []byte
+	flags      uint32
+	expiration int32
+	cas        uint64
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	return newFakeServerAt(t, "127.0.0.1:0")
+}
+
+func newFakeServerAt(t *testing.T, addr string) *fakeServer {
+	l, err := net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	s := &fakeServer{t: t, l: l, items: make(map[string]*fakeItem)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) Addr() string {
+	return s.l.Addr().String()
+}
+
+func (s *fakeServer) Close() {
+	s.l.Close()
+	s.mu.Lock()
+	if s.blocked != nil {
+		close(s.blocked)
+		s.blocked = nil
+	}
+	s.mu.Unlock()
+}
+
+// block 使服务端不再响应，直至Close
+func (s *fakeServer) block() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked = make(chan struct{})
+}
+
+func (s *fakeServer) expiration(key string) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if it, ok := s.items[key]; ok {
+		return it.expiration
+	}
+	return 0
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		blocked := s.blocked
+		s.mu.Unlock()
+		if blocked != nil {
+			<-blocked
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		var resp string
+		switch args[0] {
+		case "get", "gets":
+			resp = s.get(args[1:])
+		case "set", "add", "replace", "cas":
+			size, _ := strconv.Atoi(args[4])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			resp = s.store(args, data[:size])
+		case "incr", "decr":
+			resp = s.incrDecr(args)
+		case "touch":
+			resp = s.touch(args)
+		case "delete":
+			resp = s.delete(args[1])
+		case "version":
+			resp = "VERSION 1.6.0-fake\r\n"
+		default:
+			resp = "ERROR\r\n"
+		}
+		if _, err := io.WriteString(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) get(keys []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	for _, key := range keys {
+		if it, ok := s.items[key]; ok {
+			fmt.Fprintf(&b, "VALUE %s %d %d %d\r\n%s\r\n", key, it.flags, len(it.value), it.cas, it.value)
+		}
+	}
+	b.WriteString("END\r\n")
+	return b.String()
+}
+
+func (s *fakeServer) store(args []string, value []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := args[1]
+	flags, _ := strconv.ParseUint(args[2], 10, 32)
+	exp, _ := strconv.ParseInt(args[3], 10, 32)
+	old, exists := s.items[key]
+	switch args[0] {
+	case "add":
+		if exists {
+			return "NOT_STORED\r\n"
+		}
+	case "replace":
+		if !exists {
+			return "NOT_STORED\r\n"
+		}
+	case "cas":
+		if !exists {
+			return "NOT_FOUND\r\n"
+		}
+		if cas, _ := strconv.ParseUint(args[5], 10, 64); cas != old.cas {
+			return "EXISTS\r\n"
+		}
+	}
+	s.cas++
+	s.items[key] = &fakeItem{value: value, flags: uint32(flags), expiration: int32(exp), cas: s.cas}
+	return "STORED\r\n"
+}
+
+func (s *fakeServer) incrDecr(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[args[1]]
+	if !ok {
+		return "NOT_FOUND\r\n"
+	}
+	n, err := strconv.ParseUint(string(it.value), 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+	}
+	delta, _ := strconv.ParseUint(args[2], 10, 64)
+	if args[0] == "incr" {
+		n += delta
+	} else if delta > n {
+		n = 0
+	} else {
+		n -= delta
+	}
+	s.cas++
+	it.value = []byte(strconv.FormatUint(n, 10))
+	it.cas = s.cas
+	return string(it.value) + "\r\n"
+}
+
+func (s *fakeServer) touch(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[args[1]]
+	if !ok {
+		return "NOT_FOUND\r\n"
+	}
+	exp, _ := strconv.ParseInt(args[2], 10, 32)
+	it.expiration = int32(exp)
+	return "TOUCHED\r\n"
+}
+
+func (s *fakeServer) delete(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[key]; !ok {
+		return "NOT_FOUND\r\n"
+	}
+	delete(s.items, key)
+	return "DELETED\r\n"
+}
@@ -0,0 +1,86 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+type memcacheMetricKey string
+
+const keyRequestStart memcacheMetricKey = "requestStart"
+
+var _ Hook = &metricHook{}
+
+// CmdStats 是一种命令的累计统计
+type CmdStats struct {
+	Calls    uint64        `json:"calls"`
+	Errors   uint64        `json:"errors"` // 不包含未命中
+	Misses   uint64        `json:"misses"`
+	Duration time.Duration `json:"duration"` // 累计耗时
+}
+
+type metricHook struct {
+	mu    sync.Mutex
+	stats map[string]*CmdStats
+}
+
+func newMetricHook() *metricHook {
+	return &metricHook{stats: make(map[string]*CmdStats, 16)}
+}
+
+func (h *metricHook) BeforeProcess(ctx context.Context, cmd *Cmd) (context.Context, error) {
+	return context.WithValue(ctx, keyRequestStart, time.Now()), nil
+}
+
+func (h *metricHook) AfterProcess(ctx context.Context, cmd *Cmd) error {
+	start, ok := ctx.Value(keyRequestStart).(time.Time)
+	if !ok {
+		return nil
+	}
+	cost := time.Since(start)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.stats[cmd.Name]
+	if !ok {
+		s = &CmdStats{}
+		h.stats[cmd.Name] = s
+	}
+	s.Calls++
+	s.Duration += cost
+	switch cmd.Err {
+	case nil:
+	case memcache.ErrCacheMiss:
+		s.Misses++
+	default:
+		s.Errors++
+	}
+	return nil
+}
+
+func (h *metricHook) snapshot() map[string]CmdStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ret := make(map[string]CmdStats, len(h.stats))
+	for name, s := range h.stats {
+		ret[name] = *s
+	}
+	return ret
+}
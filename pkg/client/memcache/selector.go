@@ -0,0 +1,289 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/util"
+)
+
+const (
+	SelectorModulo = "modulo" // gomemcache默认的取模选择
+	SelectorKetama = "ketama" // 一致性哈希
+
+	defaultReplicas      = 160
+	defaultEjectFailures = 3
+	defaultProbeTimeout  = time.Millisecond * 500
+)
+
+// ServerSelector 根据key选择memcache节点，与gomemcache的ServerSelector相同
+type ServerSelector = memcache.ServerSelector
+
+type ketamaPoint struct {
+	hash uint64
+	addr net.Addr
+}
+
+// KetamaSelector 是ketama风格的一致性哈希节点选择器。
+// 增删节点时只有相邻区间的key会迁移，开启健康检查后，连续失败的节点会被暂时摘除，恢复后重新加入
+type KetamaSelector struct {
+	mu       sync.RWMutex
+	replicas int
+	servers  []string
+	addrs    map[string]net.Addr
+	ejected  map[string]bool
+	failures map[string]int
+	ring     []ketamaPoint
+
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// NewKetamaSelector 创建一致性哈希选择器，replicas 为每个节点的虚拟节点数，<=0时为160
+func NewKetamaSelector(replicas int, servers ...string) (*KetamaSelector, error) {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	s := &KetamaSelector{replicas: replicas}
+	if err := s.SetServers(servers...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetServers 替换节点列表，节点的健康状态会被重置
+func (s *KetamaSelector) SetServers(servers ...string) error {
+	addrs := make(map[string]net.Addr, len(servers))
+	for _, server := range servers {
+		addr, err := resolveAddr(server)
+		if err != nil {
+			return err
+		}
+		addrs[server] = addr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers = append([]string(nil), servers...)
+	s.addrs = addrs
+	s.ejected = make(map[string]bool)
+	s.failures = make(map[string]int)
+	s.rebuild()
+	return nil
+}
+
+// PickServer 返回key所在的节点
+func (s *KetamaSelector) PickServer(key string) (net.Addr, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.ring) == 0 {
+		return nil, memcache.ErrNoServers
+	}
+	h := uint64(util.MurmurHashString(key))
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= h
+	})
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].addr, nil
+}
+
+// Each 遍历所有未被摘除的节点
+func (s *KetamaSelector) Each(f func(net.Addr) error) error {
+	s.mu.RLock()
+	addrs := make([]net.Addr, 0, len(s.servers))
+	for _, server := range s.servers {
+		if !s.ejected[server] {
+			addrs = append(addrs, s.addrs[server])
+		}
+	}
+	s.mu.RUnlock()
+	for _, addr := range addrs {
+		if err := f(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ejected 返回当前被摘除的节点
+func (s *KetamaSelector) Ejected() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ret := make([]string, 0, len(s.ejected))
+	for _, server := range s.servers {
+		if s.ejected[server] {
+			ret = append(ret, server)
+		}
+	}
+	return ret
+}
+
+// StartHealthCheck 按interval探测所有节点，连续失败failures次的节点会被摘除，探测成功后恢复
+func (s *KetamaSelector) StartHealthCheck(interval, timeout time.Duration, failures int) {
+	if s.cancel != nil {
+		panic("duplicated health check")
+	}
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	if failures <= 0 {
+		failures = defaultEjectFailures
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.check(timeout, failures)
+			}
+		}
+	}()
+}
+
+// Close 停止健康检查
+func (s *KetamaSelector) Close() {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+}
+
+func (s *KetamaSelector) check(timeout time.Duration, failures int) {
+	s.mu.RLock()
+	addrs := make(map[string]net.Addr, len(s.addrs))
+	for server, addr := range s.addrs {
+		addrs[server] = addr
+	}
+	s.mu.RUnlock()
+
+	results := make(map[string]error, len(addrs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for server, addr := range addrs {
+		wg.Add(1)
+		go func(server string, addr net.Addr) {
+			defer wg.Done()
+			err := probe(addr, timeout)
+			mu.Lock()
+			results[server] = err
+			mu.Unlock()
+		}(server, addr)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for server, err := range results {
+		if _, ok := s.addrs[server]; !ok {
+			continue // 检查期间节点已被移除
+		}
+		if err == nil {
+			s.failures[server] = 0
+			if s.ejected[server] {
+				log.Infof("memcache: server %s recovered", server)
+				delete(s.ejected, server)
+				changed = true
+			}
+			continue
+		}
+		s.failures[server]++
+		if !s.ejected[server] && s.failures[server] >= failures {
+			log.Warnf("memcache: eject server %s after %d failures: %s", server, s.failures[server], err)
+			s.ejected[server] = true
+			changed = true
+		}
+	}
+	if changed {
+		s.rebuild()
+	}
+}
+
+// rebuild 用未被摘除的节点重建哈希环，所有节点都被摘除时使用全部节点，需持有写锁
+func (s *KetamaSelector) rebuild() {
+	servers := make([]string, 0, len(s.servers))
+	for _, server := range s.servers {
+		if !s.ejected[server] {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		servers = s.servers
+	}
+
+	ring := make([]ketamaPoint, 0, len(servers)*s.replicas)
+	for _, server := range servers {
+		for i := 0; i < s.replicas; i++ {
+			ring = append(ring, ketamaPoint{
+				hash: uint64(util.MurmurHashString(server + "-" + strconv.Itoa(i))),
+				addr: s.addrs[server],
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	s.ring = ring
+}
+
+// probe 发送version命令检查节点是否可用
+func probe(addr net.Addr, timeout time.Duration) error {
+	conn, err := net.DialTimeout(addr.Network(), addr.String(), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte("version\r\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "VERSION") {
+		return memcache.ErrServerError
+	}
+	return nil
+}
+
+func resolveAddr(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		return net.ResolveUnixAddr("unix", server)
+	}
+	return net.ResolveTCPAddr("tcp", server)
+}
@@ -0,0 +1,116 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pickAll(t *testing.T, s *KetamaSelector, n int) map[string]string {
+	ret := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		addr, err := s.PickServer(key)
+		assert.NoError(t, err)
+		ret[key] = addr.String()
+	}
+	return ret
+}
+
+func TestKetamaSelector(t *testing.T) {
+	const n = 10000
+	s, err := NewKetamaSelector(0, "127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213")
+	assert.NoError(t, err)
+	before := pickAll(t, s, n)
+
+	// 分布大致均匀
+	counts := make(map[string]int)
+	for _, addr := range before {
+		counts[addr]++
+	}
+	assert.Equal(t, 3, len(counts))
+	for _, c := range counts {
+		assert.InDelta(t, n/3, c, n/10)
+	}
+
+	// 增加节点后只有少量key迁移，且都迁移到新节点
+	assert.NoError(t, s.SetServers("127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213", "127.0.0.1:11214"))
+	after := pickAll(t, s, n)
+	moved := 0
+	for key, addr := range after {
+		if addr != before[key] {
+			moved++
+			assert.Equal(t, "127.0.0.1:11214", addr)
+		}
+	}
+	assert.InDelta(t, n/4, moved, n/10)
+
+	s, err = NewKetamaSelector(0)
+	assert.NoError(t, err)
+	_, err = s.PickServer("k")
+	assert.Equal(t, "memcache: no servers configured or available", err.Error())
+}
+
+func TestKetamaSelector_HealthCheck(t *testing.T) {
+	s1 := newFakeServer(t)
+	defer s1.Close()
+	s2 := newFakeServer(t)
+	addr2 := s2.Addr()
+
+	c := NewMemcacheProxy(&Options{
+		Name:                "ketama",
+		Addr:                []string{s1.Addr(), addr2},
+		Timeout:             time.Millisecond * 100,
+		Selector:            SelectorKetama,
+		HealthCheckInterval: time.Millisecond * 20,
+		EjectFailures:       2,
+	})
+	defer c.Close()
+	before := pickAll(t, c.selector, 1000)
+
+	// 节点故障后被摘除，原本属于它的key由其他节点接管
+	s2.Close()
+	assert.Eventually(t, func() bool {
+		return len(c.Ejected()) == 1
+	}, time.Second*2, time.Millisecond*10)
+	assert.Equal(t, []string{addr2}, c.Ejected())
+	for key, addr := range pickAll(t, c.selector, 1000) {
+		assert.Equal(t, s1.Addr(), addr)
+		if before[key] == s1.Addr() {
+			assert.Equal(t, before[key], addr)
+		}
+	}
+	assert.NoError(t, c.Set("k1", "v1"))
+
+	// 节点恢复后重新加入
+	s2 = newFakeServerAt(t, addr2)
+	defer s2.Close()
+	assert.Eventually(t, func() bool {
+		return len(c.Ejected()) == 0
+	}, time.Second*2, time.Millisecond*10)
+	assert.Equal(t, before, pickAll(t, c.selector, 1000))
+}
+
+func TestNewClientFromOption_Selector(t *testing.T) {
+	_, err := newClientFromOption([]Options{{Name: "m1", Addr: []string{"127.0.0.1:11211"}, Selector: "unknown"}})
+	assert.Error(t, err)
+	cs, err := newClientFromOption([]Options{{Name: "m1", Addr: []string{"127.0.0.1:11211"}, Selector: SelectorKetama}})
+	assert.NoError(t, err)
+	assert.NotNil(t, cs["m1"].selector)
+}
@@ -0,0 +1,56 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+var _ Hook = &tracingHook{}
+
+type tracingHook struct {
+	name string
+}
+
+func newTracingHook(name string) *tracingHook {
+	return &tracingHook{name: name}
+}
+
+func (th *tracingHook) BeforeProcess(ctx context.Context, cmd *Cmd) (context.Context, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memcache."+cmd.Name, ext.SpanKindRPCClient)
+	ext.DBType.Set(span, "memcache")
+	ext.DBInstance.Set(span, th.name)
+	ext.DBStatement.Set(span, cmd.Name+" "+strings.Join(cmd.Keys, " "))
+	return ctx, nil
+}
+
+func (th *tracingHook) AfterProcess(ctx context.Context, cmd *Cmd) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	// 未命中不视为错误
+	if cmd.Err != nil && cmd.Err != memcache.ErrCacheMiss {
+		ext.Error.Set(span, true)
+		span.SetTag("error.message", cmd.Err.Error())
+	}
+	span.Finish()
+	return nil
+}
@@ -0,0 +1,264 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	redisV8 "github.com/go-redis/redis/v8"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/client/kafka"
+	"github.com/NetEase-Media/ngo/pkg/client/redis"
+)
+
+const (
+	BusRedis = "redis"
+	BusKafka = "kafka"
+
+	defaultBusChannel = "ngo:multicache:invalidate"
+)
+
+// InvalidationBus 在实例之间广播本地缓存失效消息
+type InvalidationBus interface {
+	Publish(msg []byte) error
+	Subscribe(handler func(msg []byte)) error
+	Close() error
+}
+
+// invalidation 是广播的失效消息
+type invalidation struct {
+	Source string   `json:"source"`
+	Keys   []string `json:"keys,omitempty"`
+	Clear  bool     `json:"clear,omitempty"`
+}
+
+// SetBus 设置失效广播，写入、删除和清空操作会通知其他实例删除本地缓存
+func (m *Miner) SetBus(bus InvalidationBus) error {
+	m.busMu.Lock()
+	defer m.busMu.Unlock()
+	if m.bus != nil {
+		return errors.New("duplicated invalidation bus")
+	}
+	hostname, _ := os.Hostname()
+	m.busID = fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), rand.Int63())
+	if err := bus.Subscribe(m.onInvalidate); err != nil {
+		return err
+	}
+	m.bus = bus
+	return nil
+}
+
+// CloseBus 关闭失效广播
+func (m *Miner) CloseBus() error {
+	m.busMu.Lock()
+	bus := m.bus
+	m.bus = nil
+	m.busMu.Unlock()
+	if bus == nil {
+		return nil
+	}
+	return bus.Close()
+}
+
+// StopAll 关闭所有Miner的失效广播，需要在关闭redis和kafka客户端之前调用
+func StopAll() {
+	for name, m := range miners {
+		if err := m.CloseBus(); err != nil {
+			log.Errorf("multicache: close invalidation bus of %s failed: %s", name, err)
+		}
+	}
+}
+
+func (m *Miner) publish(msg invalidation) {
+	m.busMu.RLock()
+	bus, id := m.bus, m.busID
+	m.busMu.RUnlock()
+	if bus == nil {
+		return
+	}
+	msg.Source = id
+	data, err := json.Marshal(&msg)
+	if err != nil {
+		log.Errorf("multicache: marshal invalidation failed: %s", err)
+		return
+	}
+	if err := bus.Publish(data); err != nil {
+		log.Errorf("multicache: publish invalidation failed: %s", err)
+	}
+}
+
+func (m *Miner) publishKeys(keys ...string) {
+	m.publish(invalidation{Keys: keys})
+}
+
+// onInvalidate 删除本地级别的缓存，忽略自己发出的消息
+func (m *Miner) onInvalidate(data []byte) {
+	var msg invalidation
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Errorf("multicache: invalid invalidation message %q: %s", data, err)
+		return
+	}
+	m.busMu.RLock()
+	id := m.busID
+	m.busMu.RUnlock()
+	if msg.Source == id {
+		return
+	}
+	for _, h := range m.handersR {
+		l, ok := h.(*LocalMiner)
+		if !ok {
+			continue
+		}
+		if msg.Clear {
+			l.Clear()
+			continue
+		}
+		for _, key := range msg.Keys {
+			l.Evict(key)
+		}
+	}
+}
+
+// redisBus 使用redis pub/sub广播，不支持sharded_sentinel类型的客户端
+type redisBus struct {
+	client  redis.Redis
+	channel string
+	pubsub  *redisV8.PubSub
+	done    chan struct{}
+}
+
+// NewRedisBus 创建基于redis pub/sub的失效广播，channel为空时使用默认频道
+func NewRedisBus(client redis.Redis, channel string) (InvalidationBus, error) {
+	if client == nil {
+		return nil, errors.New("redis client must not be nil")
+	}
+	if !redis.SupportsPubSub(client) {
+		return nil, errors.New("redis client does not support pub/sub")
+	}
+	if channel == "" {
+		channel = defaultBusChannel
+	}
+	return &redisBus{client: client, channel: channel}, nil
+}
+
+func (b *redisBus) Publish(msg []byte) error {
+	return b.client.Publish(context.Background(), b.channel, msg).Err()
+}
+
+func (b *redisBus) Subscribe(handler func(msg []byte)) error {
+	ctx := context.Background()
+	pubsub, err := redis.Subscribe(ctx, b.client, b.channel)
+	if err != nil {
+		return err
+	}
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	b.pubsub = pubsub
+	b.done = make(chan struct{})
+	go func() {
+		defer close(b.done)
+		for msg := range pubsub.Channel() {
+			handler([]byte(msg.Payload))
+		}
+	}()
+	return nil
+}
+
+func (b *redisBus) Close() error {
+	if b.pubsub == nil {
+		return nil
+	}
+	err := b.pubsub.Close()
+	<-b.done
+	return err
+}
+
+// kafkaBus 使用kafka广播，直接消费topic的所有分区而不加入消费组，保证每个实例都能收到全部消息
+type kafkaBus struct {
+	producer *kafka.Producer
+	consumer sarama.Consumer
+	topic    string
+
+	partitions []sarama.PartitionConsumer
+	wg         sync.WaitGroup
+}
+
+// NewKafkaBus 创建基于kafka的失效广播，消费者使用consumerOpt的地址和安全配置，不会加入消费组
+func NewKafkaBus(producer *kafka.Producer, consumerOpt *kafka.Options, topic string) (InvalidationBus, error) {
+	if producer == nil || consumerOpt == nil {
+		return nil, errors.New("kafka producer and consumer must not be nil")
+	}
+	if topic == "" {
+		return nil, errors.New("empty kafka topic")
+	}
+	consumer, err := kafka.NewPartitionConsumer(consumerOpt)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaBus{producer: producer, consumer: consumer, topic: topic}, nil
+}
+
+// Publish 使用非阻塞发送，生产者缓冲区已满时返回错误
+func (b *kafkaBus) Publish(msg []byte) error {
+	return b.producer.TrySend(b.topic, string(msg), nil)
+}
+
+// Subscribe 从最新位置消费订阅时topic的所有分区，之后新增的分区不会被消费
+func (b *kafkaBus) Subscribe(handler func(msg []byte)) error {
+	ids, err := b.consumer.Partitions(b.topic)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		pc, err := b.consumer.ConsumePartition(b.topic, id, sarama.OffsetNewest)
+		if err != nil {
+			b.Close()
+			return err
+		}
+		b.partitions = append(b.partitions, pc)
+		b.wg.Add(2)
+		go func() {
+			defer b.wg.Done()
+			for msg := range pc.Messages() {
+				handler(msg.Value)
+			}
+		}()
+		go func() {
+			defer b.wg.Done()
+			for err := range pc.Errors() {
+				log.Errorf("multicache: consume invalidation of topic %s failed: %s", b.topic, err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (b *kafkaBus) Close() error {
+	for _, pc := range b.partitions {
+		pc.AsyncClose()
+	}
+	b.wg.Wait()
+	return b.consumer.Close()
+}
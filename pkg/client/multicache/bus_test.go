@@ -0,0 +1,108 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NetEase-Media/ngo/pkg/client/redis"
+)
+
+func newBusTestMiner(t *testing.T, s *miniredis.Miniredis) (*Miner, *LocalMiner) {
+	client := redis.NewClient(&redis.Options{Name: "multicache", Addr: []string{s.Addr()}})
+	local := NewLocalMiner(gcache.New(100).LRU().Build(), 0, 0)
+	m := &Miner{}
+	m.RegisterHander(NewRedisMiner(client, 1, 0), local)
+	bus, err := NewRedisBus(client, "")
+	assert.NoError(t, err)
+	assert.NoError(t, m.SetBus(bus))
+	return m, local
+}
+
+func TestMiner_RedisBus(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+
+	m1, local1 := newBusTestMiner(t, s)
+	defer m1.CloseBus()
+	m2, local2 := newBusTestMiner(t, s)
+	defer m2.CloseBus()
+
+	_, err = m1.Set("k1", "v1")
+	assert.NoError(t, err)
+	v, _ := m2.Get("k1")
+	assert.Equal(t, "v1", v)
+	assert.Eventually(t, func() bool {
+		v, _ := local2.Get("k1")
+		return v == "v1"
+	}, time.Second, time.Millisecond*10)
+
+	// 其他实例的本地缓存被删除，自己的不受影响
+	_, err = m1.Set("k1", "v2")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		v, _ := local2.Get("k1")
+		return v == ""
+	}, time.Second, time.Millisecond*10)
+	v, _ = local1.Get("k1")
+	assert.Equal(t, "v2", v)
+	v, _ = m2.Get("k1")
+	assert.Equal(t, "v2", v)
+
+	local2.Set("k2", "v")
+	_, err = m1.Clear()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		v, _ := local2.Get("k2")
+		return v == ""
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestNewBus_Check(t *testing.T) {
+	_, err := NewRedisBus(nil, "")
+	assert.Error(t, err)
+	_, err = NewRedisBus(redis.NewShardedClient(nil), "")
+	assert.Error(t, err)
+	_, err = NewKafkaBus(nil, nil, "topic")
+	assert.Error(t, err)
+	_, err = newBus(&Options{Invalidation: BusKafka, InvalidationConsumer: "none"}, "")
+	assert.Error(t, err)
+	_, err = newBus(&Options{Invalidation: "unknown"}, "")
+	assert.Error(t, err)
+}
+
+func TestMiner_CloseBusConcurrently(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+
+	m, _ := newBusTestMiner(t, s)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_, _ = m.Set("k", "v")
+		}
+	}()
+	assert.NoError(t, m.CloseBus())
+	<-done
+	assert.NoError(t, m.CloseBus())
+}
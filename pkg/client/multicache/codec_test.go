@@ -0,0 +1,98 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NetEase-Media/ngo/pkg/client/redis"
+)
+
+type codecUser struct {
+	Name string
+	Age  int
+	Tags []string
+}
+
+func TestCodecs(t *testing.T) {
+	u := codecUser{Name: "kiko", Age: 18, Tags: []string{"a", "b"}}
+	for _, name := range []string{CodecJSON, CodecMsgpack, CodecGob} {
+		c, err := GetCodec(name)
+		assert.NoError(t, err)
+		data, err := c.Marshal(u)
+		assert.NoError(t, err)
+		var got codecUser
+		assert.NoError(t, c.Unmarshal(data, &got))
+		assert.Equal(t, u, got, name)
+	}
+	_, err := GetCodec("unknown")
+	assert.Error(t, err)
+}
+
+// newTestMiner 创建local+redis两级缓存，redis使用miniredis
+func newTestMiner(t *testing.T) (*Miner, *LocalMiner, *miniredis.Miniredis) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	client := redis.NewClient(&redis.Options{Name: "multicache", Addr: []string{s.Addr()}})
+	local := NewLocalMiner(gcache.New(100).LRU().Build(), 0, 0)
+	m := &Miner{}
+	m.RegisterHander(NewRedisMiner(client, 1, 0), local)
+	return m, local, s
+}
+
+func TestMiner_Object(t *testing.T) {
+	m, local, s := newTestMiner(t)
+	defer s.Close()
+	c, _ := GetCodec(CodecMsgpack)
+	m.SetCodec(c)
+
+	var got codecUser
+	assert.Equal(t, ErrMiss, m.GetObject("u1", &got))
+
+	u := codecUser{Name: "kiko", Age: 18}
+	assert.NoError(t, m.SetObjectWithTimeout("u1", u, 10))
+	assert.NoError(t, m.GetObject("u1", &got))
+	assert.Equal(t, u, got)
+
+	// 本地缓存失效后从redis读取
+	local.Evict("u1")
+	got = codecUser{}
+	assert.NoError(t, m.GetObject("u1", &got))
+	assert.Equal(t, u, got)
+}
+
+func TestMiner_MGetMSet(t *testing.T) {
+	m, local, s := newTestMiner(t)
+	defer s.Close()
+
+	assert.NoError(t, m.MSet(map[string]string{"k1": "v1", "k2": "v2"}, 10))
+	s.Set("k3", "v3")
+	local.Evict("k2")
+
+	ret, err := m.MGet("k1", "k2", "k3", "k4")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"k1": "v1", "k2": "v2", "k3": "v3"}, ret)
+
+	// redis命中的值会回填到本地缓存
+	assert.Eventually(t, func() bool {
+		v, _ := local.Get("k3")
+		return v == "v3"
+	}, time.Second, time.Millisecond*10)
+}
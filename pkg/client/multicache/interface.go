@@ -15,7 +15,7 @@
 package multicache
 
 // 文件主要定义各级handler处理数据的方式
-// 目前只是提供字符串数据的传输和输入，复杂类型不做处理
+// handler只提供字符串数据的传输和输入，复杂类型由Miner通过Codec转换
 
 // Handler 处理方式
 type Handler interface {
@@ -26,3 +26,20 @@ type Handler interface {
 	Evict(key string) (bool, error)
 	Clear() (bool, error)
 }
+
+// BatchHandler 是可选的批量接口，handler未实现时Miner会逐个key处理
+type BatchHandler interface {
+	MGet(keys []string) (map[string]string, error) // 只返回命中的key
+	MSet(values map[string]string, ttl int) error  // ttl单位为秒，小于等于0表示不过期
+}
+
+// levelTTL 返回实际写入的过期秒数, max为该级缓存的最大过期秒数
+func levelTTL(ttl, max int) int {
+	if max <= 0 {
+		return ttl
+	}
+	if ttl <= 0 || ttl > max {
+		return max
+	}
+	return ttl
+}
@@ -0,0 +1,238 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicache
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envelopeValue    = 'v'
+	envelopeNegative = 'n'
+
+	defaultLoadTimeout = 10
+)
+
+// Loader 从数据源加载key对应的值，数据不存在时应返回ErrMiss
+type Loader func(ctx context.Context, key string) (string, error)
+
+// ObjectLoader 从数据源加载key对应的对象，数据不存在时应返回ErrMiss
+type ObjectLoader func(ctx context.Context, key string) (interface{}, error)
+
+// LoadOptions 是GetOrLoad的配置
+type LoadOptions struct {
+	// 数据不存在时缓存的秒数，0表示不缓存
+	NegativeTTL int
+
+	// ttl随机增加的比例，避免大量key同时过期
+	Jitter float64
+
+	// 过期后仍可返回旧值的秒数，期间后台异步刷新，0表示不启用
+	StaleTTL int
+
+	// loader的超时秒数，0表示使用默认的10秒。
+	// 并发加载共享同一次loader调用，loader使用独立的context，不受发起加载的调用取消的影响
+	LoadTimeout int
+}
+
+func NewDefaultLoadOptions() *LoadOptions {
+	return &LoadOptions{
+		NegativeTTL: 10,
+		Jitter:      0.1,
+		LoadTimeout: defaultLoadTimeout,
+	}
+}
+
+// SetLoadOptions 设置GetOrLoad的配置
+func (m *Miner) SetLoadOptions(opt *LoadOptions) {
+	m.loadOpt = *opt
+}
+
+// GetOrLoad 读取缓存，未命中时调用loader加载并写入各级缓存，ttl单位为秒。
+// 并发加载同一个key时只有一个调用会执行loader，数据不存在时返回ErrMiss。
+// 通过GetOrLoad写入的值带有过期信息，请勿混用Get/Set读写同一个key
+func (m *Miner) GetOrLoad(ctx context.Context, key string, ttl int, loader Loader) (string, error) {
+	raw, index, err := m.get(key)
+	if err != nil {
+		return "", err
+	}
+	if raw != "" {
+		e, ok := parseEnvelope(raw)
+		if !ok {
+			// 非GetOrLoad写入的值视为未过期
+			return raw, nil
+		}
+		now := time.Now()
+		if e.alive(now, m.loadOpt.StaleTTL) {
+			if index != 0 {
+				go m.sync(key, raw, index, e.remaining(now, m.loadOpt.StaleTTL))
+			}
+			if e.stale(now) {
+				m.group.DoChan(key, func() (interface{}, error) {
+					return m.sharedLoad(key, ttl, loader)
+				})
+			}
+			if e.kind == envelopeNegative {
+				return "", ErrMiss
+			}
+			return e.value, nil
+		}
+	}
+
+	ch := m.group.DoChan(key, func() (interface{}, error) {
+		return m.sharedLoad(key, ttl, loader)
+	})
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	}
+}
+
+// sharedLoad 使用独立的context加载，避免第一个调用取消时其他等待的调用也失败
+func (m *Miner) sharedLoad(key string, ttl int, loader Loader) (string, error) {
+	timeout := m.loadOpt.LoadTimeout
+	if timeout <= 0 {
+		timeout = defaultLoadTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	return m.load(ctx, key, ttl, loader)
+}
+
+// GetObjectOrLoad 与GetOrLoad相同，对象通过Codec编码后存储并解码到dst中
+func (m *Miner) GetObjectOrLoad(ctx context.Context, key string, ttl int, dst interface{}, loader ObjectLoader) error {
+	codec := m.getCodec()
+	ret, err := m.GetOrLoad(ctx, key, ttl, func(ctx context.Context, key string) (string, error) {
+		v, err := loader(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		data, err := codec.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	})
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal([]byte(ret), dst)
+}
+
+func (m *Miner) load(ctx context.Context, key string, ttl int, loader Loader) (string, error) {
+	v, err := loader(ctx, key)
+	if err == ErrMiss {
+		if m.loadOpt.NegativeTTL > 0 {
+			e := envelope{kind: envelopeNegative, expireAt: time.Now().Add(time.Duration(m.loadOpt.NegativeTTL) * time.Second)}
+			_, err := m.SetWithTimeout(key, e.String(), m.loadOpt.NegativeTTL)
+			if err != nil {
+				return "", err
+			}
+		}
+		return "", ErrMiss
+	}
+	if err != nil {
+		return "", err
+	}
+
+	e := envelope{kind: envelopeValue, value: v}
+	if ttl <= 0 {
+		_, err = m.Set(key, e.String())
+		return v, err
+	}
+	ttl = m.jitter(ttl)
+	e.expireAt = time.Now().Add(time.Duration(ttl) * time.Second)
+	_, err = m.SetWithTimeout(key, e.String(), ttl+m.loadOpt.StaleTTL)
+	return v, err
+}
+
+func (m *Miner) jitter(ttl int) int {
+	if m.loadOpt.Jitter <= 0 {
+		return ttl
+	}
+	n := int(float64(ttl) * m.loadOpt.Jitter)
+	if n <= 0 {
+		return ttl
+	}
+	return ttl + rand.Intn(n+1)
+}
+
+// envelope 是GetOrLoad写入的值，格式为 <过期时间毫秒>:<类型>:<值>
+type envelope struct {
+	kind     byte
+	expireAt time.Time // 为零值时表示不过期
+	value    string
+}
+
+func parseEnvelope(raw string) (envelope, bool) {
+	i := strings.IndexByte(raw, ':')
+	if i < 0 || len(raw) < i+3 || raw[i+2] != ':' {
+		return envelope{}, false
+	}
+	ms, err := strconv.ParseInt(raw[:i], 10, 64)
+	if err != nil {
+		return envelope{}, false
+	}
+	e := envelope{kind: raw[i+1], value: raw[i+3:]}
+	if e.kind != envelopeValue && e.kind != envelopeNegative {
+		return envelope{}, false
+	}
+	if ms > 0 {
+		e.expireAt = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return e, true
+}
+
+func (e envelope) String() string {
+	var ms int64
+	if !e.expireAt.IsZero() {
+		ms = e.expireAt.UnixNano() / int64(time.Millisecond)
+	}
+	return strconv.FormatInt(ms, 10) + ":" + string(e.kind) + ":" + e.value
+}
+
+// stale 表示已过期，需要刷新
+func (e envelope) stale(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// alive 表示未过期或仍在可返回旧值的时间内
+func (e envelope) alive(now time.Time, staleTTL int) bool {
+	if !e.stale(now) {
+		return true
+	}
+	return e.kind == envelopeValue && now.Before(e.expireAt.Add(time.Duration(staleTTL)*time.Second))
+}
+
+// remaining 返回剩余的缓存秒数，用于回填上级缓存
+func (e envelope) remaining(now time.Time, staleTTL int) int {
+	if e.expireAt.IsZero() {
+		return defaultSyncTTL
+	}
+	d := e.expireAt.Add(time.Duration(staleTTL) * time.Second).Sub(now)
+	if d < time.Second {
+		return 1
+	}
+	return int(d / time.Second)
+}
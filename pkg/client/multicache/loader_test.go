@@ -0,0 +1,163 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiner_GetOrLoad(t *testing.T) {
+	m, _, s := newTestMiner(t)
+	defer s.Close()
+	m.SetLoadOptions(NewDefaultLoadOptions())
+
+	var calls int32
+	loader := func(ctx context.Context, key string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 50)
+		return "v:" + key, nil
+	}
+
+	// 并发加载只执行一次loader
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := m.GetOrLoad(context.Background(), "k1", 10, loader)
+			assert.NoError(t, err)
+			assert.Equal(t, "v:k1", v)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	v, err := m.GetOrLoad(context.Background(), "k1", 10, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, "v:k1", v)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// loader出错不缓存
+	failed := errors.New("failed")
+	_, err = m.GetOrLoad(context.Background(), "k2", 10, func(ctx context.Context, key string) (string, error) {
+		return "", failed
+	})
+	assert.Equal(t, failed, err)
+	raw, _ := m.Get("k2")
+	assert.Equal(t, "", raw)
+
+	// 取消等待
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = m.GetOrLoad(ctx, "k3", 10, loader)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestMiner_GetOrLoadDetached(t *testing.T) {
+	m, _, s := newTestMiner(t)
+	defer s.Close()
+	m.SetLoadOptions(NewDefaultLoadOptions())
+
+	loader := func(ctx context.Context, key string) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Millisecond * 50):
+			return "v:" + key, nil
+		}
+	}
+
+	// 第一个调用取消后，其他等待的调用仍能得到结果
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.GetOrLoad(ctx, "k1", 10, loader)
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 5)
+	v, err := m.GetOrLoad(context.Background(), "k1", 10, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, "v:k1", v)
+	assert.Equal(t, context.DeadlineExceeded, <-done)
+}
+
+func TestMiner_GetOrLoadNegative(t *testing.T) {
+	m, _, s := newTestMiner(t)
+	defer s.Close()
+	m.SetLoadOptions(NewDefaultLoadOptions())
+
+	var calls int32
+	loader := func(ctx context.Context, key string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "", ErrMiss
+	}
+	for i := 0; i < 3; i++ {
+		_, err := m.GetOrLoad(context.Background(), "k1", 10, loader)
+		assert.Equal(t, ErrMiss, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestMiner_GetOrLoadStale(t *testing.T) {
+	m, _, s := newTestMiner(t)
+	defer s.Close()
+	m.SetLoadOptions(&LoadOptions{StaleTTL: 10})
+
+	var version int32
+	loader := func(ctx context.Context, key string) (string, error) {
+		time.Sleep(time.Millisecond * 50)
+		if atomic.AddInt32(&version, 1) == 1 {
+			return "v1", nil
+		}
+		return "v2", nil
+	}
+	v, err := m.GetOrLoad(context.Background(), "k1", 1, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	// 过期后先返回旧值，后台刷新
+	time.Sleep(time.Millisecond * 1100)
+	v, err = m.GetOrLoad(context.Background(), "k1", 1, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v)
+	assert.Eventually(t, func() bool {
+		v, _ := m.GetOrLoad(context.Background(), "k1", 1, loader)
+		return v == "v2"
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestEnvelope(t *testing.T) {
+	e := envelope{kind: envelopeValue, value: "a:b", expireAt: time.Unix(1600000000, 0)}
+	got, ok := parseEnvelope(e.String())
+	assert.True(t, ok)
+	assert.Equal(t, e.value, got.value)
+	assert.True(t, e.expireAt.Equal(got.expireAt))
+
+	got, ok = parseEnvelope("0:v:")
+	assert.True(t, ok)
+	assert.True(t, got.expireAt.IsZero())
+	assert.False(t, got.stale(time.Now()))
+
+	_, ok = parseEnvelope("plain value")
+	assert.False(t, ok)
+}
@@ -33,13 +33,24 @@ func InitOnloadFunc(f gcache.LoaderFunc) {
 
 // LocalMiner 本地缓存的具体实现
 type LocalMiner struct {
-	cache gcache.Cache
+	cache    gcache.Cache
+	priority int
+	ttl      int
 }
 
 // InitLocalMiner
 func InitLocal(cache gcache.Cache) {
 	localMiner = LocalMiner{
-		cache,
+		cache: cache,
+	}
+}
+
+// NewLocalMiner 创建本地缓存handler, ttl为最大过期秒数, 0表示不限制
+func NewLocalMiner(cache gcache.Cache, priority, ttl int) *LocalMiner {
+	return &LocalMiner{
+		cache:    cache,
+		priority: priority,
+		ttl:      ttl,
 	}
 }
 
@@ -48,10 +59,13 @@ func GetLocalMiner() LocalMiner {
 }
 
 func (l *LocalMiner) Priority() int {
-	return 0
+	return l.priority
 }
 
 func (l *LocalMiner) Set(key, value string) (bool, error) {
+	if l.ttl > 0 {
+		return l.SetWithTimeout(key, value, l.ttl)
+	}
 	err := l.cache.Set(key, value)
 	if err != nil {
 		return false, err
@@ -61,6 +75,11 @@ func (l *LocalMiner) Set(key, value string) (bool, error) {
 
 // SetWithTimeout 时间单位为S
 func (l *LocalMiner) SetWithTimeout(key, value string, ttl int) (bool, error) {
+	ttl = levelTTL(ttl, l.ttl)
+	if ttl <= 0 {
+		err := l.cache.Set(key, value)
+		return err == nil, err
+	}
 	err := l.cache.SetWithExpire(key, value, time.Duration(ttl*int(time.Second)))
 	if err != nil {
 		return false, err
@@ -88,3 +107,26 @@ func (l *LocalMiner) Clear() (bool, error) {
 	l.cache.Purge()
 	return true, nil
 }
+
+func (l *LocalMiner) MGet(keys []string) (map[string]string, error) {
+	ret := make(map[string]string, len(keys))
+	for _, key := range keys {
+		v, err := l.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			ret[key] = v
+		}
+	}
+	return ret, nil
+}
+
+func (l *LocalMiner) MSet(values map[string]string, ttl int) error {
+	for key, value := range values {
+		if _, err := l.SetWithTimeout(key, value, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicache
+
+import (
+	"time"
+
+	gomemcache "github.com/bradfitz/gomemcache/memcache"
+
+	"github.com/NetEase-Media/ngo/pkg/client/memcache"
+)
+
+// 本文件主要是处理memcache相关的默认实现方式
+
+// maxRelativeExpire 是memcache按相对秒数处理的最大过期时间(30天), 超过时会被当作unix时间戳
+const maxRelativeExpire = 60 * 60 * 24 * 30
+
+type memcacheClient interface {
+	Get(key string) (string, error)
+	MGet(keys []string) (map[string]string, error)
+	Set(key string, value string) error
+	SetWithExpire(key string, value string, expire int) error
+	Delete(key string) error
+}
+
+// MemcacheMiner memcache 相关具体实现
+type MemcacheMiner struct {
+	client   memcacheClient
+	priority int
+	ttl      int
+}
+
+// NewMemcacheMiner 创建memcache缓存handler, ttl为最大过期秒数, 0表示不限制
+func NewMemcacheMiner(client *memcache.MemcacheProxy, priority, ttl int) *MemcacheMiner {
+	return &MemcacheMiner{
+		client:   client,
+		priority: priority,
+		ttl:      ttl,
+	}
+}
+
+func (m *MemcacheMiner) Priority() int {
+	return m.priority
+}
+
+func (m *MemcacheMiner) Set(key, value string) (bool, error) {
+	return m.SetWithTimeout(key, value, 0)
+}
+
+// SetWithTimeout 时间单位为S
+func (m *MemcacheMiner) SetWithTimeout(key, value string, ttl int) (bool, error) {
+	ttl = levelTTL(ttl, m.ttl)
+	var err error
+	if ttl > 0 {
+		err = m.client.SetWithExpire(key, value, memcacheExpire(ttl))
+	} else {
+		err = m.client.Set(key, value)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// memcacheExpire 将超过30天的过期秒数转换为unix时间戳, 否则memcache会把它当作已经过去的时间点
+func memcacheExpire(ttl int) int {
+	if ttl > maxRelativeExpire {
+		return int(time.Now().Unix()) + ttl
+	}
+	return ttl
+}
+
+func (m *MemcacheMiner) Get(key string) (string, error) {
+	ret, err := m.client.Get(key)
+	if err == gomemcache.ErrCacheMiss {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return ret, nil
+}
+
+func (m *MemcacheMiner) Evict(key string) (bool, error) {
+	err := m.client.Delete(key)
+	if err != nil && err != gomemcache.ErrCacheMiss {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *MemcacheMiner) Clear() (bool, error) {
+	// 不支持清理所有数据，因此目前不做操作
+	return true, nil
+}
+
+func (m *MemcacheMiner) MGet(keys []string) (map[string]string, error) {
+	ret, err := m.client.MGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ret {
+		if v == "" {
+			delete(ret, k)
+		}
+	}
+	if ret == nil {
+		ret = make(map[string]string)
+	}
+	return ret, nil
+}
+
+func (m *MemcacheMiner) MSet(values map[string]string, ttl int) error {
+	for key, value := range values {
+		if _, err := m.SetWithTimeout(key, value, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
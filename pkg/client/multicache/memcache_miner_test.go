@@ -0,0 +1,169 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	gomemcache "github.com/bradfitz/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMemcache 记录写入的过期时间，用于测试
+type fakeMemcache struct {
+	mu      sync.Mutex
+	data    map[string]string
+	expires map[string]int
+}
+
+func newFakeMemcache() *fakeMemcache {
+	return &fakeMemcache{data: make(map[string]string), expires: make(map[string]int)}
+}
+
+func (f *fakeMemcache) Get(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.data[key]
+	if !ok {
+		return "", gomemcache.ErrCacheMiss
+	}
+	return v, nil
+}
+
+func (f *fakeMemcache) MGet(keys []string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret := make(map[string]string)
+	for _, k := range keys {
+		if v, ok := f.data[k]; ok {
+			ret[k] = v
+		}
+	}
+	return ret, nil
+}
+
+func (f *fakeMemcache) Set(key string, value string) error {
+	return f.SetWithExpire(key, value, 0)
+}
+
+func (f *fakeMemcache) SetWithExpire(key string, value string, expire int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = value
+	f.expires[key] = expire
+	return nil
+}
+
+func (f *fakeMemcache) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.data[key]; !ok {
+		return gomemcache.ErrCacheMiss
+	}
+	delete(f.data, key)
+	return nil
+}
+
+func TestRegisterHander_Order(t *testing.T) {
+	mem := &MemcacheMiner{client: newFakeMemcache(), priority: 2}
+	red := &RedisMiner{priority: 1}
+	local := NewLocalMiner(gcache.New(100).LRU().Build(), 0, 0)
+	m := &Miner{}
+	m.RegisterHander(red, mem, local)
+	// 读取顺序与之前的版本相同，按优先级从小到大
+	assert.Equal(t, []Handler{local, red, mem}, m.handersR)
+	assert.Equal(t, []Handler{mem, red, local}, m.handersW)
+}
+
+func TestMemcacheMiner(t *testing.T) {
+	f := newFakeMemcache()
+	mem := &MemcacheMiner{client: f, priority: 1, ttl: 30}
+	m := &Miner{}
+	m.RegisterHander(mem, NewLocalMiner(gcache.New(100).LRU().Build(), 0, 5))
+
+	v, err := m.Get("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, "", v)
+
+	// 每级按各自的最大过期时间写入
+	_, err = m.Set("k1", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, f.expires["k1"])
+	_, err = m.SetWithTimeout("k2", "v2", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, f.expires["k2"])
+	_, err = m.SetWithTimeout("k3", "v3", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, f.expires["k3"])
+
+	ret, err := m.MGet("k1", "k2", "k4")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"k1": "v1", "k2": "v2"}, ret)
+
+	_, err = m.Evict("k1")
+	assert.NoError(t, err)
+	_, err = m.Evict("k1")
+	assert.NoError(t, err)
+	v, _ = mem.Get("k1")
+	assert.Equal(t, "", v)
+
+	// 超过30天的过期时间转换为unix时间戳
+	long := &MemcacheMiner{client: f}
+	_, err = long.SetWithTimeout("k5", "v5", maxRelativeExpire)
+	assert.NoError(t, err)
+	assert.Equal(t, maxRelativeExpire, f.expires["k5"])
+	_, err = long.SetWithTimeout("k6", "v6", maxRelativeExpire+1)
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Now().Unix()+maxRelativeExpire+1, f.expires["k6"], 2)
+}
+
+func TestLevelTTL(t *testing.T) {
+	assert.Equal(t, 10, levelTTL(10, 0))
+	assert.Equal(t, 0, levelTTL(0, 0))
+	assert.Equal(t, 5, levelTTL(0, 5))
+	assert.Equal(t, 5, levelTTL(10, 5))
+	assert.Equal(t, 3, levelTTL(3, 5))
+}
+
+func TestNewMiner(t *testing.T) {
+	m, err := newMiner("second", []Options{{Name: "second", Type: "local", TTL: 10}})
+	assert.NoError(t, err)
+	assert.Len(t, m.handersR, 1)
+	assert.Equal(t, 10, m.handersR[0].(*LocalMiner).ttl)
+
+	_, err = newMiner("third", []Options{{Type: "memcache", DefaultMemcache: "not-exist"}})
+	assert.Error(t, err)
+	_, err = newMiner("third", []Options{{Type: "unknown"}})
+	assert.Error(t, err)
+
+	// 未配置优先级时按类型排序, 读先local后redis, 写相反
+	m, err = newMiner("second", []Options{
+		{Name: "second", Type: "redis", DefaultRedis: "client1"},
+		{Name: "second", Type: "local"},
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &LocalMiner{}, m.handersR[0])
+	assert.IsType(t, &RedisMiner{}, m.handersR[1])
+	assert.IsType(t, &RedisMiner{}, m.handersW[0])
+	assert.IsType(t, &LocalMiner{}, m.handersW[1])
+
+	_, err = GetMiner("not-exist")
+	assert.Equal(t, MinerNotInitError, err)
+	_, err = GetMiner()
+	assert.NoError(t, err)
+}
@@ -16,45 +16,104 @@ package multicache
 
 import (
 	"errors"
+	"fmt"
 	"sort"
+	"sync"
 
+	"github.com/NetEase-Media/ngo/pkg/client/kafka"
+	"github.com/NetEase-Media/ngo/pkg/client/memcache"
 	"github.com/NetEase-Media/ngo/pkg/client/redis"
 	"github.com/bluele/gcache"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	defaultCapacity int = 1000000 // 默认最大100w
+	defaultSyncTTL  int = 60      // 回填上级缓存的过期时间，单位秒
 )
 
 var MinerNotInitError = errors.New("miner has not init yet.")
 
+// ErrMiss 表示所有级别的缓存都未命中
+var ErrMiss = errors.New("multicache: cache miss")
+
+// DefaultMinerName 是未指定名称时的Miner名称
+const DefaultMinerName = "default"
+
 // 这里主要是进行客户端的初始化
 type Options struct {
-	Type         string // 类型 local, redis 目前先支持这两个
-	Priority     int    // 加载优先级, 0 是最高优先级数字越大优先级越低
-	Capacity     int    // 最大的容积, 主要是给本地缓存使使用
-	DefaultRedis string // 默认获取哪个 Redis 客户端
-	Strategy     string // 淘汰策略: simple/lru/lfu/arc, 这个只有localcache支持
-	Onload       bool   // 是否支持onload
+	Name            string // 所属Miner的名称, 相同名称的配置组成一个多级缓存, 默认为default
+	Type            string // 类型 local, redis, memcache
+	Priority        int    // 加载优先级, 0 是最高优先级数字越大优先级越低
+	Capacity        int    // 最大的容积, 主要是给本地缓存使使用
+	TTL             int    // 该级缓存的最大过期秒数, 0表示不限制
+	DefaultRedis    string // 默认获取哪个 Redis 客户端
+	DefaultMemcache string // 默认获取哪个 Memcache 客户端
+	Strategy        string // 淘汰策略: simple/lru/lfu/arc, 这个只有localcache支持
+	Onload          bool   // 是否支持onload
+	Codec           string // GetObject/SetObject使用的编码: json/msgpack/gob, 取第一个非空配置, 默认json
+
+	// 以下为本地缓存的失效广播配置, 只对local类型生效
+	Invalidation         string // 广播方式: redis/kafka, 为空时不广播
+	InvalidationChannel  string // redis频道或kafka topic, redis默认为 ngo:multicache:invalidate
+	InvalidationProducer string // kafka生产者名称
+	InvalidationConsumer string // kafka消费者名称, 使用其地址和安全配置直接消费所有分区, 不加入消费组
 }
 
-var minerClient *Miner
+var (
+	minerClient *Miner
+	miners      map[string]*Miner
 
-func Init(opts []Options) { // 默认的客户端的名字, 默认取第一个配置项
+	// typeOrder 是优先级相同时各类型的顺序
+	typeOrder = map[string]int{"local": 0, "redis": 1, "memcache": 2}
+)
+
+func Init(opts []Options) { // 按Name分组, 每组创建一个Miner
 	if len(opts) == 0 {
 		return
 	}
 
-	if minerClient != nil {
+	if miners != nil {
 		panic("local cache miner has multi initialed")
 	}
 
-	sort.Slice(opts, func(i, j int) bool {
-		return opts[i].Priority > opts[j].Priority
+	groups := make(map[string][]Options)
+	for _, opt := range opts {
+		if opt.Name == "" {
+			opt.Name = DefaultMinerName
+		}
+		groups[opt.Name] = append(groups[opt.Name], opt)
+	}
+
+	m := make(map[string]*Miner, len(groups))
+	for name, group := range groups {
+		miner, err := newMiner(name, group)
+		if err != nil {
+			panic(err)
+		}
+		m[name] = miner
+	}
+	miners = m
+	minerClient = m[DefaultMinerName]
+}
+
+// newMiner 根据一组配置创建Miner
+func newMiner(name string, opts []Options) (*Miner, error) {
+	// 优先级相同时(如均未配置)按local、redis、memcache的顺序
+	sort.SliceStable(opts, func(i, j int) bool {
+		if opts[i].Priority != opts[j].Priority {
+			return opts[i].Priority < opts[j].Priority
+		}
+		return typeOrder[opts[i].Type] < typeOrder[opts[j].Type]
 	})
 
+	var codec, defaultRedis string
+	var busOpt *Options
 	var handlers []Handler
 	for _, cli := range opts {
+		if codec == "" {
+			codec = cli.Codec
+		}
 		if cli.Capacity == 0 {
 			cli.Capacity = defaultCapacity
 		}
@@ -66,38 +125,99 @@ func Init(opts []Options) { // 默认的客户端的名字, 默认取第一个
 			builder := gcache.New(cli.Capacity).EvictType(cli.Strategy)
 			if cli.Onload {
 				if OnloadFunc == nil {
-					panic("OnloadFunc need initial first.")
+					return nil, errors.New("OnloadFunc need initial first.")
 				}
 				builder.LoaderFunc(OnloadFunc)
 			}
+			if cli.Invalidation != "" {
+				o := cli
+				busOpt = &o
+			}
 			cac := builder.Build()
-			InitLocal(cac)
-			localClient := GetLocalMiner()
-			handlers = append(handlers, &localClient)
+			if name == DefaultMinerName {
+				InitLocal(cac)
+			}
+			handlers = append(handlers, NewLocalMiner(cac, cli.Priority, cli.TTL))
 		case "redis":
 			if cli.DefaultRedis == "" {
 				// 没有拿到默认的redis
-				panic("you need config default redis for multicache first.")
+				return nil, errors.New("you need config default redis for multicache first.")
 			}
 			red := redis.GetClient(cli.DefaultRedis)
 			if red == nil {
-				panic("default redis do not exist.")
+				return nil, fmt.Errorf("redis %s do not exist.", cli.DefaultRedis)
+			}
+			defaultRedis = cli.DefaultRedis
+			if name == DefaultMinerName {
+				InitRedis(red)
+			}
+			handlers = append(handlers, NewRedisMiner(red, cli.Priority, cli.TTL))
+		case "memcache":
+			if cli.DefaultMemcache == "" {
+				return nil, errors.New("you need config default memcache for multicache first.")
 			}
-			InitRedis(red)
-			localRedis := GetRedisMiner()
-			handlers = append(handlers, &localRedis)
+			mem := memcache.GetClient(cli.DefaultMemcache)
+			if mem == nil {
+				return nil, fmt.Errorf("memcache %s do not exist.", cli.DefaultMemcache)
+			}
+			handlers = append(handlers, NewMemcacheMiner(mem, cli.Priority, cli.TTL))
+		default:
+			return nil, fmt.Errorf("unknown multicache type %s", cli.Type)
+		}
+	}
+	if codec == "" {
+		codec = CodecJSON
+	}
+	c, err := GetCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	miner := &Miner{codec: c, loadOpt: *NewDefaultLoadOptions()}
+	miner.RegisterHander(handlers...)
+
+	if busOpt != nil {
+		bus, err := newBus(busOpt, defaultRedis)
+		if err != nil {
+			return nil, err
+		}
+		if err = miner.SetBus(bus); err != nil {
+			return nil, err
+		}
+	}
+	return miner, nil
+}
+
+func newBus(opt *Options, defaultRedis string) (InvalidationBus, error) {
+	switch opt.Invalidation {
+	case BusRedis:
+		name := opt.DefaultRedis
+		if name == "" {
+			name = defaultRedis
+		}
+		return NewRedisBus(redis.GetClient(name), opt.InvalidationChannel)
+	case BusKafka:
+		consumer := kafka.GetConsumer(opt.InvalidationConsumer)
+		if consumer == nil {
+			return nil, fmt.Errorf("kafka consumer %s not found", opt.InvalidationConsumer)
 		}
+		consumerOpt := consumer.Options()
+		return NewKafkaBus(kafka.GetProducer(opt.InvalidationProducer), &consumerOpt, opt.InvalidationChannel)
+	default:
+		return nil, fmt.Errorf("unknown invalidation bus %s", opt.Invalidation)
 	}
-	minerClient = &Miner{}
-	minerClient.RegisterHander(handlers...)
 }
 
-// GetMiner 获取多级缓存处理客户端
-func GetMiner() (*Miner, error) {
-	if minerClient == nil {
+// GetMiner 获取指定名称的Miner, 不指定时返回default
+func GetMiner(name ...string) (*Miner, error) {
+	n := DefaultMinerName
+	if len(name) > 0 {
+		n = name[0]
+	}
+	m, ok := miners[n]
+	if !ok {
 		return nil, MinerNotInitError
 	}
-	return minerClient, nil
+	return m, nil
 }
 
 // ***** 主要的外部接口均在这里实现 *****
@@ -107,6 +227,12 @@ func GetMiner() (*Miner, error) {
 type Miner struct {
 	handersR []Handler // 读顺序
 	handersW []Handler // 写顺序
+	codec    Codec
+	loadOpt  LoadOptions
+	group    singleflight.Group
+	busMu    sync.RWMutex
+	bus      InvalidationBus
+	busID    string
 }
 
 var NoReaderHanlderError = errors.New("No Reader Handler Error.")
@@ -123,17 +249,16 @@ func (m *Miner) RegisterHander(handlers ...Handler) {
 		return
 	}
 
-	// 读的顺序
+	// 读的顺序, 与之前的版本一致按优先级从小到大(0最先读取), 优先级相同时保持注册顺序
 	m.handersR = append(m.handersR, handlers...)
-	sort.Slice(m.handersR, func(i, j int) bool {
-		return m.handersR[i].Priority() > m.handersR[j].Priority()
-	})
-
-	// 写的顺序
-	m.handersW = append(m.handersW, handlers...)
-	sort.Slice(m.handersR, func(i, j int) bool {
+	sort.SliceStable(m.handersR, func(i, j int) bool {
 		return m.handersR[i].Priority() < m.handersR[j].Priority()
 	})
+
+	// 写的顺序, 与读相反。之前的版本按注册顺序写入
+	for i := len(m.handersR) - 1; i >= 0; i-- {
+		m.handersW = append(m.handersW, m.handersR[i])
+	}
 }
 
 func (m *Miner) Set(key, value string) (bool, error) {
@@ -148,6 +273,7 @@ func (m *Miner) Set(key, value string) (bool, error) {
 			return false, err
 		}
 	}
+	m.publishKeys(key)
 	return ret, nil
 }
 
@@ -163,36 +289,41 @@ func (m *Miner) SetWithTimeout(key, value string, ttl int) (bool, error) {
 			return false, err
 		}
 	}
+	m.publishKeys(key)
 	return ret, nil
 }
 
 func (m *Miner) Get(key string) (string, error) {
+	ret, index, err := m.get(key)
+	if err != nil {
+		return "", err
+	}
+	if ret != "" && index != 0 {
+		go m.sync(key, ret, index, defaultSyncTTL)
+	}
+	return ret, nil
+}
+
+// get 逐级查找key，返回命中的值及所在级别
+func (m *Miner) get(key string) (string, int, error) {
 	if len(m.handersR) == 0 {
-		return "", NoReaderHanlderError
+		return "", 0, NoReaderHanlderError
 	}
-	var ret string
-	var err error
-	var index int
-	for _, h := range m.handersR {
-		ret, err = h.Get(key)
+	for index, h := range m.handersR {
+		ret, err := h.Get(key)
 		if err != nil {
-			return "", err
+			return "", 0, err
 		}
 		if ret != "" { // 找到就提前返回
-			if index != 0 {
-				go m.sync(key, ret, index)
-			}
-			return ret, nil
+			return ret, index, nil
 		}
-		index += 1 // 代表在非底层找到, 访问了一次
 	}
-	return ret, nil
+	return "", len(m.handersR), nil
 }
 
-// 底层缓存失效后，将会同步新的数据到底层缓存, 默认延迟60s
-func (m *Miner) sync(key, value string, index int) {
+func (m *Miner) sync(key, value string, index int, ttl int) {
 	for i := 0; i < index; i++ {
-		m.handersR[i].SetWithTimeout(key, value, 60)
+		m.handersR[i].SetWithTimeout(key, value, ttl)
 	}
 }
 
@@ -208,6 +339,7 @@ func (m *Miner) Evict(key string) (bool, error) {
 			return false, err
 		}
 	}
+	m.publishKeys(key)
 	return ret, nil
 }
 
@@ -223,5 +355,142 @@ func (m *Miner) Clear() (bool, error) {
 			return false, err
 		}
 	}
+	m.publish(invalidation{Clear: true})
 	return ret, nil
 }
+
+// SetCodec 设置GetObject/SetObject使用的编码
+func (m *Miner) SetCodec(c Codec) {
+	m.codec = c
+}
+
+func (m *Miner) getCodec() Codec {
+	if m.codec == nil {
+		return jsonCodec{}
+	}
+	return m.codec
+}
+
+// GetObject 读取key并解码到dst中，dst必须为指针，未命中时返回ErrMiss
+func (m *Miner) GetObject(key string, dst interface{}) error {
+	ret, err := m.Get(key)
+	if err != nil {
+		return err
+	}
+	if ret == "" {
+		return ErrMiss
+	}
+	return m.getCodec().Unmarshal([]byte(ret), dst)
+}
+
+// SetObject 编码后写入各级缓存
+func (m *Miner) SetObject(key string, value interface{}) error {
+	data, err := m.getCodec().Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = m.Set(key, string(data))
+	return err
+}
+
+// SetObjectWithTimeout 编码后写入各级缓存，ttl单位为秒
+func (m *Miner) SetObjectWithTimeout(key string, value interface{}, ttl int) error {
+	data, err := m.getCodec().Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = m.SetWithTimeout(key, string(data), ttl)
+	return err
+}
+
+// MGet 批量读取，逐级查找未命中的key，下级命中的值会回填到上级，返回值只包含命中的key
+func (m *Miner) MGet(keys ...string) (map[string]string, error) {
+	if len(m.handersR) == 0 {
+		return nil, NoReaderHanlderError
+	}
+	ret := make(map[string]string, len(keys))
+	missing := keys
+	for index, h := range m.handersR {
+		if len(missing) == 0 {
+			break
+		}
+		found, err := mget(h, missing)
+		if err != nil {
+			return nil, err
+		}
+		next := make([]string, 0, len(missing))
+		hits := make(map[string]string, len(found))
+		for _, key := range missing {
+			if v, ok := found[key]; ok && v != "" {
+				ret[key] = v
+				hits[key] = v
+			} else {
+				next = append(next, key)
+			}
+		}
+		if index != 0 && len(hits) > 0 {
+			go m.msync(hits, index)
+		}
+		missing = next
+	}
+	return ret, nil
+}
+
+// MSet 批量写入各级缓存，ttl单位为秒，小于等于0表示不过期
+func (m *Miner) MSet(values map[string]string, ttl int) error {
+	if len(m.handersW) == 0 {
+		return NoWriterHanlderError
+	}
+	for _, h := range m.handersW {
+		if err := mset(h, values, ttl); err != nil {
+			return err
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	m.publishKeys(keys...)
+	return nil
+}
+
+func (m *Miner) msync(values map[string]string, index int) {
+	for i := 0; i < index; i++ {
+		mset(m.handersR[i], values, defaultSyncTTL)
+	}
+}
+
+func mget(h Handler, keys []string) (map[string]string, error) {
+	if b, ok := h.(BatchHandler); ok {
+		return b.MGet(keys)
+	}
+	ret := make(map[string]string, len(keys))
+	for _, key := range keys {
+		v, err := h.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			ret[key] = v
+		}
+	}
+	return ret, nil
+}
+
+func mset(h Handler, values map[string]string, ttl int) error {
+	if b, ok := h.(BatchHandler); ok {
+		return b.MSet(values, ttl)
+	}
+	for key, value := range values {
+		var err error
+		if ttl > 0 {
+			_, err = h.SetWithTimeout(key, value, ttl)
+		} else {
+			_, err = h.Set(key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -26,7 +26,9 @@ import (
 
 // RedisMiner redis 相关具体实现
 type RedisMiner struct {
-	redis redis.Redis
+	redis    redis.Redis
+	priority int
+	ttl      int
 }
 
 var redisMiner RedisMiner
@@ -34,7 +36,17 @@ var redisMiner RedisMiner
 // InitRedisMiner
 func InitRedis(redis redis.Redis) {
 	redisMiner = RedisMiner{
-		redis,
+		redis:    redis,
+		priority: 1,
+	}
+}
+
+// NewRedisMiner 创建redis缓存handler, ttl为最大过期秒数, 0表示不限制
+func NewRedisMiner(redis redis.Redis, priority, ttl int) *RedisMiner {
+	return &RedisMiner{
+		redis:    redis,
+		priority: priority,
+		ttl:      ttl,
 	}
 }
 
@@ -43,11 +55,11 @@ func GetRedisMiner() RedisMiner {
 }
 
 func (r *RedisMiner) Priority() int {
-	return 1
+	return r.priority
 }
 
 func (r *RedisMiner) Set(key, value string) (bool, error) {
-	_, err := r.redis.Set(context.Background(), key, value, 0).Result()
+	_, err := r.redis.Set(context.Background(), key, value, r.expiration(0)).Result()
 	if err != nil {
 		return false, err
 	}
@@ -56,7 +68,7 @@ func (r *RedisMiner) Set(key, value string) (bool, error) {
 
 // SetWithTimeout 时间单位为S
 func (r *RedisMiner) SetWithTimeout(key, value string, ttl int) (bool, error) {
-	_, err := r.redis.Set(context.Background(), key, value, time.Duration(int(time.Second))).Result()
+	_, err := r.redis.Set(context.Background(), key, value, r.expiration(ttl)).Result()
 	if err != nil {
 		return false, err
 	}
@@ -86,3 +98,48 @@ func (r *RedisMiner) Clear() (bool, error) {
 	// 不支持清理所有数据，因此目前不做操作
 	return true, nil
 }
+
+// MGet 使用pipeline批量读取，sharded_sentinel类型的客户端也可以使用
+func (r *RedisMiner) MGet(keys []string) (map[string]string, error) {
+	ctx := context.Background()
+	pipe := r.redis.Pipeline()
+	cmds := make([]*redisV8.StringCmd, len(keys))
+	for i := range keys {
+		cmds[i] = pipe.Get(ctx, keys[i])
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redisV8.Nil {
+		return nil, err
+	}
+	ret := make(map[string]string, len(keys))
+	for i, cmd := range cmds {
+		v, err := cmd.Result()
+		if err == redisV8.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret[keys[i]] = v
+	}
+	return ret, nil
+}
+
+func (r *RedisMiner) MSet(values map[string]string, ttl int) error {
+	ctx := context.Background()
+	expiration := r.expiration(ttl)
+	pipe := r.redis.Pipeline()
+	for key, value := range values {
+		pipe.Set(ctx, key, value, expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisMiner) expiration(ttl int) time.Duration {
+	ttl = levelTTL(ttl, r.ttl)
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Duration(ttl) * time.Second
+}
@@ -0,0 +1,488 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+const (
+	NearCacheModeAuto     = "auto"     // 优先使用tracking，服务端不支持时使用pubsub
+	NearCacheModeTracking = "tracking" // 使用redis6的CLIENT TRACKING广播模式
+	NearCacheModePubSub   = "pubsub"   // 通过客户端写入时发布失效消息，适用于低版本服务端
+
+	trackingInvalidateChannel = "__redis__:invalidate"
+	defaultNearCacheChannel   = "ngo:nearcache:invalidate"
+)
+
+// NearCacheOptions 是本地近端缓存的配置
+type NearCacheOptions struct {
+	// 失效通知模式，可选 auto、tracking、pubsub
+	Mode string
+
+	// 本地最多缓存的key数量
+	MaxSize int
+
+	// 本地缓存的最长时间，用于兜底失效消息丢失的情况
+	TTL time.Duration
+
+	// tracking 模式下只跟踪指定前缀的key，为空时跟踪所有key
+	Prefixes []string
+
+	// pubsub 模式下发布失效消息的频道
+	Channel string
+}
+
+func NewDefaultNearCacheOptions() *NearCacheOptions {
+	return &NearCacheOptions{
+		Mode:    NearCacheModeAuto,
+		MaxSize: 10000,
+		TTL:     time.Minute,
+		Channel: defaultNearCacheChannel,
+	}
+}
+
+// NearCacheStats 是本地缓存的统计信息
+type NearCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// NearCache 在Redis前增加一层本地缓存，缓存GET和HGET的结果，
+// 并通过失效通知保证各实例的本地缓存与redis一致。其他命令直接透传给redis。
+// 通过同一客户端执行的写命令（包括pipeline和EVAL声明的key）会立即清除本地缓存。
+type NearCache struct {
+	Redis
+
+	opt    NearCacheOptions
+	mode   string
+	logger *log.NgoLogger
+
+	mu      sync.Mutex
+	cache   gcache.Cache
+	loading map[string]*struct{} // 正在从redis加载的key，加载期间收到失效消息则放弃写入本地
+
+	hits   uint64
+	misses uint64
+
+	tracker *redis.Client // tracking 模式下专用于接收失效消息的客户端
+	pubsub  *redis.PubSub
+	done    chan struct{}
+	closed  int32
+}
+
+// nearEntry 是一个redis key在本地的缓存
+type nearEntry struct {
+	value    string
+	hasValue bool
+	fields   map[string]string
+}
+
+type subscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+type hooker interface {
+	AddHook(hook redis.Hook)
+}
+
+// NewNearCache 为客户端创建本地缓存，客户端一般通过GetClient获取。
+// tracking 模式只支持client和sentinel类型，pubsub 模式不支持sharded_sentinel类型。
+func NewNearCache(client Redis, opt *NearCacheOptions) (*NearCache, error) {
+	if client == nil {
+		return nil, errors.New("redis client must not be nil")
+	}
+	base := client
+	if container, ok := client.(*redisContainer); ok {
+		base = container.Redis
+	}
+	h, ok := base.(hooker)
+	if !ok {
+		return nil, errors.New("nearcache requires a client supporting hooks")
+	}
+	o := *opt
+	if o.Mode == "" {
+		o.Mode = NearCacheModeAuto
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = 10000
+	}
+	if o.TTL <= 0 {
+		o.TTL = time.Minute
+	}
+	if o.Channel == "" {
+		o.Channel = defaultNearCacheChannel
+	}
+
+	c := &NearCache{
+		Redis:   client,
+		opt:     o,
+		logger:  log.WithField("redis", "nearcache"),
+		cache:   gcache.New(o.MaxSize).LRU().Expiration(o.TTL).Build(),
+		loading: make(map[string]*struct{}),
+		done:    make(chan struct{}),
+	}
+
+	var err error
+	switch o.Mode {
+	case NearCacheModeTracking:
+		err = c.startTracking()
+	case NearCacheModePubSub:
+		err = c.startPubSub()
+	case NearCacheModeAuto:
+		if err = c.startTracking(); err != nil {
+			c.logger.Warnf("redis nearcache tracking unavailable, fallback to pubsub: %s", err.Error())
+			err = c.startPubSub()
+		}
+	default:
+		err = fmt.Errorf("unsupported nearcache mode: %s", o.Mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.AddHook(nearCacheHook{c: c})
+	go c.receive()
+	return c, nil
+}
+
+// startTracking 创建专用连接，用CLIENT TRACKING的广播模式将失效消息重定向到自身，
+// 连接重建时会重新开启tracking并清空本地缓存
+func (c *NearCache) startTracking() error {
+	container, ok := c.Redis.(*redisContainer)
+	if !ok {
+		return errors.New("tracking mode requires a client created by ngo")
+	}
+
+	onConnect := func(ctx context.Context, cn *redis.Conn) error {
+		id, err := cn.ClientID(ctx).Result()
+		if err != nil {
+			return err
+		}
+		args := []interface{}{"client", "tracking", "on", "redirect", id, "bcast"}
+		for _, p := range c.opt.Prefixes {
+			args = append(args, "prefix", p)
+		}
+		if err := cn.Process(ctx, redis.NewStatusCmd(ctx, args...)); err != nil {
+			return err
+		}
+		// 断线期间可能丢失失效消息
+		c.Purge()
+		return nil
+	}
+
+	var tracker *redis.Client
+	switch container.redisType {
+	case RedisTypeClient:
+		o := newClientOptions(&container.opt)
+		o.PoolSize = 1
+		o.MinIdleConns = 0
+		o.OnConnect = onConnect
+		tracker = redis.NewClient(o)
+	case RedisTypeSentinel:
+		o := newSentinelOptions(&container.opt)
+		o.PoolSize = 1
+		o.MinIdleConns = 0
+		o.OnConnect = onConnect
+		tracker = redis.NewFailoverClient(o)
+	default:
+		return fmt.Errorf("tracking mode does not support %s", container.redisType)
+	}
+
+	// 服务端低于6.0时开启tracking会失败
+	ctx := context.Background()
+	pubsub := tracker.Subscribe(ctx, trackingInvalidateChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		tracker.Close()
+		return err
+	}
+	c.mode = NearCacheModeTracking
+	c.tracker = tracker
+	c.pubsub = pubsub
+	return nil
+}
+
+// startPubSub 订阅失效频道，失效消息在客户端执行写命令后发布
+func (c *NearCache) startPubSub() error {
+	ctx := context.Background()
+	pubsub, err := Subscribe(ctx, c.Redis, c.opt.Channel)
+	if err != nil {
+		return err
+	}
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	c.mode = NearCacheModePubSub
+	c.pubsub = pubsub
+	return nil
+}
+
+// receive 处理失效消息，每次重新订阅后清空本地缓存
+func (c *NearCache) receive() {
+	defer close(c.done)
+	for m := range c.pubsub.ChannelWithSubscriptions(context.Background(), 100) {
+		switch msg := m.(type) {
+		case *redis.Subscription:
+			c.Purge()
+		case *redis.Message:
+			if msg.PayloadSlice != nil {
+				c.invalidate(msg.PayloadSlice...)
+			} else if msg.Payload != "" {
+				c.invalidate(msg.Payload)
+			} else {
+				// FLUSHALL/FLUSHDB 时失效消息为空
+				c.Purge()
+			}
+		}
+	}
+}
+
+// Mode 返回实际使用的失效通知模式
+func (c *NearCache) Mode() string {
+	return c.mode
+}
+
+// Stats 返回命中统计
+func (c *NearCache) Stats() NearCacheStats {
+	return NearCacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Size:   c.cache.Len(true),
+	}
+}
+
+// Purge 清空本地缓存
+func (c *NearCache) Purge() {
+	c.mu.Lock()
+	c.cache.Purge()
+	c.loading = make(map[string]*struct{})
+	c.mu.Unlock()
+}
+
+// Close 停止接收失效消息，不会关闭底层的redis客户端
+func (c *NearCache) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	err := c.pubsub.Close()
+	<-c.done
+	if c.tracker != nil {
+		c.tracker.Close()
+	}
+	c.Purge()
+	return err
+}
+
+func (c *NearCache) Get(ctx context.Context, key string) *redis.StringCmd {
+	if e := c.lookup(key); e != nil && e.hasValue {
+		atomic.AddUint64(&c.hits, 1)
+		return redis.NewStringResult(e.value, nil)
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	token := c.beginLoad(key)
+	cmd := c.Redis.Get(ctx, key)
+	var update func(*nearEntry)
+	if cmd.Err() == nil {
+		update = func(e *nearEntry) {
+			e.value = cmd.Val()
+			e.hasValue = true
+		}
+	}
+	c.endLoad(key, token, update)
+	return cmd
+}
+
+func (c *NearCache) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	if e := c.lookup(key); e != nil {
+		if v, ok := e.fields[field]; ok {
+			atomic.AddUint64(&c.hits, 1)
+			return redis.NewStringResult(v, nil)
+		}
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	token := c.beginLoad(key)
+	cmd := c.Redis.HGet(ctx, key, field)
+	var update func(*nearEntry)
+	if cmd.Err() == nil {
+		update = func(e *nearEntry) {
+			fields := make(map[string]string, len(e.fields)+1)
+			for k, v := range e.fields {
+				fields[k] = v
+			}
+			fields[field] = cmd.Val()
+			e.fields = fields
+		}
+	}
+	c.endLoad(key, token, update)
+	return cmd
+}
+
+func (c *NearCache) lookup(key string) *nearEntry {
+	v, err := c.cache.GetIFPresent(key)
+	if err != nil {
+		return nil
+	}
+	return v.(*nearEntry)
+}
+
+// beginLoad 标记key开始从redis加载
+func (c *NearCache) beginLoad(key string) *struct{} {
+	token := &struct{}{}
+	c.mu.Lock()
+	c.loading[key] = token
+	c.mu.Unlock()
+	return token
+}
+
+// endLoad 结束加载，加载期间没有收到失效消息时，将结果写入本地缓存。加载失败时update为nil，只清除加载标记
+func (c *NearCache) endLoad(key string, token *struct{}, update func(*nearEntry)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loading[key] != token {
+		return
+	}
+	delete(c.loading, key)
+	if update == nil {
+		return
+	}
+
+	e := &nearEntry{}
+	if old := c.lookup(key); old != nil {
+		*e = *old
+	}
+	update(e)
+	c.cache.Set(key, e)
+}
+
+func (c *NearCache) invalidate(keys ...string) {
+	c.mu.Lock()
+	for _, key := range keys {
+		delete(c.loading, key)
+		c.cache.Remove(key)
+	}
+	c.mu.Unlock()
+}
+
+// written 在写命令后清除本地缓存，pubsub 模式下同时通知其他实例
+func (c *NearCache) written(ctx context.Context, keys ...string) {
+	c.invalidate(keys...)
+	if c.mode != NearCacheModePubSub {
+		return
+	}
+	for _, key := range keys {
+		if err := c.Redis.Publish(ctx, c.opt.Channel, key).Err(); err != nil {
+			c.logger.Errorf("redis nearcache publish invalidation of %s failed: %s", key, err.Error())
+		}
+	}
+}
+
+// nearCacheHook 在客户端执行写命令后清除对应key的本地缓存，NearCache关闭后不再处理
+type nearCacheHook struct {
+	c *NearCache
+}
+
+func (h nearCacheHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h nearCacheHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.after(ctx, cmd)
+	return nil
+}
+
+func (h nearCacheHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h nearCacheHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	h.after(ctx, cmds...)
+	return nil
+}
+
+func (h nearCacheHook) after(ctx context.Context, cmds ...redis.Cmder) {
+	if atomic.LoadInt32(&h.c.closed) == 1 {
+		return
+	}
+	var keys []string
+	for _, cmd := range cmds {
+		k, all := writtenKeys(cmd)
+		if all {
+			h.c.Purge()
+			continue
+		}
+		keys = append(keys, k...)
+	}
+	if len(keys) > 0 {
+		h.c.written(ctx, keys...)
+	}
+}
+
+// writtenKeys 返回写命令修改的key，FLUSHALL和FLUSHDB时all为true
+func writtenKeys(cmd redis.Cmder) (keys []string, all bool) {
+	args := cmd.Args()
+	arg := func(i int) []string {
+		if i < len(args) {
+			return []string{fmt.Sprint(args[i])}
+		}
+		return nil
+	}
+	switch cmd.Name() {
+	case "set", "setex", "psetex", "setnx", "getset", "getdel", "getex", "append", "setrange", "setbit", "bitfield",
+		"incr", "incrby", "incrbyfloat", "decr", "decrby",
+		"hset", "hsetnx", "hmset", "hdel", "hincrby", "hincrbyfloat",
+		"expire", "pexpire", "expireat", "pexpireat", "persist", "restore", "move",
+		"sunionstore", "sinterstore", "sdiffstore", "zunionstore", "zinterstore", "zdiffstore":
+		return arg(1), false
+	case "del", "unlink":
+		for _, a := range args[1:] {
+			keys = append(keys, fmt.Sprint(a))
+		}
+	case "mset", "msetnx":
+		for i := 1; i < len(args); i += 2 {
+			keys = append(keys, fmt.Sprint(args[i]))
+		}
+	case "rename", "renamenx", "copy":
+		return append(arg(1), arg(2)...), false
+	case "bitop":
+		return arg(2), false
+	case "eval", "evalsha":
+		if len(args) < 3 {
+			return nil, false
+		}
+		n, err := strconv.Atoi(fmt.Sprint(args[2]))
+		if err != nil {
+			return nil, false
+		}
+		for i := 3; i < 3+n && i < len(args); i++ {
+			keys = append(keys, fmt.Sprint(args[i]))
+		}
+	case "flushall", "flushdb":
+		return nil, true
+	}
+	return keys, false
+}
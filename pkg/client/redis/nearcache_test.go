@@ -0,0 +1,160 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearCache_PubSub(t *testing.T) {
+	s, client := newStreamTestClient(t)
+	defer s.Close()
+	defer client.Close()
+
+	// 服务端不支持tracking时自动降级为pubsub
+	c1, err := NewNearCache(client, NewDefaultNearCacheOptions())
+	assert.NoError(t, err)
+	defer c1.Close()
+	assert.Equal(t, NearCacheModePubSub, c1.Mode())
+
+	opt := NewDefaultNearCacheOptions()
+	opt.Mode = NearCacheModePubSub
+	c2, err := NewNearCache(client, opt)
+	assert.NoError(t, err)
+	defer c2.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, c1.Set(ctx, "k1", "v1", 0).Err())
+	assert.NoError(t, c1.HSet(ctx, "h1", "f1", "v1").Err())
+
+	assert.Equal(t, "v1", c2.Get(ctx, "k1").Val())
+	assert.Equal(t, "v1", c2.Get(ctx, "k1").Val())
+	assert.Equal(t, "v1", c2.HGet(ctx, "h1", "f1").Val())
+	assert.Equal(t, "v1", c2.HGet(ctx, "h1", "f1").Val())
+	stats := c2.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 2, stats.Size)
+
+	// 绕过NearCache修改不会通知，本地仍是旧值
+	s.Set("k1", "v2")
+	assert.Equal(t, "v1", c2.Get(ctx, "k1").Val())
+
+	// 通过其他实例修改会通知失效
+	assert.NoError(t, c1.Set(ctx, "k1", "v3", 0).Err())
+	assert.NoError(t, c1.HDel(ctx, "h1", "f1").Err())
+	assert.Eventually(t, func() bool {
+		return c2.Get(ctx, "k1").Val() == "v3"
+	}, time.Second, time.Millisecond*10)
+	assert.Eventually(t, func() bool {
+		return c2.HGet(ctx, "h1", "f1").Err() != nil
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestNearCache_WriteCommands(t *testing.T) {
+	s, client := newStreamTestClient(t)
+	defer s.Close()
+	defer client.Close()
+	other := NewClient(&Options{Name: "other", Addr: []string{s.Addr()}})
+	defer other.Close()
+
+	opt := NewDefaultNearCacheOptions()
+	opt.Mode = NearCacheModePubSub
+	c1, err := NewNearCache(client, opt)
+	assert.NoError(t, err)
+	defer c1.Close()
+	c2, err := NewNearCache(other, opt)
+	assert.NoError(t, err)
+	defer c2.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, c1.MSet(ctx, "n1", 1, "n2", 1).Err())
+	assert.NoError(t, c1.HSet(ctx, "h1", "f1", 1).Err())
+	for _, c := range []*NearCache{c1, c2} {
+		assert.Equal(t, "1", c.Get(ctx, "n1").Val())
+		assert.Equal(t, "1", c.Get(ctx, "n2").Val())
+		assert.Equal(t, "1", c.HGet(ctx, "h1", "f1").Val())
+	}
+
+	// 同一实例的写命令立即失效，其他实例通过失效消息失效
+	assert.NoError(t, c1.Incr(ctx, "n1").Err())
+	assert.NoError(t, c1.MSet(ctx, "n2", 3).Err())
+	assert.NoError(t, c1.HIncrBy(ctx, "h1", "f1", 2).Err())
+	assert.Equal(t, "2", c1.Get(ctx, "n1").Val())
+	assert.Equal(t, "3", c1.Get(ctx, "n2").Val())
+	assert.Equal(t, "3", c1.HGet(ctx, "h1", "f1").Val())
+	assert.Eventually(t, func() bool {
+		return c2.Get(ctx, "n1").Val() == "2" && c2.Get(ctx, "n2").Val() == "3" && c2.HGet(ctx, "h1", "f1").Val() == "3"
+	}, time.Second, time.Millisecond*10)
+
+	// 直接使用底层客户端、pipeline和EVAL的写命令同样会失效
+	assert.NoError(t, client.IncrBy(ctx, "n1", 2).Err())
+	_, err = client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Append(ctx, "n2", "0")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Eval(ctx, `return redis.call("HSET", KEYS[1], "f1", 5)`, []string{"h1"}).Err())
+	assert.Equal(t, "4", c1.Get(ctx, "n1").Val())
+	assert.Equal(t, "30", c1.Get(ctx, "n2").Val())
+	assert.Equal(t, "5", c1.HGet(ctx, "h1", "f1").Val())
+	assert.Eventually(t, func() bool {
+		return c2.Get(ctx, "n1").Val() == "4" && c2.Get(ctx, "n2").Val() == "30" && c2.HGet(ctx, "h1", "f1").Val() == "5"
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestNearCache_MissNotLeak(t *testing.T) {
+	s, client := newStreamTestClient(t)
+	defer s.Close()
+	defer client.Close()
+
+	opt := NewDefaultNearCacheOptions()
+	opt.Mode = NearCacheModePubSub
+	c, err := NewNearCache(client, opt)
+	assert.NoError(t, err)
+	defer c.Close()
+
+	// 未命中和出错时也要清除加载标记
+	ctx := context.Background()
+	assert.Equal(t, redis.Nil, c.Get(ctx, "none").Err())
+	assert.Equal(t, redis.Nil, c.HGet(ctx, "none", "f1").Err())
+	c.mu.Lock()
+	assert.Empty(t, c.loading)
+	c.mu.Unlock()
+	assert.Equal(t, 0, c.Stats().Size)
+}
+
+func TestNearCache_Check(t *testing.T) {
+	_, err := NewNearCache(nil, NewDefaultNearCacheOptions())
+	assert.Error(t, err)
+
+	s, client := newStreamTestClient(t)
+	defer s.Close()
+	defer client.Close()
+
+	opt := NewDefaultNearCacheOptions()
+	opt.Mode = NearCacheModeTracking
+	_, err = NewNearCache(client, opt)
+	assert.Error(t, err)
+
+	opt.Mode = "unknown"
+	_, err = NewNearCache(client, opt)
+	assert.Error(t, err)
+}
@@ -15,6 +15,7 @@
 package redis
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -61,6 +62,13 @@ type Options struct {
 	// 该字段用来兼容旧项目，非特殊情况请勿设置成true，否则在MasterNames顺序变化时会造成分配rehash
 	AutoGenShardName bool
 
+	// 是否将只读命令路由到sentinel发现的replica，只当sharded_sentinel 类型使用。
+	// replica存在复制延迟，对一致性要求高的读请勿开启
+	ReadFromReplicas bool
+
+	// 向sentinel核对master和replica地址的间隔，默认10s，只当sharded_sentinel 类型使用
+	SentinelCheckInterval time.Duration
+
 	// 用于认证的用户名
 	Username string
 
@@ -164,6 +172,27 @@ func GetClient(name string) Redis {
 	return nil
 }
 
+// Subscribe 使用客户端订阅频道，客户端一般通过GetClient获取，不支持sharded_sentinel类型
+func Subscribe(ctx context.Context, client Redis, channels ...string) (*redis.PubSub, error) {
+	if container, ok := client.(*redisContainer); ok {
+		client = container.Redis
+	}
+	s, ok := client.(subscriber)
+	if !ok {
+		return nil, errors.New("redis client does not support subscribe")
+	}
+	return s.Subscribe(ctx, channels...), nil
+}
+
+// SupportsPubSub 判断客户端是否支持pub/sub，sharded_sentinel类型不支持
+func SupportsPubSub(client Redis) bool {
+	if container, ok := client.(*redisContainer); ok {
+		client = container.Redis
+	}
+	_, ok := client.(subscriber)
+	return ok
+}
+
 func StopAll() {
 	for name, client := range redisClients {
 		client.Close()
@@ -176,4 +205,14 @@ type redisContainer struct {
 	Redis
 	opt       Options
 	redisType string
+
+	// shardedSentinel 只在sharded_sentinel类型时存在，用于查询切换事件
+	shardedSentinel *ShardedSentinelClient
+}
+
+func (c *redisContainer) Close() error {
+	if c.shardedSentinel != nil {
+		c.shardedSentinel.close()
+	}
+	return c.Redis.Close()
 }
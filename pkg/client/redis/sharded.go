@@ -20,6 +20,7 @@ import (
 	"regexp"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 	_ "unsafe"
 
@@ -102,9 +103,11 @@ type ShardedClient struct {
 func (c *ShardedClient) Close() error {
 	var mulerr error
 	for _, r := range c.getAllShards() {
-		err := r.client.Close()
-		if err != nil {
-			mulerr = multierror.Append(mulerr, err)
+		for _, client := range r.clients() {
+			err := client.Close()
+			if err != nil {
+				mulerr = multierror.Append(mulerr, err)
+			}
 		}
 	}
 	return mulerr
@@ -204,14 +207,14 @@ func (c *ShardedClient) Unlink(ctx context.Context, keys ...string) *redis.IntCm
 	return client.Unlink(ctx, keys[0])
 }
 func (c *ShardedClient) Dump(ctx context.Context, key string) *redis.StringCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.Dump(ctx, key)
 }
 func (c *ShardedClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
 	if len(keys) != 1 {
 		panic("the length of keys must be equal to 1")
 	}
-	client := c.getShard(keys[0])
+	client := c.getReadShard(keys[0])
 	return client.Exists(ctx, keys[0])
 }
 func (c *ShardedClient) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
@@ -258,7 +261,7 @@ func (c *ShardedClient) PExpireAt(ctx context.Context, key string, tm time.Time)
 	return client.PExpireAt(ctx, key, tm)
 }
 func (c *ShardedClient) PTTL(ctx context.Context, key string) *redis.DurationCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.PTTL(ctx, key)
 }
 func (c *ShardedClient) RandomKey(ctx context.Context) *redis.StringCmd {
@@ -300,11 +303,11 @@ func (c *ShardedClient) Touch(ctx context.Context, keys ...string) *redis.IntCmd
 	return client.Touch(ctx, keys[0])
 }
 func (c *ShardedClient) TTL(ctx context.Context, key string) *redis.DurationCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.TTL(ctx, key)
 }
 func (c *ShardedClient) Type(ctx context.Context, key string) *redis.StatusCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.Type(ctx, key)
 }
 func (c *ShardedClient) Append(ctx context.Context, key, value string) *redis.IntCmd {
@@ -320,11 +323,11 @@ func (c *ShardedClient) DecrBy(ctx context.Context, key string, decrement int64)
 	return client.DecrBy(ctx, key, decrement)
 }
 func (c *ShardedClient) Get(ctx context.Context, key string) *redis.StringCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.Get(ctx, key)
 }
 func (c *ShardedClient) GetRange(ctx context.Context, key string, start, end int64) *redis.StringCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.GetRange(ctx, key, start, end)
 }
 func (c *ShardedClient) GetSet(ctx context.Context, key string, value interface{}) *redis.StringCmd {
@@ -347,7 +350,7 @@ func (c *ShardedClient) MGet(ctx context.Context, keys ...string) *redis.SliceCm
 	if len(keys) != 1 {
 		panic("the length of keys must be equal to 1")
 	}
-	client := c.getShard(keys[0])
+	client := c.getReadShard(keys[0])
 	return client.MGet(ctx, keys[0])
 }
 func (c *ShardedClient) MSet(ctx context.Context, values ...interface{}) *redis.StatusCmd {
@@ -377,11 +380,11 @@ func (c *ShardedClient) SetRange(ctx context.Context, key string, offset int64,
 	return client.SetRange(ctx, key, offset, value)
 }
 func (c *ShardedClient) StrLen(ctx context.Context, key string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.StrLen(ctx, key)
 }
 func (c *ShardedClient) GetBit(ctx context.Context, key string, offset int64) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.GetBit(ctx, key, offset)
 }
 func (c *ShardedClient) SetBit(ctx context.Context, key string, offset int64, value int) *redis.IntCmd {
@@ -389,7 +392,7 @@ func (c *ShardedClient) SetBit(ctx context.Context, key string, offset int64, va
 	return client.SetBit(ctx, key, offset, value)
 }
 func (c *ShardedClient) BitCount(ctx context.Context, key string, bitCount *redis.BitCount) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.BitCount(ctx, key, bitCount)
 }
 func (c *ShardedClient) BitOpAnd(ctx context.Context, destKey string, keys ...string) *redis.IntCmd {
@@ -418,7 +421,7 @@ func (c *ShardedClient) BitOpNot(ctx context.Context, destKey string, key string
 	return client.BitOpNot(ctx, destKey, key)
 }
 func (c *ShardedClient) BitPos(ctx context.Context, key string, bit int64, pos ...int64) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.BitPos(ctx, key, bit, pos...)
 }
 func (c *ShardedClient) BitField(ctx context.Context, key string, args ...interface{}) *redis.IntSliceCmd {
@@ -429,15 +432,15 @@ func (c *ShardedClient) Scan(ctx context.Context, cursor uint64, match string, c
 	panic("unsupport method..")
 }
 func (c *ShardedClient) SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.SScan(ctx, key, cursor, match, count)
 }
 func (c *ShardedClient) HScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HScan(ctx, key, cursor, match, count)
 }
 func (c *ShardedClient) ZScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZScan(ctx, key, cursor, match, count)
 }
 func (c *ShardedClient) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
@@ -445,15 +448,15 @@ func (c *ShardedClient) HDel(ctx context.Context, key string, fields ...string)
 	return client.HDel(ctx, key, fields...)
 }
 func (c *ShardedClient) HExists(ctx context.Context, key, field string) *redis.BoolCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HExists(ctx, key, field)
 }
 func (c *ShardedClient) HGet(ctx context.Context, key, field string) *redis.StringCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HGet(ctx, key, field)
 }
 func (c *ShardedClient) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HGetAll(ctx, key)
 }
 func (c *ShardedClient) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
@@ -465,15 +468,15 @@ func (c *ShardedClient) HIncrByFloat(ctx context.Context, key, field string, inc
 	return client.HIncrByFloat(ctx, key, field, incr)
 }
 func (c *ShardedClient) HKeys(ctx context.Context, key string) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HKeys(ctx, key)
 }
 func (c *ShardedClient) HLen(ctx context.Context, key string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HLen(ctx, key)
 }
 func (c *ShardedClient) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HMGet(ctx, key, fields...)
 }
 func (c *ShardedClient) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
@@ -489,7 +492,7 @@ func (c *ShardedClient) HSetNX(ctx context.Context, key, field string, value int
 	return client.HSetNX(ctx, key, field, value)
 }
 func (c *ShardedClient) HVals(ctx context.Context, key string) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.HVals(ctx, key)
 }
 func (c *ShardedClient) BLPop(ctx context.Context, timeout time.Duration, keys ...string) *redis.StringSliceCmd {
@@ -510,7 +513,7 @@ func (c *ShardedClient) BRPopLPush(ctx context.Context, source, destination stri
 	panic("unsupport method..")
 }
 func (c *ShardedClient) LIndex(ctx context.Context, key string, index int64) *redis.StringCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.LIndex(ctx, key, index)
 }
 func (c *ShardedClient) LInsert(ctx context.Context, key, op string, pivot, value interface{}) *redis.IntCmd {
@@ -526,7 +529,7 @@ func (c *ShardedClient) LInsertAfter(ctx context.Context, key string, pivot, val
 	return client.LInsertAfter(ctx, key, pivot, value)
 }
 func (c *ShardedClient) LLen(ctx context.Context, key string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.LLen(ctx, key)
 }
 func (c *ShardedClient) LPop(ctx context.Context, key string) *redis.StringCmd {
@@ -542,7 +545,7 @@ func (c *ShardedClient) LPushX(ctx context.Context, key string, values ...interf
 	return client.LPushX(ctx, key, values...)
 }
 func (c *ShardedClient) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.LRange(ctx, key, start, stop)
 }
 func (c *ShardedClient) LRem(ctx context.Context, key string, count int64, value interface{}) *redis.IntCmd {
@@ -577,7 +580,7 @@ func (c *ShardedClient) SAdd(ctx context.Context, key string, members ...interfa
 	return client.SAdd(ctx, key, members...)
 }
 func (c *ShardedClient) SCard(ctx context.Context, key string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.SCard(ctx, key)
 }
 func (c *ShardedClient) SDiff(ctx context.Context, keys ...string) *redis.StringSliceCmd {
@@ -609,15 +612,15 @@ func (c *ShardedClient) SInterStore(ctx context.Context, destination string, key
 	return client.SInterStore(ctx, destination, keys[0])
 }
 func (c *ShardedClient) SIsMember(ctx context.Context, key string, member interface{}) *redis.BoolCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.SIsMember(ctx, key, member)
 }
 func (c *ShardedClient) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.SMembers(ctx, key)
 }
 func (c *ShardedClient) SMembersMap(ctx context.Context, key string) *redis.StringStructMapCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.SMembersMap(ctx, key)
 }
 func (c *ShardedClient) SMove(ctx context.Context, source, destination string, member interface{}) *redis.BoolCmd {
@@ -632,11 +635,11 @@ func (c *ShardedClient) SPopN(ctx context.Context, key string, count int64) *red
 	return client.SPopN(ctx, key, count)
 }
 func (c *ShardedClient) SRandMember(ctx context.Context, key string) *redis.StringCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.SRandMember(ctx, key)
 }
 func (c *ShardedClient) SRandMemberN(ctx context.Context, key string, count int64) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.SRandMemberN(ctx, key, count)
 }
 func (c *ShardedClient) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
@@ -658,64 +661,99 @@ func (c *ShardedClient) SUnionStore(ctx context.Context, destination string, key
 	return client.SUnionStore(ctx, destination, keys[0])
 }
 func (c *ShardedClient) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
-	panic("unsupport method..")
+	client := c.getShard(a.Stream)
+	return client.XAdd(ctx, a)
 }
 func (c *ShardedClient) XDel(ctx context.Context, stream string, ids ...string) *redis.IntCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XDel(ctx, stream, ids...)
 }
 func (c *ShardedClient) XLen(ctx context.Context, stream string) *redis.IntCmd {
-	panic("unsupport method..")
+	client := c.getReadShard(stream)
+	return client.XLen(ctx, stream)
 }
 func (c *ShardedClient) XRange(ctx context.Context, stream, start, stop string) *redis.XMessageSliceCmd {
-	panic("unsupport method..")
+	client := c.getReadShard(stream)
+	return client.XRange(ctx, stream, start, stop)
 }
 func (c *ShardedClient) XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd {
-	panic("unsupport method..")
+	client := c.getReadShard(stream)
+	return client.XRangeN(ctx, stream, start, stop, count)
 }
 func (c *ShardedClient) XRevRange(ctx context.Context, stream string, start, stop string) *redis.XMessageSliceCmd {
-	panic("unsupport method..")
+	client := c.getReadShard(stream)
+	return client.XRevRange(ctx, stream, start, stop)
 }
 func (c *ShardedClient) XRevRangeN(ctx context.Context, stream string, start, stop string, count int64) *redis.XMessageSliceCmd {
-	panic("unsupport method..")
+	client := c.getReadShard(stream)
+	return client.XRevRangeN(ctx, stream, start, stop, count)
 }
 func (c *ShardedClient) XRead(ctx context.Context, a *redis.XReadArgs) *redis.XStreamSliceCmd {
-	panic("unsupport method..")
+	client, err := c.getStreamsShard(a.Streams)
+	if err != nil {
+		cmd := redis.NewXStreamSliceCmd(ctx)
+		cmd.SetErr(err)
+		return cmd
+	}
+	return client.XRead(ctx, a)
 }
 func (c *ShardedClient) XReadStreams(ctx context.Context, streams ...string) *redis.XStreamSliceCmd {
-	panic("unsupport method..")
+	client, err := c.getStreamsShard(streams)
+	if err != nil {
+		cmd := redis.NewXStreamSliceCmd(ctx)
+		cmd.SetErr(err)
+		return cmd
+	}
+	return client.XReadStreams(ctx, streams...)
 }
 func (c *ShardedClient) XGroupCreate(ctx context.Context, stream, group, start string) *redis.StatusCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XGroupCreate(ctx, stream, group, start)
 }
 func (c *ShardedClient) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XGroupCreateMkStream(ctx, stream, group, start)
 }
 func (c *ShardedClient) XGroupSetID(ctx context.Context, stream, group, start string) *redis.StatusCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XGroupSetID(ctx, stream, group, start)
 }
 func (c *ShardedClient) XGroupDestroy(ctx context.Context, stream, group string) *redis.IntCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XGroupDestroy(ctx, stream, group)
 }
 func (c *ShardedClient) XGroupDelConsumer(ctx context.Context, stream, group, consumer string) *redis.IntCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XGroupDelConsumer(ctx, stream, group, consumer)
 }
 func (c *ShardedClient) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
-	panic("unsupport method..")
+	client, err := c.getStreamsShard(a.Streams)
+	if err != nil {
+		cmd := redis.NewXStreamSliceCmd(ctx)
+		cmd.SetErr(err)
+		return cmd
+	}
+	return client.XReadGroup(ctx, a)
 }
 func (c *ShardedClient) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XAck(ctx, stream, group, ids...)
 }
 func (c *ShardedClient) XPending(ctx context.Context, stream, group string) *redis.XPendingCmd {
-	panic("unsupport method..")
+	client := c.getShard(stream)
+	return client.XPending(ctx, stream, group)
 }
 func (c *ShardedClient) XPendingExt(ctx context.Context, a *redis.XPendingExtArgs) *redis.XPendingExtCmd {
-	panic("unsupport method..")
+	client := c.getShard(a.Stream)
+	return client.XPendingExt(ctx, a)
 }
 func (c *ShardedClient) XClaim(ctx context.Context, a *redis.XClaimArgs) *redis.XMessageSliceCmd {
-	panic("unsupport method..")
+	client := c.getShard(a.Stream)
+	return client.XClaim(ctx, a)
 }
 func (c *ShardedClient) XClaimJustID(ctx context.Context, a *redis.XClaimArgs) *redis.StringSliceCmd {
-	panic("unsupport method..")
+	client := c.getShard(a.Stream)
+	return client.XClaimJustID(ctx, a)
 }
 func (c *ShardedClient) XTrim(ctx context.Context, key string, maxLen int64) *redis.IntCmd {
 	client := c.getShard(key)
@@ -784,15 +822,15 @@ func (c *ShardedClient) ZIncrXX(ctx context.Context, key string, member *redis.Z
 	return client.ZIncrXX(ctx, key, member)
 }
 func (c *ShardedClient) ZCard(ctx context.Context, key string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZCard(ctx, key)
 }
 func (c *ShardedClient) ZCount(ctx context.Context, key, min, max string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZCount(ctx, key, min, max)
 }
 func (c *ShardedClient) ZLexCount(ctx context.Context, key, min, max string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZLexCount(ctx, key, min, max)
 }
 func (c *ShardedClient) ZIncrBy(ctx context.Context, key string, increment float64, member string) *redis.FloatCmd {
@@ -811,27 +849,27 @@ func (c *ShardedClient) ZPopMin(ctx context.Context, key string, count ...int64)
 	return client.ZPopMin(ctx, key, count...)
 }
 func (c *ShardedClient) ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRange(ctx, key, start, stop)
 }
 func (c *ShardedClient) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRangeWithScores(ctx, key, start, stop)
 }
 func (c *ShardedClient) ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRangeByScore(ctx, key, opt)
 }
 func (c *ShardedClient) ZRangeByLex(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRangeByLex(ctx, key, opt)
 }
 func (c *ShardedClient) ZRangeByScoreWithScores(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.ZSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRangeByScoreWithScores(ctx, key, opt)
 }
 func (c *ShardedClient) ZRank(ctx context.Context, key, member string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRank(ctx, key, member)
 }
 func (c *ShardedClient) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
@@ -851,31 +889,31 @@ func (c *ShardedClient) ZRemRangeByLex(ctx context.Context, key, min, max string
 	return client.ZRemRangeByLex(ctx, key, min, max)
 }
 func (c *ShardedClient) ZRevRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRevRange(ctx, key, start, stop)
 }
 func (c *ShardedClient) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRevRangeWithScores(ctx, key, start, stop)
 }
 func (c *ShardedClient) ZRevRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRevRangeByScore(ctx, key, opt)
 }
 func (c *ShardedClient) ZRevRangeByLex(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRevRangeByLex(ctx, key, opt)
 }
 func (c *ShardedClient) ZRevRangeByScoreWithScores(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.ZSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRevRangeByScoreWithScores(ctx, key, opt)
 }
 func (c *ShardedClient) ZRevRank(ctx context.Context, key, member string) *redis.IntCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZRevRank(ctx, key, member)
 }
 func (c *ShardedClient) ZScore(ctx context.Context, key, member string) *redis.FloatCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.ZScore(ctx, key, member)
 }
 func (c *ShardedClient) ZUnionStore(ctx context.Context, dest string, store *redis.ZStore) *redis.IntCmd {
@@ -1086,7 +1124,7 @@ func (c *ShardedClient) GeoAdd(ctx context.Context, key string, geoLocation ...*
 	return client.GeoAdd(ctx, key, geoLocation...)
 }
 func (c *ShardedClient) GeoPos(ctx context.Context, key string, members ...string) *redis.GeoPosCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.GeoPos(ctx, key, members...)
 }
 func (c *ShardedClient) GeoRadius(ctx context.Context, key string, longitude, latitude float64, query *redis.GeoRadiusQuery) *redis.GeoLocationCmd {
@@ -1106,16 +1144,18 @@ func (c *ShardedClient) GeoRadiusByMemberStore(ctx context.Context, key, member
 	return client.GeoRadiusByMemberStore(ctx, key, member, query)
 }
 func (c *ShardedClient) GeoDist(ctx context.Context, key string, member1, member2, unit string) *redis.FloatCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.GeoDist(ctx, key, member1, member2, unit)
 }
 func (c *ShardedClient) GeoHash(ctx context.Context, key string, members ...string) *redis.StringSliceCmd {
-	client := c.getShard(key)
+	client := c.getReadShard(key)
 	return client.GeoHash(ctx, key, members...)
 }
 
 //---------------------------------------------------
 func (c *ShardedClient) getAllShards() []*ShardInfo {
+	c.RLock()
+	defer c.RUnlock()
 	sis := make([]*ShardInfo, 0, len(c.resources))
 	for _, v := range c.resources {
 		sis = append(sis, v)
@@ -1128,6 +1168,37 @@ func (c *ShardedClient) getShard(key string) Redis {
 	return info.client
 }
 
+// getStreamsShard 返回XREAD的streams（stream和id各占一半）所在分片的客户端，参数不成对或stream跨分片时返回错误
+func (c *ShardedClient) getStreamsShard(streams []string) (Redis, error) {
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		return nil, fmt.Errorf("streams must be pairs of stream and id: %v", streams)
+	}
+	n := len(streams) / 2
+	info := c.getShardInfo(streams[0])
+	for _, stream := range streams[1:n] {
+		if c.getShardInfo(stream) != info {
+			return nil, fmt.Errorf("streams %v are not in the same shard", streams[:n])
+		}
+	}
+	return info.client, nil
+}
+
+// getReadShard 返回只读命令使用的客户端，分片存在replica时轮询选择replica
+func (c *ShardedClient) getReadShard(key string) Redis {
+	info := c.getShardInfo(key)
+	if len(info.replicas) == 0 {
+		return info.client
+	}
+	n := atomic.AddUint32(&info.next, 1)
+	return info.replicas[n%uint32(len(info.replicas))]
+}
+
+func (c *ShardedClient) getShardByID(id string) *ShardInfo {
+	c.RLock()
+	defer c.RUnlock()
+	return c.resources[id]
+}
+
 func (c *ShardedClient) getShardInfo(key string) *ShardInfo {
 	c.RLock()
 	defer c.RUnlock()
@@ -1144,17 +1215,27 @@ func (c *ShardedClient) getShardInfo(key string) *ShardInfo {
 	return c.nodes[c.sortedHashes[idx]]
 }
 
+// ChangeShardInfo 替换分片信息，不再被使用的旧客户端会被关闭
 func (c *ShardedClient) ChangeShardInfo(id string, si *ShardInfo) {
 	c.Lock()
-	defer c.Unlock()
-	old := c.resources[id]
+	old, ok := c.resources[id]
+	if !ok {
+		c.Unlock()
+		return
+	}
 	c.resources[id] = si
 	for k, v := range c.nodes {
 		if v == old {
 			c.nodes[k] = si
 		}
 	}
-	old.client.Close()
+	c.Unlock()
+
+	for _, client := range old.clients() {
+		if !si.contains(client) {
+			client.Close()
+		}
+	}
 }
 
 func (c *ShardedClient) getKeyTag(key string) string {
@@ -1172,6 +1253,23 @@ type ShardInfo struct {
 	name   string
 	client Redis
 	weight int
+
+	// replicas 只用于只读命令
+	replicas []Redis
+	next     uint32
+}
+
+func (si *ShardInfo) clients() []Redis {
+	return append([]Redis{si.client}, si.replicas...)
+}
+
+func (si *ShardInfo) contains(client Redis) bool {
+	for _, r := range si.clients() {
+		if r == client {
+			return true
+		}
+	}
+	return false
 }
 
 type Hashing interface {
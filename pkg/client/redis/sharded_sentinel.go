@@ -18,59 +18,68 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	switchMasterChannel = "+switch-master"
+
+	// 默认的master地址核对间隔
+	defaultSentinelCheckInterval = time.Second * 10
+
+	minResubscribeBackoff = time.Millisecond * 100
+	maxResubscribeBackoff = time.Second * 5
+
+	sentinelQueryTimeout = time.Second * 3
+)
+
+// NewShardedSentinelClient 创建哨兵分片客户端。
+// 启动时无法解析的master不会panic，该分片的命令会返回错误，直到后台核对任务解析到地址
 func NewShardedSentinelClient(opt *Options) *redisContainer {
-	sentinels := make(map[string]*redis.SentinelClient, len(opt.Addr))
-	masterAddrs := make(map[string]string, len(opt.Addr))
+	ctx, cancel := context.WithCancel(context.Background())
 	ssc := &ShardedSentinelClient{
-		opt:         opt,
-		sentinels:   sentinels,
-		masterNames: opt.MasterNames,
-		masterAddrs: masterAddrs,
+		opt:          opt,
+		sentinels:    make(map[string]*redis.SentinelClient, len(opt.Addr)),
+		masterNames:  opt.MasterNames,
+		masterAddrs:  make(map[string]string, len(opt.MasterNames)),
+		replicaAddrs: make(map[string][]string, len(opt.MasterNames)),
+		ctx:          ctx,
+		cancel:       cancel,
 	}
-
-	ctx := context.Background()
 	for i := range opt.Addr {
-		sentinels[opt.Addr[i]] = redis.NewSentinelClient(sentinelOptions(opt, opt.Addr[i]))
+		ssc.sentinels[opt.Addr[i]] = redis.NewSentinelClient(sentinelOptions(opt, opt.Addr[i]))
 	}
 
 	sis := make([]*ShardInfo, 0, len(opt.MasterNames))
 	for _, name := range opt.MasterNames {
-		var addr string
-		for i := range opt.Addr {
-			sentinel := sentinels[opt.Addr[i]]
-			masterAddr, err := sentinel.GetMasterAddrByName(ctx, name).Result()
-			if err != nil {
-				log.Errorf("sentinel: GetMasterAddrByName master=%s failed: %s",
-					name, err)
-				continue
-			}
-			addr = net.JoinHostPort(masterAddr[0], masterAddr[1])
-			masterAddrs[name] = addr
-			break
+		si := &ShardInfo{
+			id:     name,
+			name:   ssc.shardName(name),
+			weight: 1,
 		}
-
-		if len(addr) == 0 {
-			panic(fmt.Sprintf("sentinel: GetMasterAddrByName master=%s all failed", name))
+		addr, err := ssc.resolveMaster(name)
+		if err != nil {
+			log.Errorf("sentinel: resolve master=%s failed: %s", name, err)
+			si.client = newUnresolvedClient(opt, name)
+		} else {
+			si.client = NewClient(clientOptions(opt, addr))
+			ssc.masterAddrs[name] = addr
 		}
-		tmp := clientOptions(opt, addr)
-		shardName := name
-		// 兼容旧分片名称规则，避免线上rehash
-		if opt.AutoGenShardName {
-			shardName = ""
+		if opt.ReadFromReplicas {
+			addrs, err := ssc.resolveReplicas(name)
+			if err != nil {
+				log.Errorf("sentinel: resolve replicas of master=%s failed: %s", name, err)
+			}
+			si.replicas = ssc.replicaClients(addrs, nil)
+			ssc.replicaAddrs[name] = addrs
 		}
-		sis = append(sis, &ShardInfo{
-			id:     name,
-			name:   shardName,
-			client: NewClient(tmp),
-			weight: 1,
-		})
+		sis = append(sis, si)
 	}
 
 	baseClient := NewShardedClient(sis)
@@ -80,66 +89,336 @@ func NewShardedSentinelClient(opt *Options) *redisContainer {
 		redisType: RedisTypeShardedSentinel,
 	}
 	ssc.c = c
-	go ssc.listen(ctx)
+	c.shardedSentinel = ssc
+	for addr, sentinel := range ssc.sentinels {
+		ssc.wg.Add(1)
+		go ssc.subscribe(addr, sentinel)
+	}
+	ssc.wg.Add(1)
+	go ssc.check()
 	return c
 }
 
 type ShardedSentinelClient struct {
-	opt         *Options
-	sentinels   map[string]*redis.SentinelClient
-	masterNames []string
-	masterAddrs map[string]string
+	opt          *Options
+	sentinels    map[string]*redis.SentinelClient
+	masterNames  []string
+	masterAddrs  map[string]string
+	replicaAddrs map[string][]string
+	events       []SwitchMasterEvent
 	sync.Mutex
 
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
 	c *redisContainer
 }
 
-func (ssc *ShardedSentinelClient) listen(ctx context.Context) {
-	for k, v := range ssc.sentinels {
-		if v == nil {
-			ssc.sentinels[k] = redis.NewSentinelClient(sentinelOptions(ssc.opt, k))
-		}
-		pubsub := ssc.sentinels[k].Subscribe(ctx, "+switch-master")
-		go func(pubsub *redis.PubSub) {
-			ch := pubsub.Channel()
-			for msg := range ch {
-				if msg.Channel == "+switch-master" {
-					parts := strings.Split(msg.Payload, " ")
-					masterName := parts[0]
-					if _, exists := Find(ssc.masterNames, masterName); !exists {
-						log.Warnf("sentinel: ignore addr for master=%q", parts[0])
-						continue
-					}
-					addr := net.JoinHostPort(parts[3], parts[4])
-
-					ssc.Lock()
-					if ssc.masterAddrs[masterName] == addr {
-						log.Warnf("sentinel: addr for master=%q is not change", parts[0])
-						ssc.Unlock()
-						continue
-					}
-
-					client := ssc.c.Redis.(*ShardedClient)
-					shardName := masterName
-					// 兼容旧分片名称规则，避免线上rehash
-					if ssc.opt.AutoGenShardName {
-						shardName = ""
-					}
-					client.ChangeShardInfo(masterName, &ShardInfo{
-						id:     masterName,
-						name:   shardName,
-						client: NewClient(clientOptions(ssc.opt, addr)),
-						weight: 1,
-					})
-					log.Infof("sentinel: switch master \"%v\"", msg.Payload)
-					ssc.masterAddrs[masterName] = addr
-					ssc.Unlock()
-				}
+// subscribe 订阅sentinel的+switch-master事件，连接断开后按指数退避重新订阅
+func (ssc *ShardedSentinelClient) subscribe(addr string, sentinel *redis.SentinelClient) {
+	defer ssc.wg.Done()
+	backoff := minResubscribeBackoff
+	for ssc.ctx.Err() == nil {
+		pubsub := sentinel.Subscribe(ssc.ctx, switchMasterChannel)
+		var err error
+		for {
+			var msg *redis.Message
+			msg, err = pubsub.ReceiveMessage(ssc.ctx)
+			if err != nil {
+				break
+			}
+			backoff = minResubscribeBackoff
+			if msg.Channel == switchMasterChannel {
+				ssc.onSwitchMaster(msg.Payload)
 			}
-		}(pubsub)
+		}
+		pubsub.Close()
+		if ssc.ctx.Err() != nil {
+			return
+		}
+
+		log.Warnf("sentinel: subscription to %s dropped: %s, resubscribe after %s", addr, err, backoff)
+		ssc.sleep(backoff)
+		backoff *= 2
+		if backoff > maxResubscribeBackoff {
+			backoff = maxResubscribeBackoff
+		}
+		// 断开期间可能错过了切换事件
+		ssc.reconcile()
+	}
+}
+
+func (ssc *ShardedSentinelClient) onSwitchMaster(payload string) {
+	// 格式为 <master name> <old ip> <old port> <new ip> <new port>
+	parts := strings.Split(payload, " ")
+	if len(parts) < 5 {
+		log.Warnf("sentinel: invalid switch-master payload %q", payload)
+		return
+	}
+	masterName := parts[0]
+	if _, exists := Find(ssc.masterNames, masterName); !exists {
+		log.Warnf("sentinel: ignore addr for master=%q", masterName)
+		return
+	}
+	log.Infof("sentinel: switch master \"%v\"", payload)
+	ssc.switchMaster(masterName, net.JoinHostPort(parts[3], parts[4]))
+	if ssc.opt.ReadFromReplicas {
+		ssc.refreshReplicas(masterName)
+	}
+}
+
+// check 定时向sentinel核对master和replica地址，弥补丢失的事件
+func (ssc *ShardedSentinelClient) check() {
+	defer ssc.wg.Done()
+	interval := ssc.opt.SentinelCheckInterval
+	if interval <= 0 {
+		interval = defaultSentinelCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ssc.ctx.Done():
+			return
+		case <-ticker.C:
+			ssc.reconcile()
+		}
+	}
+}
+
+func (ssc *ShardedSentinelClient) reconcile() {
+	for _, name := range ssc.masterNames {
+		if ssc.ctx.Err() != nil {
+			return
+		}
+		addr, err := ssc.resolveMaster(name)
+		if err != nil {
+			log.Errorf("sentinel: resolve master=%s failed: %s", name, err)
+			continue
+		}
+		ssc.switchMaster(name, addr)
+		if ssc.opt.ReadFromReplicas {
+			ssc.refreshReplicas(name)
+		}
 	}
 }
 
+// switchMaster 将分片切换到新的master地址，旧客户端会被关闭
+func (ssc *ShardedSentinelClient) switchMaster(name, addr string) {
+	ssc.Lock()
+	defer ssc.Unlock()
+	old := ssc.masterAddrs[name]
+	if old == addr {
+		return
+	}
+
+	client := ssc.c.Redis.(*ShardedClient)
+	si := client.getShardByID(name)
+	client.ChangeShardInfo(name, &ShardInfo{
+		id:       name,
+		name:     ssc.shardName(name),
+		client:   NewClient(clientOptions(ssc.opt, addr)),
+		replicas: si.replicas,
+		weight:   1,
+	})
+	log.Infof("sentinel: master=%s changed from %q to %q", name, old, addr)
+	ssc.addEvent(SwitchMasterEvent{
+		MasterName: name,
+		OldAddr:    old,
+		NewAddr:    addr,
+		Time:       time.Now(),
+	})
+	ssc.masterAddrs[name] = addr
+}
+
+func (ssc *ShardedSentinelClient) refreshReplicas(name string) {
+	addrs, err := ssc.resolveReplicas(name)
+	if err != nil {
+		log.Errorf("sentinel: resolve replicas of master=%s failed: %s", name, err)
+		return
+	}
+
+	ssc.Lock()
+	defer ssc.Unlock()
+	if equalStrings(ssc.replicaAddrs[name], addrs) {
+		return
+	}
+
+	client := ssc.c.Redis.(*ShardedClient)
+	si := client.getShardByID(name)
+	client.ChangeShardInfo(name, &ShardInfo{
+		id:       name,
+		name:     si.name,
+		client:   si.client,
+		replicas: ssc.replicaClients(addrs, si.replicas),
+		weight:   si.weight,
+	})
+	log.Infof("sentinel: replicas of master=%s changed to %v", name, addrs)
+	ssc.replicaAddrs[name] = addrs
+}
+
+// resolveMaster 依次向各sentinel查询master地址
+func (ssc *ShardedSentinelClient) resolveMaster(name string) (string, error) {
+	var err error
+	for _, addr := range ssc.opt.Addr {
+		ctx, cancel := context.WithTimeout(ssc.ctx, sentinelQueryTimeout)
+		var masterAddr []string
+		masterAddr, err = ssc.sentinels[addr].GetMasterAddrByName(ctx, name).Result()
+		cancel()
+		if err != nil {
+			continue
+		}
+		return net.JoinHostPort(masterAddr[0], masterAddr[1]), nil
+	}
+	return "", err
+}
+
+// resolveReplicas 查询master下可用的replica地址，已下线或断开的会被过滤
+func (ssc *ShardedSentinelClient) resolveReplicas(name string) ([]string, error) {
+	var err error
+	for _, addr := range ssc.opt.Addr {
+		ctx, cancel := context.WithTimeout(ssc.ctx, sentinelQueryTimeout)
+		var res []interface{}
+		res, err = ssc.sentinels[addr].Slaves(ctx, name).Result()
+		cancel()
+		if err != nil {
+			continue
+		}
+		addrs := parseReplicaAddrs(res)
+		sort.Strings(addrs)
+		return addrs, nil
+	}
+	return nil, err
+}
+
+func parseReplicaAddrs(res []interface{}) []string {
+	addrs := make([]string, 0, len(res))
+	for _, r := range res {
+		fields, ok := r.([]interface{})
+		if !ok {
+			continue
+		}
+		m := make(map[string]string, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			k, _ := fields[i].(string)
+			v, _ := fields[i+1].(string)
+			m[k] = v
+		}
+		if m["ip"] == "" || m["port"] == "" || !replicaAvailable(m["flags"]) {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(m["ip"], m["port"]))
+	}
+	return addrs
+}
+
+func replicaAvailable(flags string) bool {
+	for _, flag := range strings.Split(flags, ",") {
+		switch flag {
+		case "s_down", "o_down", "disconnected":
+			return false
+		}
+	}
+	return true
+}
+
+// replicaClients 为replica地址创建客户端，地址未变化的复用旧客户端
+func (ssc *ShardedSentinelClient) replicaClients(addrs []string, old []Redis) []Redis {
+	if len(addrs) == 0 {
+		return nil
+	}
+	existing := make(map[string]Redis, len(old))
+	for _, r := range old {
+		if c, ok := r.(*redisContainer); ok {
+			existing[c.opt.Addr[0]] = r
+		}
+	}
+	clients := make([]Redis, 0, len(addrs))
+	for _, addr := range addrs {
+		if r, ok := existing[addr]; ok {
+			clients = append(clients, r)
+			continue
+		}
+		clients = append(clients, NewClient(clientOptions(ssc.opt, addr)))
+	}
+	return clients
+}
+
+// newUnresolvedClient 创建未解析到地址的master的占位客户端，所有命令都返回错误
+func newUnresolvedClient(opt *Options, name string) *redisContainer {
+	tmp := clientOptions(opt, "")
+	o := newClientOptions(tmp)
+	o.MaxRetries = -1
+	o.MinIdleConns = 0
+	o.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, fmt.Errorf("sentinel: master=%s is not resolved", name)
+	}
+	baseClient := redis.NewClient(o)
+	c := &redisContainer{
+		Redis:     baseClient,
+		opt:       *tmp,
+		redisType: RedisTypeClient,
+	}
+	baseClient.AddHook(newMetricHook(c))
+	baseClient.AddHook(newTracingHook(c))
+	return c
+}
+
+func (ssc *ShardedSentinelClient) shardName(name string) string {
+	// 兼容旧分片名称规则，避免线上rehash
+	if ssc.opt.AutoGenShardName {
+		return ""
+	}
+	return name
+}
+
+func (ssc *ShardedSentinelClient) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ssc.ctx.Done():
+	case <-t.C:
+	}
+}
+
+// close 停止后台任务并关闭sentinel连接
+func (ssc *ShardedSentinelClient) close() {
+	ssc.cancel()
+	for _, sentinel := range ssc.sentinels {
+		sentinel.Close()
+	}
+	ssc.wg.Wait()
+}
+
+// addEvent 记录切换事件，只保留最近的maxSwitchEvents个，调用方需持有锁
+func (ssc *ShardedSentinelClient) addEvent(e SwitchMasterEvent) {
+	ssc.events = append(ssc.events, e)
+	if len(ssc.events) > maxSwitchEvents {
+		ssc.events = ssc.events[len(ssc.events)-maxSwitchEvents:]
+	}
+}
+
+// SwitchEvents 返回最近的+switch-master事件
+func (ssc *ShardedSentinelClient) SwitchEvents() []SwitchMasterEvent {
+	ssc.Lock()
+	defer ssc.Unlock()
+	events := make([]SwitchMasterEvent, len(ssc.events))
+	copy(events, ssc.events)
+	return events
+}
+
+// MasterAddrs 返回各master当前的地址
+func (ssc *ShardedSentinelClient) MasterAddrs() map[string]string {
+	ssc.Lock()
+	defer ssc.Unlock()
+	addrs := make(map[string]string, len(ssc.masterAddrs))
+	for k, v := range ssc.masterAddrs {
+		addrs[k] = v
+	}
+	return addrs
+}
+
 func sentinelOptions(opt *Options, addr string) *redis.Options {
 	return &redis.Options{
 		Addr:               addr,
@@ -181,6 +460,18 @@ func clientOptions(opt *Options, addr string) *Options {
 	}
 }
 
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func Find(slice []string, val string) (int, bool) {
 	for i, item := range slice {
 		if item == val {
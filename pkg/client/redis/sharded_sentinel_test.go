@@ -15,13 +15,17 @@
 package redis
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -80,3 +84,299 @@ func BenchmarkShardedSentinelClient_Set(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+// fakeSentinel 实现了sentinel的部分命令，用于测试
+type fakeSentinel struct {
+	l        net.Listener
+	mu       sync.Mutex
+	masters  map[string]string
+	replicas map[string][]string
+	conns    map[net.Conn]bool // value为是否订阅
+}
+
+func newFakeSentinel(t *testing.T) *fakeSentinel {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &fakeSentinel{
+		l:        l,
+		masters:  make(map[string]string),
+		replicas: make(map[string][]string),
+		conns:    make(map[net.Conn]bool),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = false
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSentinel) Addr() string {
+	return s.l.Addr().String()
+}
+
+func (s *fakeSentinel) Close() {
+	s.l.Close()
+	s.dropAll()
+}
+
+func (s *fakeSentinel) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *fakeSentinel) subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, sub := range s.conns {
+		if sub {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fakeSentinel) setMaster(name, addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.masters[name] = addr
+}
+
+func (s *fakeSentinel) setReplicas(name string, addrs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replicas[name] = addrs
+}
+
+// switchMaster 修改master地址并发布+switch-master事件
+func (s *fakeSentinel) switchMaster(name, addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldHost, oldPort, _ := net.SplitHostPort(s.masters[name])
+	host, port, _ := net.SplitHostPort(addr)
+	s.masters[name] = addr
+	payload := strings.Join([]string{name, oldHost, oldPort, host, port}, " ")
+	for conn, sub := range s.conns {
+		if sub {
+			writeArray(conn, "message", switchMasterChannel, payload)
+		}
+	}
+}
+
+func (s *fakeSentinel) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		switch strings.ToLower(args[0]) {
+		case "ping":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case "subscribe":
+			s.conns[conn] = true
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		case "sentinel":
+			switch strings.ToLower(args[1]) {
+			case "get-master-addr-by-name":
+				addr, ok := s.masters[args[2]]
+				if !ok {
+					fmt.Fprint(conn, "*-1\r\n")
+					break
+				}
+				host, port, _ := net.SplitHostPort(addr)
+				writeArray(conn, host, port)
+			case "slaves":
+				fmt.Fprintf(conn, "*%d\r\n", len(s.replicas[args[2]]))
+				for _, addr := range s.replicas[args[2]] {
+					host, port, _ := net.SplitHostPort(addr)
+					writeArray(conn, "ip", host, "port", port, "flags", "slave")
+				}
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func writeArray(conn net.Conn, values ...string) {
+	fmt.Fprintf(conn, "*%d\r\n", len(values))
+	for _, v := range values {
+		fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+	}
+}
+
+func TestShardedSentinelClient_SwitchMaster(t *testing.T) {
+	m1, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer m1.Close()
+	m2, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer m2.Close()
+
+	sentinel := newFakeSentinel(t)
+	defer sentinel.Close()
+	sentinel.setMaster("m1", m1.Addr())
+
+	client := NewShardedSentinelClient(&Options{
+		Name:                  "sharded",
+		ConnType:              RedisTypeShardedSentinel,
+		Addr:                  []string{sentinel.Addr()},
+		MasterNames:           []string{"m1"},
+		SentinelCheckInterval: time.Hour,
+	})
+	assert.Eventually(t, func() bool {
+		return sentinel.subscribers() == 1
+	}, time.Second*3, time.Millisecond*10)
+
+	ctx := context.Background()
+	assert.NoError(t, client.Set(ctx, "k1", "v1", 0).Err())
+	v, _ := m1.Get("k1")
+	assert.Equal(t, "v1", v)
+
+	// 通过+switch-master事件切换
+	sentinel.switchMaster("m1", m2.Addr())
+	assert.Eventually(t, func() bool {
+		return client.shardedSentinel.MasterAddrs()["m1"] == m2.Addr()
+	}, time.Second*3, time.Millisecond*10)
+	assert.NoError(t, client.Set(ctx, "k1", "v2", 0).Err())
+	v, _ = m2.Get("k1")
+	assert.Equal(t, "v2", v)
+	events := client.shardedSentinel.SwitchEvents()
+	assert.Len(t, events, 1)
+	assert.Equal(t, m1.Addr(), events[0].OldAddr)
+
+	// 连接断开后重新订阅
+	sentinel.dropAll()
+	assert.Eventually(t, func() bool {
+		return sentinel.subscribers() == 1
+	}, time.Second*3, time.Millisecond*10)
+
+	// 关闭后停止订阅
+	assert.NoError(t, client.Close())
+	assert.Eventually(t, func() bool {
+		return sentinel.subscribers() == 0
+	}, time.Second*3, time.Millisecond*10)
+}
+
+func TestShardedSentinelClient_Unresolved(t *testing.T) {
+	m1, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer m1.Close()
+
+	sentinel := newFakeSentinel(t)
+	defer sentinel.Close()
+
+	// 启动时master无法解析不会panic
+	client := NewShardedSentinelClient(&Options{
+		Name:                  "sharded",
+		ConnType:              RedisTypeShardedSentinel,
+		Addr:                  []string{sentinel.Addr()},
+		MasterNames:           []string{"m1"},
+		SentinelCheckInterval: time.Millisecond * 50,
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	assert.Error(t, client.Set(ctx, "k1", "v1", 0).Err())
+
+	// 后台核对任务解析到地址后恢复
+	sentinel.setMaster("m1", m1.Addr())
+	assert.Eventually(t, func() bool {
+		return client.Set(ctx, "k1", "v1", 0).Err() == nil
+	}, time.Second*3, time.Millisecond*10)
+	v, _ := m1.Get("k1")
+	assert.Equal(t, "v1", v)
+}
+
+func TestShardedSentinelClient_ReadFromReplicas(t *testing.T) {
+	master, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer master.Close()
+	replica, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer replica.Close()
+
+	sentinel := newFakeSentinel(t)
+	defer sentinel.Close()
+	sentinel.setMaster("m1", master.Addr())
+	sentinel.setReplicas("m1", replica.Addr())
+
+	client := NewShardedSentinelClient(&Options{
+		Name:                  "sharded",
+		ConnType:              RedisTypeShardedSentinel,
+		Addr:                  []string{sentinel.Addr()},
+		MasterNames:           []string{"m1"},
+		ReadFromReplicas:      true,
+		SentinelCheckInterval: time.Millisecond * 50,
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	replica.Set("k1", "replica")
+	assert.NoError(t, client.Set(ctx, "k1", "master", 0).Err())
+	v, _ := master.Get("k1")
+	assert.Equal(t, "master", v)
+	assert.Equal(t, "replica", client.Get(ctx, "k1").Val())
+
+	// replica下线后读请求回到master
+	sentinel.setReplicas("m1")
+	assert.Eventually(t, func() bool {
+		return client.Get(ctx, "k1").Val() == "master"
+	}, time.Second*3, time.Millisecond*10)
+
+	info := client.info()
+	assert.Len(t, info.Nodes, 1)
+}
+
+func TestParseReplicaAddrs(t *testing.T) {
+	res := []interface{}{
+		[]interface{}{"ip", "10.0.0.1", "port", "6379", "flags", "slave"},
+		[]interface{}{"ip", "10.0.0.2", "port", "6379", "flags", "s_down,slave"},
+		[]interface{}{"ip", "10.0.0.3", "port", "6379", "flags", "slave,disconnected"},
+	}
+	assert.Equal(t, []string{"10.0.0.1:6379"}, parseReplicaAddrs(res))
+}
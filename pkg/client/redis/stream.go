@@ -0,0 +1,391 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+// StreamMessage 是从redis stream中读取的一条消息
+type StreamMessage struct {
+	Stream string
+	ID     string
+	Values map[string]interface{}
+}
+
+// StreamListener 处理stream消息，与kafka.Listener用法一致
+type StreamListener interface {
+	Listen(StreamMessage, *StreamAcknowledgment)
+}
+
+// StreamConsumerOptions 是stream消费组的配置
+type StreamConsumerOptions struct {
+	// 消费组名称，必须指定
+	Group string
+
+	// 消费者名称，同一消费组内需唯一，默认为 hostname-pid
+	Consumer string
+
+	// 创建消费组时的起始ID，默认为$，即只消费新消息
+	StartID string
+
+	// 每次读取的最大消息数
+	Count int64
+
+	// XREADGROUP的阻塞时间，同时决定了Stop的最长等待时间
+	Block time.Duration
+
+	// 是否在Listen返回后自动XACK，为false时需要调用Acknowledge
+	AutoAck bool
+
+	// 其他消费者的消息空闲超过该时间后会被认领，0表示不认领
+	ClaimIdle time.Duration
+
+	// 检查待认领消息的时间间隔
+	ClaimInterval time.Duration
+}
+
+func NewDefaultStreamConsumerOptions() *StreamConsumerOptions {
+	return &StreamConsumerOptions{
+		StartID:       "$",
+		Count:         10,
+		Block:         time.Second * 2,
+		AutoAck:       true,
+		ClaimIdle:     time.Minute,
+		ClaimInterval: time.Second * 30,
+	}
+}
+
+// StreamConsumer 是基于XREADGROUP的redis stream消费者，
+// 每个stream使用独立的goroutine消费，因此可以用于cluster和sharded_sentinel类型的客户端
+type StreamConsumer struct {
+	client    Redis
+	opt       StreamConsumerOptions
+	logger    *log.NgoLogger
+	listeners map[string]StreamListener
+	ctx       context.Context
+	cancel    func()
+	wg        sync.WaitGroup
+	// handling 记录正在处理的消息，认领时跳过，避免处理较慢的消息被重复处理
+	handling sync.Map
+}
+
+// NewStreamConsumer 用指定的客户端创建stream消费者，客户端一般通过GetClient获取
+func NewStreamConsumer(client Redis, opt *StreamConsumerOptions) (*StreamConsumer, error) {
+	if client == nil {
+		return nil, errors.New("redis client must not be nil")
+	}
+	if opt.Group == "" {
+		return nil, errors.New("empty stream consumer group")
+	}
+	o := *opt
+	if o.Consumer == "" {
+		hostname, _ := os.Hostname()
+		o.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if o.StartID == "" {
+		o.StartID = "$"
+	}
+	if o.Count <= 0 {
+		o.Count = 10
+	}
+	if o.Block <= 0 {
+		o.Block = time.Second * 2
+	}
+	if o.ClaimIdle > 0 && o.ClaimInterval <= 0 {
+		o.ClaimInterval = o.ClaimIdle
+	}
+	return &StreamConsumer{
+		client: client,
+		opt:    o,
+		logger: log.WithFields(
+			"group", o.Group,
+			"consumer", o.Consumer,
+		),
+		listeners: make(map[string]StreamListener, 8),
+	}, nil
+}
+
+func (c *StreamConsumer) Options() StreamConsumerOptions {
+	return c.opt
+}
+
+func (c *StreamConsumer) AddListener(stream string, listener StreamListener) {
+	if len(stream) == 0 {
+		panic("stream must not be empty")
+	}
+	if listener == nil {
+		panic("listener must not be nil")
+	}
+	c.listeners[stream] = listener
+}
+
+// Start 创建消费组并启动后台消费任务
+func (c *StreamConsumer) Start() error {
+	if len(c.listeners) == 0 {
+		panic("empty stream listener")
+	}
+
+	// 当前不允许多个后台消费任务
+	if c.ctx != nil {
+		panic("duplicated start")
+	}
+
+	ctx := context.Background()
+	for stream := range c.listeners {
+		err := c.client.XGroupCreateMkStream(ctx, stream, c.opt.Group, c.opt.StartID).Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	for stream, listener := range c.listeners {
+		c.wg.Add(1)
+		go c.read(stream, listener)
+		if c.opt.ClaimIdle > 0 {
+			c.wg.Add(1)
+			go c.claim(stream, listener)
+		}
+	}
+	c.logger.Info("stream consumer up and running")
+	return nil
+}
+
+// Stop 停止后台消费任务，等待正在处理的消息完成
+func (c *StreamConsumer) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+		c.wg.Wait()
+	}
+}
+
+// Run 启动消费并阻塞至stopping被关闭，可配合server使用：
+//
+//	s.GoAttach(func() { consumer.Run(s.StoppingNotify()) })
+func (c *StreamConsumer) Run(stopping <-chan struct{}) error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	<-stopping
+	c.Stop()
+	return nil
+}
+
+// read 循环读取stream，启动时先处理本消费者未确认的消息
+func (c *StreamConsumer) read(stream string, listener StreamListener) {
+	defer c.wg.Done()
+	id := "0"
+	for c.ctx.Err() == nil {
+		res, err := c.client.XReadGroup(c.ctx, &redis.XReadGroupArgs{
+			Group:    c.opt.Group,
+			Consumer: c.opt.Consumer,
+			Streams:  []string{stream, id},
+			Count:    c.opt.Count,
+			Block:    c.opt.Block,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.logger.Errorf("redis stream %s read failed: %s", stream, err.Error())
+			c.sleep(time.Millisecond * 200) // 睡眠防止异常之后死循环占满CPU
+			continue
+		}
+
+		var messages []redis.XMessage
+		for i := range res {
+			messages = append(messages, res[i].Messages...)
+		}
+		if id != ">" {
+			if len(messages) == 0 {
+				id = ">"
+				continue
+			}
+			id = messages[len(messages)-1].ID
+		}
+		for i := range messages {
+			c.handle(stream, listener, messages[i])
+		}
+	}
+}
+
+// claim 定时认领长时间未确认的消息，包括本消费者处理失败未确认的消息
+func (c *StreamConsumer) claim(stream string, listener StreamListener) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.opt.ClaimInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.claimPending(stream, listener); err != nil && c.ctx.Err() == nil {
+				c.logger.Errorf("redis stream %s claim failed: %s", stream, err.Error())
+			}
+		}
+	}
+}
+
+func (c *StreamConsumer) claimPending(stream string, listener StreamListener) error {
+	start := "-"
+	for c.ctx.Err() == nil {
+		pending, err := c.client.XPendingExt(c.ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  c.opt.Group,
+			Start:  start,
+			End:    "+",
+			Count:  c.opt.Count,
+		}).Result()
+		if err != nil {
+			return err
+		}
+
+		ids := c.claimable(stream, pending)
+		if len(ids) > 0 {
+			messages, err := c.client.XClaim(c.ctx, &redis.XClaimArgs{
+				Stream:   stream,
+				Group:    c.opt.Group,
+				Consumer: c.opt.Consumer,
+				MinIdle:  c.opt.ClaimIdle,
+				Messages: ids,
+			}).Result()
+			if err != nil {
+				return err
+			}
+			for i := range messages {
+				c.logger.Infof("redis stream %s claimed message %s", stream, messages[i].ID)
+				c.handle(stream, listener, messages[i])
+			}
+		}
+
+		if int64(len(pending)) < c.opt.Count {
+			return nil
+		}
+		start = nextStreamID(pending[len(pending)-1].ID)
+	}
+	return nil
+}
+
+// claimable 返回空闲超过ClaimIdle且不在处理中的消息
+func (c *StreamConsumer) claimable(stream string, pending []redis.XPendingExt) []string {
+	ids := make([]string, 0, len(pending))
+	for i := range pending {
+		if pending[i].Idle < c.opt.ClaimIdle {
+			continue
+		}
+		if _, ok := c.handling.Load(stream + ":" + pending[i].ID); !ok {
+			ids = append(ids, pending[i].ID)
+		}
+	}
+	return ids
+}
+
+func (c *StreamConsumer) handle(stream string, listener StreamListener, message redis.XMessage) {
+	key := stream + ":" + message.ID
+	c.handling.Store(key, struct{}{})
+	defer c.handling.Delete(key)
+
+	ack := &StreamAcknowledgment{
+		consumer: c,
+		stream:   stream,
+		id:       message.ID,
+	}
+	// 消息已被删除，直接确认
+	if message.Values == nil {
+		ack.ack()
+		return
+	}
+
+	msg := StreamMessage{
+		Stream: stream,
+		ID:     message.ID,
+		Values: message.Values,
+	}
+	defer func() {
+		var err error
+		switch r := recover().(type) {
+		case nil:
+		case error:
+			err = r
+		default:
+			err = fmt.Errorf("unexpected panic value: %#v", r)
+		}
+		if err != nil {
+			c.logger.Errorf("redis stream handle error: %v, message: %+v", err, msg)
+		}
+	}()
+
+	listener.Listen(msg, ack)
+	if c.opt.AutoAck {
+		ack.ack()
+	}
+}
+
+func (c *StreamConsumer) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-c.ctx.Done():
+	case <-t.C:
+	}
+}
+
+// nextStreamID 返回大于id的最小stream ID，用于分页查询
+func nextStreamID(id string) string {
+	i := strings.IndexByte(id, '-')
+	if i < 0 {
+		return id
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return id
+	}
+	return id[:i+1] + strconv.FormatUint(seq+1, 10)
+}
+
+type StreamAcknowledgment struct {
+	consumer *StreamConsumer
+	stream   string
+	id       string
+}
+
+// Acknowledge 确认消息，仅在AutoAck为false时生效
+func (a *StreamAcknowledgment) Acknowledge() {
+	if !a.consumer.opt.AutoAck {
+		a.ack()
+	}
+}
+
+func (a *StreamAcknowledgment) ack() {
+	c := a.consumer
+	if err := c.client.XAck(context.Background(), a.stream, c.opt.Group, a.id).Err(); err != nil {
+		c.logger.Errorf("redis stream %s ack %s failed: %s", a.stream, a.id, err.Error())
+	}
+}
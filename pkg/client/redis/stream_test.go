@@ -0,0 +1,200 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+type streamListener struct {
+	f func(StreamMessage, *StreamAcknowledgment)
+}
+
+func (l *streamListener) Listen(msg StreamMessage, ack *StreamAcknowledgment) {
+	l.f(msg, ack)
+}
+
+func newStreamTestClient(t *testing.T) (*miniredis.Miniredis, *redisContainer) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	return s, NewClient(&Options{Name: "stream", Addr: []string{s.Addr()}})
+}
+
+func TestStreamConsumer(t *testing.T) {
+	s, client := newStreamTestClient(t)
+	defer s.Close()
+	defer client.Close()
+
+	opt := NewDefaultStreamConsumerOptions()
+	opt.Group = "g1"
+	opt.Block = time.Millisecond * 100
+	opt.ClaimIdle = 0
+	c, err := NewStreamConsumer(client, opt)
+	assert.NoError(t, err)
+
+	received := make(chan StreamMessage, 10)
+	c.AddListener("s1", &streamListener{func(msg StreamMessage, ack *StreamAcknowledgment) {
+		received <- msg
+	}})
+	assert.NoError(t, c.Start())
+
+	ctx := context.Background()
+	id, err := client.XAdd(ctx, &redis.XAddArgs{Stream: "s1", Values: map[string]interface{}{"k": "v"}}).Result()
+	assert.NoError(t, err)
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, id, msg.ID)
+		assert.Equal(t, "s1", msg.Stream)
+		assert.Equal(t, "v", msg.Values["k"])
+	case <-time.After(time.Second * 3):
+		t.Fatal("message not received")
+	}
+	c.Stop()
+
+	pending, err := client.XPending(ctx, "s1", "g1").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+}
+
+func TestStreamConsumer_ManualAckAndRecover(t *testing.T) {
+	s, client := newStreamTestClient(t)
+	defer s.Close()
+	defer client.Close()
+
+	opt := NewDefaultStreamConsumerOptions()
+	opt.Group = "g1"
+	opt.Consumer = "c1"
+	opt.Block = time.Millisecond * 100
+	opt.AutoAck = false
+	opt.ClaimIdle = 0
+
+	// 第一个消费者处理失败，不确认消息
+	c, err := NewStreamConsumer(client, opt)
+	assert.NoError(t, err)
+	failed := make(chan struct{}, 1)
+	c.AddListener("s1", &streamListener{func(msg StreamMessage, ack *StreamAcknowledgment) {
+		failed <- struct{}{}
+		panic("handle failed")
+	}})
+	assert.NoError(t, c.Start())
+	ctx := context.Background()
+	id, err := client.XAdd(ctx, &redis.XAddArgs{Stream: "s1", Values: map[string]interface{}{"k": "v"}}).Result()
+	assert.NoError(t, err)
+	select {
+	case <-failed:
+	case <-time.After(time.Second * 3):
+		t.Fatal("message not received")
+	}
+	c.Stop()
+
+	// 同名消费者重启后先处理未确认的消息
+	c, err = NewStreamConsumer(client, opt)
+	assert.NoError(t, err)
+	received := make(chan string, 1)
+	c.AddListener("s1", &streamListener{func(msg StreamMessage, ack *StreamAcknowledgment) {
+		ack.Acknowledge()
+		received <- msg.ID
+	}})
+	assert.NoError(t, c.Start())
+	select {
+	case got := <-received:
+		assert.Equal(t, id, got)
+	case <-time.After(time.Second * 3):
+		t.Fatal("pending message not recovered")
+	}
+	c.Stop()
+
+	pending, err := client.XPending(ctx, "s1", "g1").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+}
+
+func TestStreamConsumer_Claimable(t *testing.T) {
+	opt := NewDefaultStreamConsumerOptions()
+	opt.Group = "g1"
+	opt.Consumer = "c1"
+	opt.ClaimIdle = time.Minute
+	c, err := NewStreamConsumer(&redisContainer{}, opt)
+	assert.NoError(t, err)
+
+	c.handling.Store("s1:4-0", struct{}{})
+	pending := []redis.XPendingExt{
+		{ID: "1-0", Consumer: "c2", Idle: time.Hour},
+		// 本消费者处理失败未确认的消息也会被重新认领
+		{ID: "2-0", Consumer: "c1", Idle: time.Hour},
+		{ID: "3-0", Consumer: "c2", Idle: time.Second},
+		// 正在处理的消息不会被认领
+		{ID: "4-0", Consumer: "c1", Idle: time.Hour},
+	}
+	assert.Equal(t, []string{"1-0", "2-0"}, c.claimable("s1", pending))
+}
+
+func TestNewStreamConsumer_Check(t *testing.T) {
+	_, err := NewStreamConsumer(nil, NewDefaultStreamConsumerOptions())
+	assert.Error(t, err)
+
+	s, client := newStreamTestClient(t)
+	defer s.Close()
+	defer client.Close()
+	_, err = NewStreamConsumer(client, NewDefaultStreamConsumerOptions())
+	assert.Error(t, err)
+
+	assert.Equal(t, "1-1", nextStreamID("1-0"))
+	assert.Equal(t, "1626000000000-10", nextStreamID("1626000000000-9"))
+}
+
+func TestShardedClient_XRead(t *testing.T) {
+	ctx := context.Background()
+	var sis []*ShardInfo
+	for i := 0; i < 3; i++ {
+		s, err := miniredis.Run()
+		assert.NoError(t, err)
+		defer s.Close()
+		name := fmt.Sprintf("shard-%d", i)
+		sis = append(sis, &ShardInfo{id: name, name: name, client: NewClient(&Options{Name: name, Addr: []string{s.Addr()}}), weight: 1})
+	}
+	c := NewShardedClient(sis).(*ShardedClient)
+	defer c.Close()
+
+	var s1, s2 string
+	for i := 0; s2 == ""; i++ {
+		s := "stream" + strconv.Itoa(i)
+		if s1 == "" {
+			s1 = s
+		} else if c.getShardInfo(s) != c.getShardInfo(s1) {
+			s2 = s
+		}
+	}
+	assert.NoError(t, c.XAdd(ctx, &redis.XAddArgs{Stream: s1, Values: map[string]interface{}{"k": "v"}}).Err())
+
+	res, err := c.XRead(ctx, &redis.XReadArgs{Streams: []string{s1, "0"}}).Result()
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	_, err = c.XReadStreams(ctx, s1, s2, "0", "0").Result()
+	assert.Error(t, err)
+	_, err = c.XRead(ctx, &redis.XReadArgs{Streams: []string{s1}}).Result()
+	assert.Error(t, err)
+	_, err = c.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "g", Consumer: "c", Streams: []string{s1, s2, ">", ">"}}).Result()
+	assert.Error(t, err)
+}
@@ -0,0 +1,229 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redactedSecret = "******"
+
+	// maxSwitchEvents 每个客户端保留的最近切换事件数量
+	maxSwitchEvents = 20
+
+	topologyTimeout = time.Second * 3
+)
+
+// ClientInfo 是一个redis客户端的拓扑信息，敏感信息已脱敏
+type ClientInfo struct {
+	Name         string              `json:"name"`
+	ConnType     string              `json:"connType"`
+	Addr         []string            `json:"addr"`
+	MasterNames  []string            `json:"masterNames,omitempty"`
+	Username     string              `json:"username,omitempty"`
+	Password     string              `json:"password,omitempty"`
+	DB           int                 `json:"db"`
+	Nodes        []NodeInfo          `json:"nodes"`
+	PoolStats    *redis.PoolStats    `json:"poolStats,omitempty"`
+	SwitchEvents []SwitchMasterEvent `json:"switchEvents,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// NodeInfo 是客户端当前连接的节点
+type NodeInfo struct {
+	Name      string           `json:"name,omitempty"` // sentinel 模式下为master名称
+	Addr      string           `json:"addr"`
+	Role      string           `json:"role"`
+	PoolStats *redis.PoolStats `json:"poolStats,omitempty"`
+}
+
+// SwitchMasterEvent 是sentinel发出的+switch-master事件
+type SwitchMasterEvent struct {
+	MasterName string    `json:"masterName"`
+	OldAddr    string    `json:"oldAddr"`
+	NewAddr    string    `json:"newAddr"`
+	Time       time.Time `json:"time"`
+}
+
+type poolStatser interface {
+	PoolStats() *redis.PoolStats
+}
+
+// Clients 返回所有通过配置初始化的客户端的拓扑信息，按名称排序
+func Clients() []ClientInfo {
+	infos := make([]ClientInfo, 0, len(redisClients))
+	for _, c := range redisClients {
+		infos = append(infos, c.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// GetClientInfo 返回指定名称的客户端的拓扑信息
+func GetClientInfo(name string) (ClientInfo, bool) {
+	c, ok := redisClients[name]
+	if !ok {
+		return ClientInfo{}, false
+	}
+	return c.info(), true
+}
+
+func (c *redisContainer) info() ClientInfo {
+	info := ClientInfo{
+		Name:        c.opt.Name,
+		ConnType:    c.redisType,
+		Addr:        c.opt.Addr,
+		MasterNames: c.opt.MasterNames,
+		Username:    c.opt.Username,
+		DB:          c.opt.DB,
+	}
+	if c.opt.Password != "" {
+		info.Password = redactedSecret
+	}
+	if p, ok := c.Redis.(poolStatser); ok {
+		info.PoolStats = p.PoolStats()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), topologyTimeout)
+	defer cancel()
+
+	var err error
+	switch c.redisType {
+	case RedisTypeClient:
+		info.Nodes = []NodeInfo{{Addr: c.opt.Addr[0], Role: "master", PoolStats: info.PoolStats}}
+	case RedisTypeSentinel:
+		info.Nodes, err = c.sentinelNodes(ctx)
+	case RedisTypeCluster:
+		info.Nodes, err = c.clusterNodes(ctx)
+	case RedisTypeShardedSentinel:
+		info.Nodes, info.PoolStats = c.shardedNodes()
+		if c.shardedSentinel != nil {
+			info.SwitchEvents = c.shardedSentinel.SwitchEvents()
+		}
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+// sentinelNodes 向sentinel查询当前的master地址
+func (c *redisContainer) sentinelNodes(ctx context.Context) ([]NodeInfo, error) {
+	var err error
+	for _, addr := range c.opt.Addr {
+		sentinel := redis.NewSentinelClient(sentinelOptions(&c.opt, addr))
+		var masterAddr []string
+		masterAddr, err = sentinel.GetMasterAddrByName(ctx, c.opt.MasterNames[0]).Result()
+		sentinel.Close()
+		if err != nil {
+			continue
+		}
+		return []NodeInfo{{
+			Name: c.opt.MasterNames[0],
+			Addr: net.JoinHostPort(masterAddr[0], masterAddr[1]),
+			Role: "master",
+		}}, nil
+	}
+	return nil, err
+}
+
+func (c *redisContainer) clusterNodes(ctx context.Context) ([]NodeInfo, error) {
+	cluster, ok := c.Redis.(*redis.ClusterClient)
+	if !ok {
+		return nil, nil
+	}
+	var mu sync.Mutex
+	var nodes []NodeInfo
+	collect := func(role string) func(context.Context, *redis.Client) error {
+		// 回调是并发执行的
+		return func(ctx context.Context, client *redis.Client) error {
+			mu.Lock()
+			defer mu.Unlock()
+			nodes = append(nodes, NodeInfo{
+				Addr:      client.Options().Addr,
+				Role:      role,
+				PoolStats: client.PoolStats(),
+			})
+			return nil
+		}
+	}
+	if err := cluster.ForEachMaster(ctx, collect("master")); err != nil {
+		return nil, err
+	}
+	if err := cluster.ForEachSlave(ctx, collect("slave")); err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Role != nodes[j].Role {
+			return nodes[i].Role == "master"
+		}
+		return nodes[i].Addr < nodes[j].Addr
+	})
+	return nodes, nil
+}
+
+func (c *redisContainer) shardedNodes() ([]NodeInfo, *redis.PoolStats) {
+	sharded, ok := c.Redis.(*ShardedClient)
+	if !ok {
+		return nil, nil
+	}
+	total := &redis.PoolStats{}
+	shards := sharded.getAllShards()
+	nodes := make([]NodeInfo, 0, len(shards))
+	for _, si := range shards {
+		for i, client := range si.clients() {
+			node := NodeInfo{Name: si.id, Role: "master"}
+			if i > 0 {
+				node.Role = "slave"
+			}
+			if sc, ok := client.(*redisContainer); ok {
+				node.Addr = sc.opt.Addr[0]
+				if p, ok := sc.Redis.(poolStatser); ok {
+					node.PoolStats = p.PoolStats()
+					addPoolStats(total, node.PoolStats)
+				}
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Name != nodes[j].Name {
+			return nodes[i].Name < nodes[j].Name
+		}
+		if nodes[i].Role != nodes[j].Role {
+			return nodes[i].Role == "master"
+		}
+		return nodes[i].Addr < nodes[j].Addr
+	})
+	return nodes, total
+}
+
+func addPoolStats(total, s *redis.PoolStats) {
+	total.Hits += s.Hits
+	total.Misses += s.Misses
+	total.Timeouts += s.Timeouts
+	total.TotalConns += s.TotalConns
+	total.IdleConns += s.IdleConns
+	total.StaleConns += s.StaleConns
+}
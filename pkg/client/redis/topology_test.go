@@ -0,0 +1,63 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClients(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+
+	m, err := newFromConfig([]Options{
+		{Name: "b", ConnType: RedisTypeClient, Addr: []string{s.Addr()}, Password: "secret"},
+		{Name: "a", ConnType: RedisTypeClient, Addr: []string{s.Addr()}},
+	})
+	assert.NoError(t, err)
+	old := redisClients
+	redisClients = m
+	defer func() {
+		redisClients = old
+		for _, c := range m {
+			c.Close()
+		}
+	}()
+
+	infos := Clients()
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "a", infos[0].Name)
+	assert.Equal(t, "", infos[0].Password)
+	assert.Equal(t, redactedSecret, infos[1].Password)
+	assert.Equal(t, RedisTypeClient, infos[1].ConnType)
+	assert.Equal(t, s.Addr(), infos[1].Nodes[0].Addr)
+	assert.NotNil(t, infos[1].PoolStats)
+
+	_, ok := GetClientInfo("c")
+	assert.False(t, ok)
+}
+
+func TestShardedSentinelClient_SwitchEvents(t *testing.T) {
+	ssc := &ShardedSentinelClient{}
+	for i := 0; i < maxSwitchEvents+5; i++ {
+		ssc.addEvent(SwitchMasterEvent{MasterName: "m", NewAddr: "127.0.0.1:6379", Time: time.Now()})
+	}
+	assert.Len(t, ssc.SwitchEvents(), maxSwitchEvents)
+}
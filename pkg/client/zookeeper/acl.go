@@ -0,0 +1,94 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// ACLOptions 是一条ACL配置
+type ACLOptions struct {
+	// world、auth、digest或ip
+	Scheme string
+	// world为anyone，auth为空，digest为 user:password（明文，会计算摘要），ip为地址或网段
+	ID string
+	// c(create)、r(read)、w(write)、d(delete)、a(admin)的组合，或all，为空时为all
+	Perms string
+}
+
+// newACL 将配置转换为zk.ACL，配置为空时所有人拥有所有权限
+func newACL(opts []ACLOptions) ([]zk.ACL, error) {
+	if len(opts) == 0 {
+		return zk.WorldACL(zk.PermAll), nil
+	}
+	acl := make([]zk.ACL, 0, len(opts))
+	for _, opt := range opts {
+		perms, err := parsePerms(opt.Perms)
+		if err != nil {
+			return nil, err
+		}
+		switch opt.Scheme {
+		case "world":
+			id := opt.ID
+			if id == "" {
+				id = "anyone"
+			}
+			acl = append(acl, zk.ACL{Perms: perms, Scheme: "world", ID: id})
+		case "auth":
+			acl = append(acl, zk.AuthACL(perms)...)
+		case "digest":
+			i := strings.IndexByte(opt.ID, ':')
+			if i < 0 {
+				return nil, fmt.Errorf("zk: digest acl id must be user:password")
+			}
+			acl = append(acl, zk.DigestACL(perms, opt.ID[:i], opt.ID[i+1:])...)
+		case "ip":
+			if opt.ID == "" {
+				return nil, fmt.Errorf("zk: ip acl id must not be empty")
+			}
+			acl = append(acl, zk.ACL{Perms: perms, Scheme: "ip", ID: opt.ID})
+		default:
+			return nil, fmt.Errorf("zk: unknown acl scheme %q", opt.Scheme)
+		}
+	}
+	return acl, nil
+}
+
+func parsePerms(s string) (int32, error) {
+	if s == "" || s == "all" {
+		return zk.PermAll, nil
+	}
+	var perms int32
+	for _, c := range s {
+		switch c {
+		case 'c':
+			perms |= zk.PermCreate
+		case 'r':
+			perms |= zk.PermRead
+		case 'w':
+			perms |= zk.PermWrite
+		case 'd':
+			perms |= zk.PermDelete
+		case 'a':
+			perms |= zk.PermAdmin
+		default:
+			return 0, fmt.Errorf("zk: unknown acl permission %q", c)
+		}
+	}
+	return perms, nil
+}
@@ -0,0 +1,71 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"testing"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewACL(t *testing.T) {
+	acl, err := newACL(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, zk.WorldACL(zk.PermAll), acl)
+
+	acl, err = newACL([]ACLOptions{
+		{Scheme: "world", Perms: "r"},
+		{Scheme: "digest", ID: "user:secret", Perms: "crwda"},
+		{Scheme: "ip", ID: "10.0.0.0/8", Perms: "rw"},
+		{Scheme: "auth"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []zk.ACL{
+		{Perms: zk.PermRead, Scheme: "world", ID: "anyone"},
+		zk.DigestACL(zk.PermAll, "user", "secret")[0],
+		{Perms: zk.PermRead | zk.PermWrite, Scheme: "ip", ID: "10.0.0.0/8"},
+		{Perms: zk.PermAll, Scheme: "auth", ID: ""},
+	}, acl)
+
+	_, err = newACL([]ACLOptions{{Scheme: "digest", ID: "user"}})
+	assert.Error(t, err)
+	_, err = newACL([]ACLOptions{{Scheme: "world", Perms: "x"}})
+	assert.Error(t, err)
+	_, err = newACL([]ACLOptions{{Scheme: "sasl"}})
+	assert.Error(t, err)
+	_, err = NewClientFromOption([]Options{{Name: "z", Addr: []string{"127.0.0.1:2181"}, ACL: []ACLOptions{{Scheme: "ip"}}}})
+	assert.Error(t, err)
+}
+
+func TestNodeACL(t *testing.T) {
+	c := newFakeZk().proxy()
+	c.acl = zk.DigestACL(zk.PermAll, "user", "secret")
+
+	_, err := c.CreateRecursive("/a/b", nil, 0)
+	assert.NoError(t, err)
+	acl, _, err := c.GetACL("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, c.acl, acl)
+
+	_, err = c.SetACL("/a/b", zk.WorldACL(zk.PermRead), 1)
+	assert.Equal(t, zk.ErrBadVersion, err)
+	stat, err := c.SetACL("/a/b", zk.WorldACL(zk.PermRead), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), stat.Aversion)
+	acl, _, err = c.GetACL("/a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, zk.WorldACL(zk.PermRead), acl)
+}
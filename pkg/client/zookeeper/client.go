@@ -20,6 +20,8 @@ import (
 	"time"
 
 	"github.com/go-zookeeper/zk"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 )
 
 var (
@@ -30,10 +32,15 @@ type Options struct {
 	Name           string        // 客户端名称， 需要唯一
 	Addr           []string      // 节点地址
 	SessionTimeout time.Duration // 连接创建超时时间
+	Username       string        // digest认证的用户名，为空时不认证
+	Password       string        // digest认证的密码
+	ACL            []ACLOptions  // 创建节点时默认的ACL，为空时所有人拥有所有权限
 }
 
 type ZookeeperProxy struct {
 	Conn *zk.Conn
+	c    conn     // 测试时替换Conn
+	acl  []zk.ACL // 创建节点时默认的ACL
 }
 
 func Init(opts []Options) (err error) {
@@ -63,14 +70,54 @@ func NewClientFromOption(opts []Options) (map[string]*ZookeeperProxy, error) {
 		if len(opt.Addr) == 0 {
 			return nil, errors.New("zk: server list must not be empty")
 		}
-		conn, _, err := zk.Connect(opt.Addr, opt.SessionTimeout)
+		acl, err := newACL(opt.ACL)
+		if err != nil {
+			return nil, err
+		}
+		conn, events, err := zk.Connect(opt.Addr, opt.SessionTimeout)
 
 		if err != nil {
 			return nil, fmt.Errorf("connection failed")
 		}
+		go logSessionEvents(opt.Name, events)
+		if opt.Username != "" {
+			// 认证信息会在重连后自动重新提交
+			if err := conn.AddAuth("digest", []byte(opt.Username+":"+opt.Password)); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("zk: add auth for %s failed: %w", opt.Name, err)
+			}
+		}
 		clients[opt.Name] = &ZookeeperProxy{
 			Conn: conn,
+			acl:  acl,
 		}
 	}
 	return clients, nil
 }
+
+// StopAll 停止配置源的监听并关闭所有客户端
+func StopAll() {
+	if defaultConfigSource != nil {
+		defaultConfigSource.Close()
+	}
+	for name, client := range zookeeperClients {
+		if client.Conn != nil {
+			client.Conn.Close()
+		}
+		log.Infof("Stop zookeeper client %s", name)
+	}
+}
+
+// logSessionEvents 记录会话状态变化。会话过期后zk会自动建立新会话，监听会重新注册
+func logSessionEvents(name string, events <-chan zk.Event) {
+	for e := range events {
+		switch e.State {
+		case zk.StateExpired:
+			log.Warnf("zk: session of %s expired, reconnecting", name)
+		case zk.StateDisconnected:
+			log.Warnf("zk: %s disconnected", name)
+		case zk.StateHasSession:
+			log.Infof("zk: %s connected to %s", name, e.Server)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/config"
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+// configSourceKey 是配置文件中zookeeper配置源的顶层配置
+const configSourceKey = "configZookeeper"
+
+var defaultConfigSource *ConfigSource
+
+// ConfigSourceOptions 是zookeeper配置源的配置
+type ConfigSourceOptions struct {
+	// 使用的zookeeper配置名
+	Zookeeper string
+	// 配置节点，可以是单个节点或目录，目录下的节点按名称顺序递归读取，后读取的覆盖先读取的
+	Paths []string
+	// 是否监听节点变化
+	Watch bool
+}
+
+// ConfigSource 从zookeeper节点读取yaml、properties等配置，像configImports一样合并到Config中。
+// 节点的配置类型由节点名的扩展名决定，没有扩展名时为yaml
+type ConfigSource struct {
+	client *ZookeeperProxy
+	cfg    *config.Config
+	opt    ConfigSourceOptions
+
+	mu        sync.Mutex
+	caches    []*TreeCache
+	listeners []func(*config.Config)
+}
+
+// InitConfigSource 读取cfg中的configZookeeper配置，将zookeeper中的配置合并到cfg，未配置时跳过
+func InitConfigSource(cfg *config.Config) error {
+	if defaultConfigSource != nil {
+		panic("zookeeper config source has initialed, you should not initial it again!")
+	}
+	if cfg == nil || !cfg.IsSet(configSourceKey) {
+		return nil
+	}
+	var opt ConfigSourceOptions
+	if err := cfg.UnmarshalKey(configSourceKey, &opt); err != nil {
+		return err
+	}
+	client := GetZkClient(opt.Zookeeper)
+	if client == nil {
+		return fmt.Errorf("zookeeper client %s not found", opt.Zookeeper)
+	}
+	s := NewConfigSource(client, cfg, &opt)
+	if err := s.Load(); err != nil {
+		return err
+	}
+	if opt.Watch {
+		if err := s.Watch(); err != nil {
+			return err
+		}
+	}
+	defaultConfigSource = s
+	return nil
+}
+
+// GetConfigSource 返回InitConfigSource创建的配置源，未配置时为nil
+func GetConfigSource() *ConfigSource {
+	return defaultConfigSource
+}
+
+// NewConfigSource 创建配置源，需要调用Load加载配置
+func NewConfigSource(client *ZookeeperProxy, cfg *config.Config, opt *ConfigSourceOptions) *ConfigSource {
+	return &ConfigSource{
+		client: client,
+		cfg:    cfg,
+		opt:    *opt,
+	}
+}
+
+// OnChange 添加配置变化的回调，回调在配置合并后执行
+func (s *ConfigSource) OnChange(f func(*config.Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, f)
+}
+
+// Load 读取所有配置节点，全部读取成功后一次性合并到Config中
+func (s *ConfigSource) Load() error {
+	if len(s.opt.Paths) == 0 {
+		return errors.New("zk: config paths must not be empty")
+	}
+	v := viper.New()
+	for _, p := range s.opt.Paths {
+		if err := s.load(v, p); err != nil {
+			return fmt.Errorf("zk: load config %s failed: %w", p, err)
+		}
+	}
+	return s.cfg.MergeConfigMap(v.AllSettings())
+}
+
+// load 读取节点的配置合并到v，再按名称顺序读取子节点
+func (s *ConfigSource) load(v *viper.Viper, p string) error {
+	data, _, err := s.client.conn().Get(p)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		c, err := config.NewFromContent(string(data), configType(p))
+		if err != nil {
+			return err
+		}
+		if err := v.MergeConfigMap(c.AllSettings()); err != nil {
+			return err
+		}
+		log.Infof("load conf zookeeper node: %s", p)
+	}
+
+	children, _, err := s.client.conn().Children(p)
+	if err != nil {
+		return err
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		if err := s.load(v, path.Join(p, child)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch 监听所有配置节点及其子孙节点，变化后重新加载。节点删除不会删除已合并的配置
+func (s *ConfigSource) Watch() error {
+	s.mu.Lock()
+	watched := len(s.caches) > 0
+	s.mu.Unlock()
+	if watched {
+		return errors.New("zk: config source has been watched")
+	}
+	caches := make([]*TreeCache, 0, len(s.opt.Paths))
+	for _, p := range s.opt.Paths {
+		tc := NewTreeCache(s.client, p)
+		tc.OnChange(func(TreeEvent) { s.reload() })
+		if err := tc.Start(context.Background()); err != nil {
+			for _, c := range caches {
+				c.Close()
+			}
+			return err
+		}
+		caches = append(caches, tc)
+	}
+	s.mu.Lock()
+	s.caches = caches
+	s.mu.Unlock()
+	return nil
+}
+
+// Close 停止监听
+func (s *ConfigSource) Close() {
+	s.mu.Lock()
+	caches := s.caches
+	s.caches = nil
+	s.mu.Unlock()
+	for _, tc := range caches {
+		tc.Close()
+	}
+}
+
+func (s *ConfigSource) reload() {
+	if err := s.Load(); err != nil {
+		log.Errorf("zk: reload config failed: %s", err)
+		return
+	}
+
+	s.mu.Lock()
+	listeners := append([]func(*config.Config){}, s.listeners...)
+	s.mu.Unlock()
+	for _, f := range listeners {
+		f(s.cfg)
+	}
+}
+
+// configType 根据节点名的扩展名返回配置类型
+func configType(p string) string {
+	ext := path.Ext(p)
+	if ext != "" {
+		ext = ext[1:]
+		for _, s := range viper.SupportedExts {
+			if s == ext {
+				return ext
+			}
+		}
+	}
+	return "yaml"
+}
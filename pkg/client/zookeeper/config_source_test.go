@@ -0,0 +1,97 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/config"
+)
+
+func TestConfigSource(t *testing.T) {
+	f := newFakeZk()
+	c := f.proxy()
+	create := func(p, data string) {
+		assert.NoError(t, c.createParents(p))
+		_, err := c.conn().Create(p, []byte(data), 0, zk.WorldACL(zk.PermAll))
+		assert.NoError(t, err)
+	}
+	create("/config/app/common.yaml", "redis:\n  addr: 127.0.0.1:6379\nlevel: info\n")
+	create("/config/app/online/db.properties", "db.host=10.0.0.1\ndb.port=3306\n")
+	create("/config/app/online/z.yaml", "level: warn\n")
+
+	cfg, err := config.NewFromContent("level: debug\nport: 8080\n", "yaml")
+	assert.NoError(t, err)
+	s := NewConfigSource(c, cfg, &ConfigSourceOptions{Paths: []string{"/config/app"}})
+	assert.NoError(t, s.Load())
+	assert.Equal(t, 8080, cfg.GetInt("port"))
+	assert.Equal(t, "127.0.0.1:6379", cfg.GetString("redis.addr"))
+	assert.Equal(t, "10.0.0.1", cfg.GetString("db.host"))
+	assert.Equal(t, "warn", cfg.GetString("level")) // 按名称顺序，后读取的覆盖
+
+	changed := make(chan struct{}, 10)
+	s.OnChange(func(*config.Config) { changed <- struct{}{} })
+	assert.NoError(t, s.Watch())
+	defer s.Close()
+	assert.Error(t, s.Watch())
+	wait := func() {
+		select {
+		case <-changed:
+		case <-time.After(time.Second * 2):
+			t.Fatal("config not reloaded")
+		}
+	}
+
+	// 监听重新加载时并发读取配置
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = cfg.GetString("redis.addr")
+				_ = cfg.AllSettings()
+			}
+		}
+	}()
+
+	// 修改节点
+	_, err = c.conn().Set("/config/app/common.yaml", []byte("redis:\n  addr: 10.0.0.2:6379\n"), -1)
+	assert.NoError(t, err)
+	wait()
+	assert.Equal(t, "10.0.0.2:6379", cfg.GetString("redis.addr"))
+
+	// 新增节点
+	create("/config/app/online/kafka.yaml", "kafka:\n  addr: 10.0.0.3:9092\n")
+	wait()
+	assert.Equal(t, "10.0.0.3:9092", cfg.GetString("kafka.addr"))
+
+	// 新增的节点也被监听
+	_, err = c.conn().Set("/config/app/online/kafka.yaml", []byte("kafka:\n  addr: 10.0.0.4:9092\n"), -1)
+	assert.NoError(t, err)
+	wait()
+	assert.Equal(t, "10.0.0.4:9092", cfg.GetString("kafka.addr"))
+
+	s = NewConfigSource(c, cfg, &ConfigSourceOptions{Paths: []string{"/config/missing"}})
+	assert.Error(t, s.Load())
+	assert.Equal(t, "properties", configType("/a/b.properties"))
+	assert.Equal(t, "yaml", configType("/a/b"))
+}
@@ -0,0 +1,62 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"path"
+	"strings"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// conn 是zk.Conn中被使用的方法，便于测试时替换
+type conn interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Exists(path string) (bool, *zk.Stat, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	GetACL(path string) ([]zk.ACL, *zk.Stat, error)
+	SetACL(path string, acl []zk.ACL, version int32) (*zk.Stat, error)
+	Multi(ops ...interface{}) ([]zk.MultiResponse, error)
+}
+
+func (z *ZookeeperProxy) conn() conn {
+	if z.c != nil {
+		return z.c
+	}
+	return z.Conn
+}
+
+// createParents 创建path的所有上级永久节点，已存在时忽略
+func (z *ZookeeperProxy) createParents(p string) error {
+	dir := path.Dir(p)
+	if dir == "/" || dir == "." {
+		return nil
+	}
+	var cur string
+	for _, name := range strings.Split(strings.TrimPrefix(dir, "/"), "/") {
+		cur += "/" + name
+		_, err := z.conn().Create(cur, nil, 0, z.ACL())
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeZk 是内存中的zookeeper，多个fakeConn共享同一棵树，仅用于测试
+type fakeZk struct {
+	mu      sync.Mutex
+	nodes   map[string]*fakeNode
+	zxid    int64
+	session int64
+	watches map[string][]*fakeWatch
+	dry     bool // 为true时不触发监听，用于multi的预执行
+}
+
+type fakeNode struct {
+	data []byte
+	stat zk.Stat
+	seq  int32
+	acl  []zk.ACL
+}
+
+type watchKind int
+
+const (
+	watchData watchKind = iota
+	watchExists
+	watchChildren
+)
+
+type fakeWatch struct {
+	kind    watchKind
+	session int64
+	ch      chan zk.Event
+}
+
+// fakeConn 是fakeZk的一个会话
+type fakeConn struct {
+	zk      *fakeZk
+	session int64
+}
+
+func newFakeZk() *fakeZk {
+	return &fakeZk{
+		nodes:   map[string]*fakeNode{"/": {}},
+		watches: make(map[string][]*fakeWatch),
+	}
+}
+
+// proxy 创建一个新会话的客户端
+func (f *fakeZk) proxy() *ZookeeperProxy {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.session++
+	return &ZookeeperProxy{c: &fakeConn{zk: f, session: f.session}}
+}
+
+// expire 使会话过期：删除其临时节点，其监听收到EventNotWatching，之后以新会话继续使用
+func (c *fakeConn) expire() {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ephemerals []string
+	for p, n := range f.nodes {
+		if n.stat.EphemeralOwner == c.session {
+			ephemerals = append(ephemerals, p)
+		}
+	}
+	for p, ws := range f.watches {
+		kept := ws[:0]
+		for _, w := range ws {
+			if w.session == c.session {
+				w.ch <- zk.Event{Type: zk.EventNotWatching, State: zk.StateExpired, Path: p, Err: zk.ErrSessionExpired}
+				continue
+			}
+			kept = append(kept, w)
+		}
+		f.watches[p] = kept
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ephemerals)))
+	for _, p := range ephemerals {
+		f.delete(p)
+	}
+	f.session++
+	c.session = f.session
+}
+
+func (f *fakeZk) fire(p string, typ zk.EventType, kinds ...watchKind) {
+	if f.dry {
+		return
+	}
+	ws := f.watches[p]
+	kept := ws[:0]
+	for _, w := range ws {
+		matched := false
+		for _, k := range kinds {
+			if w.kind == k {
+				matched = true
+			}
+		}
+		if matched {
+			w.ch <- zk.Event{Type: typ, State: zk.StateHasSession, Path: p}
+			continue
+		}
+		kept = append(kept, w)
+	}
+	f.watches[p] = kept
+}
+
+func (f *fakeZk) watch(p string, kind watchKind, session int64) <-chan zk.Event {
+	w := &fakeWatch{kind: kind, session: session, ch: make(chan zk.Event, 1)}
+	f.watches[p] = append(f.watches[p], w)
+	return w.ch
+}
+
+func (f *fakeZk) children(p string) []string {
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	var ret []string
+	for np := range f.nodes {
+		if np != "/" && strings.HasPrefix(np, prefix) && !strings.Contains(np[len(prefix):], "/") {
+			ret = append(ret, np[len(prefix):])
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (f *fakeZk) delete(p string) {
+	delete(f.nodes, p)
+	parent := f.nodes[path.Dir(p)]
+	parent.stat.Cversion++
+	parent.stat.NumChildren--
+	f.fire(p, zk.EventNodeDeleted, watchData, watchExists, watchChildren)
+	f.fire(path.Dir(p), zk.EventNodeChildrenChanged, watchChildren)
+}
+
+func (c *fakeConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.zk.mu.Lock()
+	defer c.zk.mu.Unlock()
+	return c.create(p, data, flags, acl)
+}
+
+func (c *fakeConn) create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	f := c.zk
+	parent, ok := f.nodes[path.Dir(p)]
+	if !ok {
+		return "", zk.ErrNoNode
+	}
+	if flags&zk.FlagSequence != 0 {
+		p = fmt.Sprintf("%s%010d", p, parent.seq)
+		parent.seq++
+	}
+	if _, ok := f.nodes[p]; ok {
+		return "", zk.ErrNodeExists
+	}
+	if parent.stat.EphemeralOwner != 0 {
+		return "", zk.ErrNoChildrenForEphemerals
+	}
+	f.zxid++
+	n := &fakeNode{data: data, acl: acl}
+	n.stat.Czxid = f.zxid
+	n.stat.Mzxid = f.zxid
+	n.stat.DataLength = int32(len(data))
+	if flags&zk.FlagEphemeral != 0 {
+		n.stat.EphemeralOwner = c.session
+	}
+	f.nodes[p] = n
+	parent.stat.Cversion++
+	parent.stat.NumChildren++
+	f.fire(p, zk.EventNodeCreated, watchExists)
+	f.fire(path.Dir(p), zk.EventNodeChildrenChanged, watchChildren)
+	return p, nil
+}
+
+func (c *fakeConn) Delete(p string, version int32) error {
+	c.zk.mu.Lock()
+	defer c.zk.mu.Unlock()
+	return c.del(p, version)
+}
+
+func (c *fakeConn) del(p string, version int32) error {
+	f := c.zk
+	n, ok := f.nodes[p]
+	if !ok {
+		return zk.ErrNoNode
+	}
+	if version != -1 && version != n.stat.Version {
+		return zk.ErrBadVersion
+	}
+	if n.stat.NumChildren > 0 {
+		return zk.ErrNotEmpty
+	}
+	f.zxid++
+	f.delete(p)
+	return nil
+}
+
+func (c *fakeConn) Exists(p string) (bool, *zk.Stat, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n, ok := f.nodes[p]; ok {
+		stat := n.stat
+		return true, &stat, nil
+	}
+	return false, nil, nil
+}
+
+func (c *fakeConn) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n, ok := f.nodes[p]; ok {
+		stat := n.stat
+		return true, &stat, f.watch(p, watchData, c.session), nil
+	}
+	return false, nil, f.watch(p, watchExists, c.session), nil
+}
+
+func (c *fakeConn) Get(p string) ([]byte, *zk.Stat, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	stat := n.stat
+	return n.data, &stat, nil
+}
+
+func (c *fakeConn) GetW(p string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[p]
+	if !ok {
+		return nil, nil, nil, zk.ErrNoNode
+	}
+	stat := n.stat
+	return n.data, &stat, f.watch(p, watchData, c.session), nil
+}
+
+func (c *fakeConn) Set(p string, data []byte, version int32) (*zk.Stat, error) {
+	c.zk.mu.Lock()
+	defer c.zk.mu.Unlock()
+	return c.set(p, data, version)
+}
+
+func (c *fakeConn) set(p string, data []byte, version int32) (*zk.Stat, error) {
+	f := c.zk
+	n, ok := f.nodes[p]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	if version != -1 && version != n.stat.Version {
+		return nil, zk.ErrBadVersion
+	}
+	f.zxid++
+	n.data = data
+	n.stat.Version++
+	n.stat.Mzxid = f.zxid
+	n.stat.DataLength = int32(len(data))
+	f.fire(p, zk.EventNodeDataChanged, watchData)
+	stat := n.stat
+	return &stat, nil
+}
+
+func (c *fakeConn) Children(p string) ([]string, *zk.Stat, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	stat := n.stat
+	return f.children(p), &stat, nil
+}
+
+func (c *fakeConn) ChildrenW(p string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[p]
+	if !ok {
+		return nil, nil, nil, zk.ErrNoNode
+	}
+	stat := n.stat
+	return f.children(p), &stat, f.watch(p, watchChildren, c.session), nil
+}
+
+func (c *fakeConn) GetACL(p string) ([]zk.ACL, *zk.Stat, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	stat := n.stat
+	return n.acl, &stat, nil
+}
+
+func (c *fakeConn) SetACL(p string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[p]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	if version != -1 && version != n.stat.Aversion {
+		return nil, zk.ErrBadVersion
+	}
+	n.acl = acl
+	n.stat.Aversion++
+	stat := n.stat
+	return &stat, nil
+}
+
+// Multi 先不触发监听预执行一遍，全部成功后恢复再正式执行
+func (c *fakeConn) Multi(ops ...interface{}) ([]zk.MultiResponse, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	nodes := make(map[string]*fakeNode, len(f.nodes))
+	for p, n := range f.nodes {
+		cp := *n
+		nodes[p] = &cp
+	}
+	zxid := f.zxid
+
+	f.dry = true
+	resps := c.multi(ops)
+	f.dry = false
+	f.nodes, f.zxid = nodes, zxid
+	for i, r := range resps {
+		if r.Error != nil {
+			for j := range resps {
+				if j < i {
+					resps[j] = zk.MultiResponse{}
+				} else if j > i {
+					resps[j] = zk.MultiResponse{Error: fmt.Errorf("unknown error: -2")}
+				}
+			}
+			return resps, r.Error
+		}
+	}
+	return c.multi(ops), nil
+}
+
+func (c *fakeConn) multi(ops []interface{}) []zk.MultiResponse {
+	resps := make([]zk.MultiResponse, len(ops))
+	for i, op := range ops {
+		var r zk.MultiResponse
+		switch op := op.(type) {
+		case *zk.CreateRequest:
+			r.String, r.Error = c.create(op.Path, op.Data, op.Flags, op.Acl)
+		case *zk.SetDataRequest:
+			r.Stat, r.Error = c.set(op.Path, op.Data, op.Version)
+		case *zk.DeleteRequest:
+			r.Error = c.del(op.Path, op.Version)
+		case *zk.CheckVersionRequest:
+			if n, ok := c.zk.nodes[op.Path]; !ok {
+				r.Error = zk.ErrNoNode
+			} else if op.Version != -1 && op.Version != n.stat.Version {
+				r.Error = zk.ErrBadVersion
+			}
+		}
+		resps[i] = r
+		if r.Error != nil {
+			break
+		}
+	}
+	return resps
+}
+
+func TestFakeZk(t *testing.T) {
+	f := newFakeZk()
+	c := f.proxy()
+	assert.NoError(t, c.createParents("/a/b/c"))
+	ok, _, err := c.conn().Exists("/a/b")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, _, ch, err := c.conn().ChildrenW("/a/b")
+	assert.NoError(t, err)
+	p, err := c.conn().Create("/a/b/n-", nil, zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	assert.NoError(t, err)
+	assert.Equal(t, "/a/b/n-0000000000", p)
+	assert.Equal(t, zk.EventNodeChildrenChanged, (<-ch).Type)
+
+	_, _, ch, _ = c.conn().ChildrenW("/a/b")
+	c.c.(*fakeConn).expire()
+	assert.Equal(t, zk.EventNotWatching, (<-ch).Type)
+	children, _, err := c.conn().Children("/a/b")
+	assert.NoError(t, err)
+	assert.Empty(t, children)
+}
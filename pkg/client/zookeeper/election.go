@@ -0,0 +1,68 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+// Elect 参与path下的选主，阻塞直到ctx结束并返回ctx.Err()。
+// 当选后调用onElected，传入的ctx在失去领导权时取消，onElected可以阻塞执行任务，也可以直接返回。
+// 领导权在ctx结束或会话过期时失去，之后调用onRevoked，ctx未结束时重新参选
+func (z *ZookeeperProxy) Elect(ctx context.Context, p string, onElected func(ctx context.Context), onRevoked func()) error {
+	l := z.NewLock(p)
+	backoff := minRetryBackoff
+	for {
+		if err := l.Lock(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Errorf("zk: elect %s failed: %s", p, err)
+			sleep(ctx, backoff)
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = minRetryBackoff
+		log.Infof("zk: elected as leader of %s", p)
+
+		leaderCtx, cancel := context.WithCancel(ctx)
+		lost := l.Lost()
+		go func() {
+			select {
+			case <-lost:
+				cancel()
+			case <-leaderCtx.Done():
+			}
+		}()
+		if onElected != nil {
+			onElected(leaderCtx)
+		}
+		<-leaderCtx.Done()
+		cancel()
+
+		if err := l.Unlock(); err != nil {
+			log.Errorf("zk: resign leader of %s failed: %s", p, err)
+		}
+		log.Infof("zk: leadership of %s revoked", p)
+		if onRevoked != nil {
+			onRevoked()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
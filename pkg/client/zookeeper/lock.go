@@ -0,0 +1,246 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+const (
+	lockPrefix = "lock-"
+	seqLen     = 10 // 顺序节点序号的长度
+)
+
+var (
+	ErrLockHeld    = errors.New("zk: lock has been held")
+	ErrLockNotHeld = errors.New("zk: lock is not held")
+)
+
+// Lock 是基于临时顺序节点的互斥锁，序号最小的节点持有锁，其他节点监听前一个节点，没有惊群效应。
+// 锁在会话有效期间一直持有，会话过期后节点被删除，Lost返回的channel会被关闭
+type Lock struct {
+	client *ZookeeperProxy
+	path   string
+	prefix string // 节点名前缀，带有随机串，用于创建请求的响应丢失时找回节点
+
+	mu     sync.Mutex
+	node   string
+	lost   chan struct{}
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// NewLock 创建path下的锁，同一个Lock不能被并发使用
+func (z *ZookeeperProxy) NewLock(p string) *Lock {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &Lock{
+		client: z,
+		path:   p,
+		prefix: lockPrefix + hex.EncodeToString(b) + "-",
+	}
+}
+
+// Lock 阻塞直到获取锁或ctx结束
+func (l *Lock) Lock(ctx context.Context) error {
+	_, err := l.acquire(ctx, true)
+	return err
+}
+
+// TryLock 尝试获取锁，锁被其他节点持有时立即返回false
+func (l *Lock) TryLock() (bool, error) {
+	return l.acquire(context.Background(), false)
+}
+
+// Node 返回持有锁时创建的节点
+func (l *Lock) Node() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.node
+}
+
+// Sequence 返回持有锁的节点的序号，序号随获取锁的顺序递增，可以作为fencing token，未持有锁时为0
+func (l *Lock) Sequence() int64 {
+	node := l.Node()
+	if node == "" {
+		return 0
+	}
+	seq, _ := strconv.ParseInt(sequence(node), 10, 64)
+	return seq
+}
+
+// Lost 返回的channel在持有的锁丢失时关闭，未持有锁时返回nil
+func (l *Lock) Lost() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// Unlock 释放锁
+func (l *Lock) Unlock() error {
+	l.mu.Lock()
+	node, cancel := l.node, l.cancel
+	l.node, l.lost, l.cancel = "", nil, nil
+	l.mu.Unlock()
+	if node == "" {
+		return ErrLockNotHeld
+	}
+	cancel()
+	l.wg.Wait()
+	if err := l.client.conn().Delete(node, AnyVersion); err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+func (l *Lock) acquire(ctx context.Context, wait bool) (bool, error) {
+	if l.Node() != "" {
+		return false, ErrLockHeld
+	}
+	node, err := l.create()
+	if err != nil {
+		return false, err
+	}
+	for {
+		children, _, err := l.client.conn().Children(l.path)
+		if err != nil {
+			l.delete(node)
+			return false, err
+		}
+		sortBySequence(children)
+		i := sort.SearchStrings(sequences(children), sequence(node))
+		if i == len(children) || path.Join(l.path, children[i]) != node {
+			// 会话过期导致节点被删除，重新创建
+			if node, err = l.create(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if i == 0 {
+			l.hold(node)
+			return true, nil
+		}
+		if !wait {
+			l.delete(node)
+			return false, nil
+		}
+
+		// 只监听前一个节点
+		exists, _, ch, err := l.client.conn().ExistsW(path.Join(l.path, children[i-1]))
+		if err != nil {
+			l.delete(node)
+			return false, err
+		}
+		if !exists {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			l.delete(node)
+			return false, ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// create 创建临时顺序节点，响应丢失时通过前缀找回已创建的节点
+func (l *Lock) create() (string, error) {
+	node, err := l.client.CreateRecursive(path.Join(l.path, l.prefix), nil, zk.FlagEphemeral|zk.FlagSequence)
+	if err == nil {
+		return node, nil
+	}
+	children, _, cerr := l.client.conn().Children(l.path)
+	if cerr == nil {
+		for _, child := range children {
+			if strings.HasPrefix(child, l.prefix) {
+				return path.Join(l.path, child), nil
+			}
+		}
+	}
+	return "", err
+}
+
+func (l *Lock) delete(node string) {
+	if err := l.client.conn().Delete(node, AnyVersion); err != nil && err != zk.ErrNoNode {
+		log.Errorf("zk: delete lock node %s failed: %s", node, err)
+	}
+}
+
+// hold 记录持有的节点并监听它是否被删除
+func (l *Lock) hold(node string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lost := make(chan struct{})
+	l.mu.Lock()
+	l.node, l.lost, l.cancel = node, lost, cancel
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		backoff := minRetryBackoff
+		for ctx.Err() == nil {
+			exists, _, ch, err := l.client.conn().ExistsW(node)
+			if err != nil {
+				log.Errorf("zk: watch lock node %s failed: %s", node, err)
+				sleep(ctx, backoff)
+				backoff = nextBackoff(backoff)
+				continue
+			}
+			backoff = minRetryBackoff
+			if !exists {
+				log.Warnf("zk: lock node %s lost", node)
+				close(lost)
+				return
+			}
+			select {
+			case <-ctx.Done():
+			case <-ch:
+			}
+		}
+	}()
+}
+
+func sequence(name string) string {
+	if len(name) < seqLen {
+		return name
+	}
+	return name[len(name)-seqLen:]
+}
+
+func sequences(names []string) []string {
+	ret := make([]string, len(names))
+	for i, name := range names {
+		ret[i] = sequence(name)
+	}
+	return ret
+}
+
+func sortBySequence(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		return sequence(names[i]) < sequence(names[j])
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	f := newFakeZk()
+	c1, c2 := f.proxy(), f.proxy()
+	l1, l2 := c1.NewLock("/locks/job"), c2.NewLock("/locks/job")
+
+	assert.NoError(t, l1.Lock(context.Background()))
+	assert.Equal(t, ErrLockHeld, l1.Lock(context.Background()))
+	ok, err := l2.TryLock()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	children, _, _ := c1.Children("/locks/job")
+	assert.Len(t, children, 1) // 失败的节点已删除
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l2.Lock(ctx))
+
+	locked := make(chan error)
+	go func() { locked <- l2.Lock(context.Background()) }()
+	time.Sleep(time.Millisecond * 20)
+	assert.NoError(t, l1.Unlock())
+	assert.Equal(t, ErrLockNotHeld, l1.Unlock())
+	select {
+	case err := <-locked:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("lock not acquired")
+	}
+
+	// 会话过期后锁丢失
+	lost := l2.Lost()
+	c2.c.(*fakeConn).expire()
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("lock not lost")
+	}
+	assert.NoError(t, l1.Lock(context.Background()))
+	assert.NoError(t, l2.Unlock())
+	assert.NoError(t, l1.Unlock())
+}
+
+func TestElect(t *testing.T) {
+	f := newFakeZk()
+	c1, c2 := f.proxy(), f.proxy()
+	events := make(chan string, 10)
+	elect := func(ctx context.Context, c *ZookeeperProxy, name string) chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- c.Elect(ctx, "/election", func(ctx context.Context) {
+				events <- name + " elected"
+			}, func() {
+				events <- name + " revoked"
+			})
+		}()
+		return done
+	}
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no election event")
+		}
+		return ""
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := elect(ctx1, c1, "c1")
+	assert.Equal(t, "c1 elected", next())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	done2 := elect(ctx2, c2, "c2")
+
+	// 会话过期后失去领导权，由另一个节点当选，之后重新参选
+	c1.c.(*fakeConn).expire()
+	assert.ElementsMatch(t, []string{"c1 revoked", "c2 elected"}, []string{next(), next()})
+
+	cancel2()
+	assert.ElementsMatch(t, []string{"c2 revoked", "c1 elected"}, []string{next(), next()})
+	assert.Equal(t, context.Canceled, <-done2)
+
+	cancel1()
+	assert.Equal(t, "c1 revoked", next())
+	assert.Equal(t, context.Canceled, <-done1)
+}
@@ -0,0 +1,346 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+const (
+	// DefaultRegistryRoot 是服务注册的默认根路径
+	DefaultRegistryRoot = "/ngo/services"
+
+	instancePrefix = "instance-"
+
+	minRetryBackoff = time.Millisecond * 100
+	maxRetryBackoff = time.Second * 5
+)
+
+var ErrNoInstance = errors.New("zk: no available instance")
+
+// Instance 是注册到zookeeper的一个服务实例
+type Instance struct {
+	AppName     string            `json:"appName"`
+	ClusterName string            `json:"clusterName"`
+	Instance    string            `json:"instance"`
+	Address     string            `json:"address"` // host:port
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// RegistryOptions 是服务注册的配置
+type RegistryOptions struct {
+	// 是否在server启动时注册
+	Enabled bool
+	// 使用的zookeeper客户端名称
+	Zookeeper string
+	// 注册根路径，实例节点为 Root/AppName/ClusterName/instance-<随机串>-xxxxxxxxxx
+	Root string
+	// 注册的地址，默认为本机出口IP和httpServer端口
+	Address string
+	// 附加的元数据
+	Metadata map[string]string
+}
+
+func NewDefaultRegistryOptions() *RegistryOptions {
+	return &RegistryOptions{
+		Root: DefaultRegistryRoot,
+	}
+}
+
+func servicePath(root, appName, clusterName string) string {
+	if root == "" {
+		root = DefaultRegistryRoot
+	}
+	return path.Join(root, appName, clusterName)
+}
+
+// Registry 在zookeeper中注册临时顺序节点，节点因会话过期丢失后自动重新注册
+type Registry struct {
+	client *ZookeeperProxy
+	root   string
+	prefix string // 节点名前缀，带有随机串，用于创建请求的响应丢失时找回节点
+
+	mu     sync.Mutex
+	path   string // 当前注册的节点
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// NewRegistry 创建服务注册，root为空时使用DefaultRegistryRoot
+func NewRegistry(client *ZookeeperProxy, root string) *Registry {
+	if root == "" {
+		root = DefaultRegistryRoot
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &Registry{
+		client: client,
+		root:   root,
+		prefix: instancePrefix + hex.EncodeToString(b) + "-",
+	}
+}
+
+// Path 返回当前注册的节点路径
+func (r *Registry) Path() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.path
+}
+
+// Register 注册实例，只能调用一次，需要调用Deregister注销
+func (r *Registry) Register(ins Instance) error {
+	if ins.AppName == "" || ins.ClusterName == "" || ins.Address == "" {
+		return errors.New("zk: appName, clusterName and address of instance must not be empty")
+	}
+	data, err := json.Marshal(ins)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return errors.New("zk: instance has been registered")
+	}
+	prefix := path.Join(servicePath(r.root, ins.AppName, ins.ClusterName), r.prefix)
+	p, err := r.create(prefix, data)
+	if err != nil {
+		return err
+	}
+	r.path = p
+	log.Infof("zk: registered %s at %s", ins.Address, p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go r.keepalive(ctx, prefix, data)
+	return nil
+}
+
+// Deregister 删除注册的节点并停止后台任务
+func (r *Registry) Deregister() error {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.path
+	r.path = ""
+	r.cancel = nil
+	err := r.client.conn().Delete(p, -1)
+	if err == zk.ErrNoNode {
+		err = nil
+	}
+	if err == nil {
+		log.Infof("zk: deregistered %s", p)
+	}
+	return err
+}
+
+// create 创建临时顺序节点，响应丢失时通过前缀找回已创建的节点，避免残留重复的实例
+func (r *Registry) create(prefix string, data []byte) (string, error) {
+	if err := r.client.createParents(prefix); err != nil {
+		return "", err
+	}
+	node, err := r.client.conn().Create(prefix, data, zk.FlagEphemeral|zk.FlagSequence, r.client.ACL())
+	if err == nil {
+		return node, nil
+	}
+	dir := path.Dir(prefix)
+	children, _, cerr := r.client.conn().Children(dir)
+	if cerr == nil {
+		for _, child := range children {
+			if strings.HasPrefix(child, r.prefix) {
+				return path.Join(dir, child), nil
+			}
+		}
+	}
+	return "", err
+}
+
+// keepalive 监听注册的节点，节点被删除后重新注册
+func (r *Registry) keepalive(ctx context.Context, prefix string, data []byte) {
+	defer r.wg.Done()
+	backoff := minRetryBackoff
+	for ctx.Err() == nil {
+		p := r.Path()
+		exists, _, ch, err := r.client.conn().ExistsW(p)
+		if err == nil && !exists {
+			var np string
+			np, err = r.create(prefix, data)
+			if err == nil {
+				log.Warnf("zk: registration %s lost, registered again at %s", p, np)
+				r.mu.Lock()
+				r.path = np
+				r.mu.Unlock()
+				continue
+			}
+		}
+		if err != nil {
+			log.Errorf("zk: watch registration %s failed: %s", p, err)
+			sleep(ctx, backoff)
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = minRetryBackoff
+		select {
+		case <-ctx.Done():
+		case <-ch:
+		}
+	}
+}
+
+// Discovery 监听服务路径下的实例，可以作为httplib的Balancer使用
+type Discovery struct {
+	client    *ZookeeperProxy
+	path      string
+	instances atomic.Value // []Instance
+	next      uint32
+	cancel    func()
+	wg        sync.WaitGroup
+
+	mu        sync.Mutex
+	listeners []func([]Instance)
+}
+
+// NewDiscovery 创建服务发现并开始监听，root为空时使用DefaultRegistryRoot
+func NewDiscovery(client *ZookeeperProxy, root, appName, clusterName string) *Discovery {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Discovery{
+		client: client,
+		path:   servicePath(root, appName, clusterName),
+		cancel: cancel,
+	}
+	d.instances.Store([]Instance{})
+	d.wg.Add(1)
+	go d.watch(ctx)
+	return d
+}
+
+// Instances 返回当前可用的实例，按地址排序
+func (d *Discovery) Instances() []Instance {
+	return d.instances.Load().([]Instance)
+}
+
+// Pick 轮询选择一个实例地址，实现了httplib.Balancer
+func (d *Discovery) Pick() (string, error) {
+	instances := d.Instances()
+	if len(instances) == 0 {
+		return "", ErrNoInstance
+	}
+	i := atomic.AddUint32(&d.next, 1)
+	return instances[i%uint32(len(instances))].Address, nil
+}
+
+// OnChange 添加实例变化的回调
+func (d *Discovery) OnChange(f func([]Instance)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.listeners = append(d.listeners, f)
+}
+
+// Close 停止监听
+func (d *Discovery) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Discovery) watch(ctx context.Context) {
+	defer d.wg.Done()
+	backoff := minRetryBackoff
+	for ctx.Err() == nil {
+		children, _, ch, err := d.client.conn().ChildrenW(d.path)
+		if err == zk.ErrNoNode {
+			// 服务路径不存在时等待其被创建
+			var exists bool
+			exists, _, ch, err = d.client.conn().ExistsW(d.path)
+			if err == nil && exists {
+				continue
+			}
+		}
+		if err != nil {
+			log.Errorf("zk: watch service %s failed: %s", d.path, err)
+			sleep(ctx, backoff)
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = minRetryBackoff
+		d.update(children)
+
+		select {
+		case <-ctx.Done():
+		case <-ch:
+		}
+	}
+}
+
+func (d *Discovery) update(children []string) {
+	instances := make([]Instance, 0, len(children))
+	for _, child := range children {
+		data, _, err := d.client.conn().Get(path.Join(d.path, child))
+		if err != nil {
+			if err != zk.ErrNoNode {
+				log.Errorf("zk: get instance %s/%s failed: %s", d.path, child, err)
+			}
+			continue
+		}
+		var ins Instance
+		if err := json.Unmarshal(data, &ins); err != nil || ins.Address == "" {
+			log.Warnf("zk: ignore invalid instance %s/%s", d.path, child)
+			continue
+		}
+		instances = append(instances, ins)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Address < instances[j].Address
+	})
+	d.instances.Store(instances)
+
+	d.mu.Lock()
+	listeners := append([]func([]Instance){}, d.listeners...)
+	d.mu.Unlock()
+	for _, f := range listeners {
+		f(instances)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	f := newFakeZk()
+	c1, c2, c3 := f.proxy(), f.proxy(), f.proxy()
+
+	d := NewDiscovery(c3, "", "app", "cluster")
+	defer d.Close()
+	changes := make(chan []Instance, 10)
+	d.OnChange(func(instances []Instance) { changes <- instances })
+	_, err := d.Pick()
+	assert.Equal(t, ErrNoInstance, err)
+
+	r1 := NewRegistry(c1, "")
+	assert.Error(t, r1.Register(Instance{AppName: "app"}))
+	assert.NoError(t, r1.Register(Instance{
+		AppName:     "app",
+		ClusterName: "cluster",
+		Address:     "10.0.0.1:8080",
+		Metadata:    map[string]string{"zone": "a"},
+	}))
+	assert.Error(t, r1.Register(Instance{AppName: "app", ClusterName: "cluster", Address: "10.0.0.1:8080"}))
+	assert.Equal(t, "/ngo/services/app/cluster/"+r1.prefix+"0000000000", r1.Path())
+
+	r2 := NewRegistry(c2, "")
+	assert.NoError(t, r2.Register(Instance{AppName: "app", ClusterName: "cluster", Address: "10.0.0.2:8080"}))
+
+	assert.Eventually(t, func() bool {
+		return len(d.Instances()) == 2
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, "a", d.Instances()[0].Metadata["zone"])
+	picked := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		addr, err := d.Pick()
+		assert.NoError(t, err)
+		picked[addr] = true
+	}
+	assert.Equal(t, map[string]bool{"10.0.0.1:8080": true, "10.0.0.2:8080": true}, picked)
+
+	// 会话过期后临时节点被删除，自动重新注册
+	c1.c.(*fakeConn).expire()
+	assert.Eventually(t, func() bool {
+		return r1.Path() == "/ngo/services/app/cluster/"+r1.prefix+"0000000002"
+	}, time.Second, time.Millisecond*10)
+	assert.Eventually(t, func() bool {
+		return len(d.Instances()) == 2
+	}, time.Second, time.Millisecond*10)
+
+	// 注销后不再被发现
+	assert.NoError(t, r2.Deregister())
+	assert.NoError(t, r2.Deregister())
+	assert.Eventually(t, func() bool {
+		instances := d.Instances()
+		return len(instances) == 1 && instances[0].Address == "10.0.0.1:8080"
+	}, time.Second, time.Millisecond*10)
+	assert.NoError(t, r1.Deregister())
+	assert.Eventually(t, func() bool {
+		return len(d.Instances()) == 0
+	}, time.Second, time.Millisecond*10)
+	assert.NotEmpty(t, changes)
+}
+
+// lossyConn 创建成功但返回错误，模拟响应丢失
+type lossyConn struct {
+	*fakeConn
+}
+
+func (c *lossyConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	if _, err := c.fakeConn.Create(p, data, flags, acl); err != nil {
+		return "", err
+	}
+	if flags&zk.FlagSequence == 0 {
+		return p, nil
+	}
+	return "", zk.ErrConnectionClosed
+}
+
+func TestRegistry_CreateLost(t *testing.T) {
+	f := newFakeZk()
+	c := f.proxy()
+	c.c = &lossyConn{c.c.(*fakeConn)}
+
+	r := NewRegistry(c, "")
+	assert.True(t, strings.HasPrefix(r.prefix, instancePrefix))
+	assert.NoError(t, r.Register(Instance{AppName: "app", ClusterName: "cluster", Address: "10.0.0.1:8080"}))
+	assert.Equal(t, "/ngo/services/app/cluster/"+r.prefix+"0000000000", r.Path())
+	children, _, err := c.conn().Children("/ngo/services/app/cluster")
+	assert.NoError(t, err)
+	assert.Len(t, children, 1)
+	assert.NoError(t, r.Deregister())
+	children, _, err = c.conn().Children("/ngo/services/app/cluster")
+	assert.NoError(t, err)
+	assert.Empty(t, children)
+}
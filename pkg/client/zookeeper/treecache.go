@@ -0,0 +1,298 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+// TreeEvent 是TreeCache中节点的变化，Type为EventCreated、EventDataChanged或EventDeleted
+type TreeEvent struct {
+	Type EventType
+	Path string
+	Data []byte // 当前数据，删除时为删除前的数据
+}
+
+// TreeCache 监听root及其所有子孙节点，在本地保存整棵子树的镜像
+type TreeCache struct {
+	client *ZookeeperProxy
+	root   string
+
+	mu        sync.RWMutex
+	nodes     map[string]*treeNode // 正在监听的节点
+	listeners []func(TreeEvent)
+	emitMu    sync.Mutex
+
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+type treeNode struct {
+	data     []byte
+	stat     *zk.Stat // 节点不存在时为nil
+	children []string
+	cancel   func()
+}
+
+// NewTreeCache 创建TreeCache，需要调用Start开始监听
+func NewTreeCache(client *ZookeeperProxy, root string) *TreeCache {
+	return &TreeCache{
+		client: client,
+		root:   path.Clean(root),
+		nodes:  make(map[string]*treeNode),
+	}
+}
+
+// Start 开始监听并等待初始的子树加载完成，初始加载的节点不会触发回调。
+// ctx只用于等待加载，ctx结束时停止监听并返回错误，之后需要调用Close停止监听
+func (tc *TreeCache) Start(ctx context.Context) error {
+	tc.mu.Lock()
+	if tc.cancel != nil {
+		tc.mu.Unlock()
+		return errors.New("zk: tree cache has started")
+	}
+	watchCtx, cancel := context.WithCancel(context.Background())
+	tc.cancel = cancel
+	var synced sync.WaitGroup
+	synced.Add(1)
+	tc.spawn(watchCtx, tc.root, &synced)
+	tc.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		synced.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		tc.Close()
+		return ctx.Err()
+	}
+}
+
+// Close 停止监听
+func (tc *TreeCache) Close() {
+	tc.mu.Lock()
+	cancel := tc.cancel
+	tc.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		tc.wg.Wait()
+	}
+}
+
+// Get 返回节点的数据，节点不存在时ok为false
+func (tc *TreeCache) Get(p string) (data []byte, ok bool) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	n := tc.nodes[p]
+	if n == nil || n.stat == nil {
+		return nil, false
+	}
+	return n.data, true
+}
+
+// Children 返回节点的子节点名称，按名称排序
+func (tc *TreeCache) Children(p string) []string {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	n := tc.nodes[p]
+	if n == nil || n.stat == nil {
+		return nil
+	}
+	return append([]string(nil), n.children...)
+}
+
+// Snapshot 返回所有存在的节点及其数据
+func (tc *TreeCache) Snapshot() map[string][]byte {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	ret := make(map[string][]byte, len(tc.nodes))
+	for p, n := range tc.nodes {
+		if n.stat != nil {
+			ret[p] = n.data
+		}
+	}
+	return ret
+}
+
+// OnChange 添加节点变化的回调，回调按顺序执行
+func (tc *TreeCache) OnChange(f func(TreeEvent)) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.listeners = append(tc.listeners, f)
+}
+
+// spawn 开始监听节点，synced不为nil时节点属于初始加载，需持有写锁
+func (tc *TreeCache) spawn(ctx context.Context, p string, synced *sync.WaitGroup) {
+	ctx, cancel := context.WithCancel(ctx)
+	n := &treeNode{cancel: cancel}
+	tc.nodes[p] = n
+	tc.wg.Add(1)
+	go tc.run(ctx, p, n, synced)
+}
+
+// run 同时监听节点和它的子节点，子节点使用从ctx派生的context，删除时一起取消
+func (tc *TreeCache) run(ctx context.Context, p string, n *treeNode, synced *sync.WaitGroup) {
+	defer tc.wg.Done()
+	defer func() {
+		// 初始加载完成前被移除
+		if synced != nil {
+			synced.Done()
+		}
+	}()
+	nodeEvents := tc.client.WatchNode(ctx, p)
+	childrenEvents := tc.client.WatchChildren(ctx, p)
+	nodeInited, childrenInited := false, false
+	for nodeEvents != nil || childrenEvents != nil {
+		select {
+		case e, ok := <-nodeEvents:
+			if !ok {
+				nodeEvents = nil
+				continue
+			}
+			if e.Type == EventError {
+				log.Errorf("zk: tree cache watch %s failed: %s", p, e.Err)
+				continue
+			}
+			tc.onNode(n, e, synced != nil)
+			nodeInited = nodeInited || e.Type == EventInit
+		case e, ok := <-childrenEvents:
+			if !ok {
+				childrenEvents = nil
+				continue
+			}
+			if e.Type == EventError {
+				log.Errorf("zk: tree cache watch children of %s failed: %s", p, e.Err)
+				continue
+			}
+			tc.onChildren(ctx, n, e, synced)
+			childrenInited = childrenInited || e.Type == EventInit
+		}
+		if synced != nil && nodeInited && childrenInited {
+			synced.Done()
+			synced = nil
+		}
+	}
+}
+
+func (tc *TreeCache) onNode(n *treeNode, e NodeEvent, initial bool) {
+	tc.mu.Lock()
+	if tc.nodes[e.Path] != n {
+		// 节点已被父节点移除
+		tc.mu.Unlock()
+		return
+	}
+	var events []TreeEvent
+	switch e.Type {
+	case EventInit:
+		if e.Stat != nil && !initial {
+			// 后续新增的节点
+			events = append(events, TreeEvent{Type: EventCreated, Path: e.Path, Data: e.Data})
+		}
+		n.data, n.stat = e.Data, e.Stat
+	case EventCreated, EventDataChanged:
+		events = append(events, TreeEvent{Type: e.Type, Path: e.Path, Data: e.Data})
+		n.data, n.stat = e.Data, e.Stat
+	case EventDeleted:
+		if n.stat != nil {
+			events = append(events, TreeEvent{Type: EventDeleted, Path: e.Path, Data: n.data})
+		}
+		n.data, n.stat = nil, nil
+	}
+	tc.mu.Unlock()
+	tc.emit(events)
+}
+
+func (tc *TreeCache) onChildren(ctx context.Context, n *treeNode, e ChildrenEvent, synced *sync.WaitGroup) {
+	tc.mu.Lock()
+	if tc.nodes[e.Path] != n {
+		tc.mu.Unlock()
+		return
+	}
+	n.children = e.Children
+	added := e.Added
+	if e.Type == EventInit {
+		added = e.Children
+	} else {
+		// 只有初始加载时发现的子节点属于初始加载
+		synced = nil
+	}
+	for _, child := range added {
+		if synced != nil {
+			synced.Add(1)
+		}
+		tc.spawn(ctx, path.Join(e.Path, child), synced)
+	}
+	var events []TreeEvent
+	for _, child := range e.Removed {
+		events = append(events, tc.remove(path.Join(e.Path, child))...)
+	}
+	tc.mu.Unlock()
+	tc.emit(events)
+}
+
+// remove 停止监听节点及其子孙节点，返回其中仍存在的节点的删除事件，需持有写锁
+func (tc *TreeCache) remove(p string) []TreeEvent {
+	n := tc.nodes[p]
+	if n == nil {
+		return nil
+	}
+	n.cancel()
+	var removed []string
+	prefix := p + "/"
+	for np := range tc.nodes {
+		if np == p || strings.HasPrefix(np, prefix) {
+			removed = append(removed, np)
+		}
+	}
+	// 子孙节点在前
+	sort.Sort(sort.Reverse(sort.StringSlice(removed)))
+	var events []TreeEvent
+	for _, np := range removed {
+		if n := tc.nodes[np]; n.stat != nil {
+			events = append(events, TreeEvent{Type: EventDeleted, Path: np, Data: n.data})
+		}
+		delete(tc.nodes, np)
+	}
+	return events
+}
+
+func (tc *TreeCache) emit(events []TreeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	tc.emitMu.Lock()
+	defer tc.emitMu.Unlock()
+	tc.mu.RLock()
+	listeners := append([]func(TreeEvent){}, tc.listeners...)
+	tc.mu.RUnlock()
+	for _, e := range events {
+		for _, f := range listeners {
+			f(e)
+		}
+	}
+}
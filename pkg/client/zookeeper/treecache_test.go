@@ -0,0 +1,103 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeCache(t *testing.T) {
+	f := newFakeZk()
+	c := f.proxy()
+	create := func(p, data string) {
+		assert.NoError(t, c.createParents(p))
+		_, err := c.conn().Create(p, []byte(data), 0, zk.WorldACL(zk.PermAll))
+		assert.NoError(t, err)
+	}
+	create("/tree/a", "1")
+	create("/tree/b/c", "2")
+
+	tc := NewTreeCache(c, "/tree")
+	events := make(chan TreeEvent, 10)
+	tc.OnChange(func(e TreeEvent) { events <- e })
+	assert.NoError(t, tc.Start(context.Background()))
+	defer tc.Close()
+	assert.Error(t, tc.Start(context.Background()))
+
+	// 初始加载不触发回调
+	assert.Equal(t, map[string][]byte{
+		"/tree":     nil,
+		"/tree/a":   []byte("1"),
+		"/tree/b":   nil,
+		"/tree/b/c": []byte("2"),
+	}, tc.Snapshot())
+	assert.Equal(t, []string{"a", "b"}, tc.Children("/tree"))
+	assert.Empty(t, events)
+
+	next := func() TreeEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no tree event")
+		}
+		return TreeEvent{}
+	}
+
+	_, err := c.conn().Set("/tree/b/c", []byte("3"), -1)
+	assert.NoError(t, err)
+	assert.Equal(t, TreeEvent{Type: EventDataChanged, Path: "/tree/b/c", Data: []byte("3")}, next())
+	data, ok := tc.Get("/tree/b/c")
+	assert.True(t, ok)
+	assert.Equal(t, "3", string(data))
+
+	// 新增的节点及其子节点
+	create("/tree/b/d", "4")
+	assert.Equal(t, TreeEvent{Type: EventCreated, Path: "/tree/b/d", Data: []byte("4")}, next())
+	create("/tree/b/d/e", "5")
+	assert.Equal(t, TreeEvent{Type: EventCreated, Path: "/tree/b/d/e", Data: []byte("5")}, next())
+	assert.Equal(t, []string{"c", "d"}, tc.Children("/tree/b"))
+
+	// 删除节点
+	assert.NoError(t, c.conn().Delete("/tree/b/d/e", -1))
+	e := next()
+	assert.Equal(t, EventDeleted, e.Type)
+	assert.Equal(t, "/tree/b/d/e", e.Path)
+	assert.Equal(t, "5", string(e.Data))
+	_, ok = tc.Get("/tree/b/d/e")
+	assert.False(t, ok)
+
+	// 会话过期期间的变化在重新监听后补发
+	c.c.(*fakeConn).expire()
+	other := f.proxy()
+	_, err = other.conn().Set("/tree/a", []byte("6"), -1)
+	assert.NoError(t, err)
+	assert.Equal(t, TreeEvent{Type: EventDataChanged, Path: "/tree/a", Data: []byte("6")}, next())
+}
+
+func TestTreeCacheStartCancel(t *testing.T) {
+	f := newFakeZk()
+	conn := &errConn{fakeConn: f.proxy().c.(*fakeConn), err: zk.ErrConnectionClosed}
+	tc := NewTreeCache(&ZookeeperProxy{c: conn}, "/tree")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, tc.Start(ctx))
+	tc.Close()
+}
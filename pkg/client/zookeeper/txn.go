@@ -0,0 +1,77 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"github.com/go-zookeeper/zk"
+)
+
+// Txn 是zookeeper的multi事务，所有操作要么全部成功，要么全部不执行
+type Txn struct {
+	z   *ZookeeperProxy
+	ops []interface{}
+}
+
+// Txn 创建事务
+func (z *ZookeeperProxy) Txn() *Txn {
+	return &Txn{z: z}
+}
+
+// Create 使用默认ACL创建节点
+func (t *Txn) Create(p string, data []byte, flags int32) *Txn {
+	return t.CreateWithACL(p, data, flags, t.z.ACL())
+}
+
+// CreateWithACL 使用指定的ACL创建节点
+func (t *Txn) CreateWithACL(p string, data []byte, flags int32, acl []zk.ACL) *Txn {
+	t.ops = append(t.ops, &zk.CreateRequest{Path: p, Data: data, Acl: acl, Flags: flags})
+	return t
+}
+
+// Set 设置节点数据，version为期望的版本，AnyVersion时不检查
+func (t *Txn) Set(p string, data []byte, version int32) *Txn {
+	t.ops = append(t.ops, &zk.SetDataRequest{Path: p, Data: data, Version: version})
+	return t
+}
+
+// Remove 删除节点，version为期望的版本，AnyVersion时不检查
+func (t *Txn) Remove(p string, version int32) *Txn {
+	t.ops = append(t.ops, &zk.DeleteRequest{Path: p, Version: version})
+	return t
+}
+
+// Check 检查节点的版本，版本不一致时事务失败
+func (t *Txn) Check(p string, version int32) *Txn {
+	t.ops = append(t.ops, &zk.CheckVersionRequest{Path: p, Version: version})
+	return t
+}
+
+// Commit 提交事务，返回每个操作的结果。失败时返回第一个失败操作的错误
+func (t *Txn) Commit() ([]zk.MultiResponse, error) {
+	return t.z.Multi(t.ops...)
+}
+
+// Multi 原子地执行多个操作，ops为*zk.CreateRequest、*zk.SetDataRequest、*zk.DeleteRequest或*zk.CheckVersionRequest。
+// 失败时返回第一个失败操作的错误
+func (z *ZookeeperProxy) Multi(ops ...interface{}) ([]zk.MultiResponse, error) {
+	resps, err := z.conn().Multi(ops...)
+	for _, r := range resps {
+		// 失败操作之前的操作没有错误，之后的操作为runtimeInconsistency
+		if r.Error != nil {
+			return resps, r.Error
+		}
+	}
+	return resps, err
+}
@@ -0,0 +1,103 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"path"
+	"testing"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeAPI(t *testing.T) {
+	c := newFakeZk().proxy()
+
+	_, err := c.Create("/a/b", []byte("1"), 0)
+	assert.Equal(t, zk.ErrNoNode, err)
+	p, err := c.CreateRecursive("/a/b", []byte("1"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "/a/b", p)
+	_, err = c.Create("/a/b", nil, 0)
+	assert.Equal(t, zk.ErrNodeExists, err)
+	p, err = c.Create("/a/s-", nil, zk.FlagSequence)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^/a/s-\d{10}$`, p)
+
+	// 乐观锁
+	data, stat, err := c.Get("/a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(data))
+	_, err = c.Set("/a/b", []byte("2"), stat.Version+1)
+	assert.Equal(t, zk.ErrBadVersion, err)
+	stat, err = c.Set("/a/b", []byte("2"), stat.Version)
+	assert.NoError(t, err)
+	_, err = c.Set("/a/b", []byte("3"), AnyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, zk.ErrBadVersion, c.Remove("/a/b", stat.Version))
+
+	assert.Equal(t, zk.ErrNotEmpty, c.Remove("/a", AnyVersion))
+	_, err = c.CreateRecursive("/a/c/d/e", nil, 0)
+	assert.NoError(t, err)
+	children, _, err := c.Children("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", path.Base(p)}, children)
+	assert.NoError(t, c.RemoveRecursive("/a"))
+	assert.NoError(t, c.RemoveRecursive("/a"))
+	ok, _, err := c.Exists("/a")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 兼容的接口
+	assert.True(t, c.CreateNode("/x", 0, "1"))
+	assert.True(t, c.SetData("/x", "2"))
+	assert.True(t, c.Exist("/x"))
+	assert.True(t, c.Delete("/x"))
+	assert.False(t, c.Delete("/x"))
+}
+
+func TestTxn(t *testing.T) {
+	c := newFakeZk().proxy()
+	_, err := c.Create("/a", []byte("1"), 0)
+	assert.NoError(t, err)
+
+	// 失败时全部不执行
+	resps, err := c.Txn().
+		Create("/b", nil, 0).
+		Set("/a", []byte("2"), 1).
+		Commit()
+	assert.Equal(t, zk.ErrBadVersion, err)
+	assert.Len(t, resps, 2)
+	ok, _, _ := c.Exists("/b")
+	assert.False(t, ok)
+
+	resps, err = c.Txn().
+		Check("/a", 0).
+		Create("/b", []byte("b"), 0).
+		Set("/a", []byte("2"), 0).
+		Remove("/b", AnyVersion).
+		Create("/c", nil, 0).
+		Commit()
+	assert.NoError(t, err)
+	assert.Len(t, resps, 5)
+	assert.Equal(t, "/b", resps[1].String)
+	assert.Equal(t, int32(1), resps[2].Stat.Version)
+	data, _, _ := c.Get("/a")
+	assert.Equal(t, "2", string(data))
+	ok, _, _ = c.Exists("/b")
+	assert.False(t, ok)
+	ok, _, _ = c.Exists("/c")
+	assert.True(t, ok)
+}
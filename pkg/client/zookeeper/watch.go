@@ -0,0 +1,269 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+)
+
+const watchBufferSize = 16
+
+// EventType 是监听事件的类型
+type EventType int
+
+const (
+	EventInit            EventType = iota // 开始监听时的当前状态
+	EventCreated                          // 节点被创建
+	EventDataChanged                      // 节点数据变化
+	EventDeleted                          // 节点被删除
+	EventChildrenChanged                  // 子节点变化
+	EventError                            // 读取或监听失败，之后会自动重试
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventInit:
+		return "init"
+	case EventCreated:
+		return "created"
+	case EventDataChanged:
+		return "dataChanged"
+	case EventDeleted:
+		return "deleted"
+	case EventChildrenChanged:
+		return "childrenChanged"
+	case EventError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// NodeEvent 是节点监听的事件
+type NodeEvent struct {
+	Type    EventType
+	Path    string
+	Data    []byte   // 当前数据，节点不存在时为nil
+	OldData []byte   // 变化前的数据
+	Stat    *zk.Stat // 当前状态，节点不存在时为nil
+	Err     error    // EventError时的错误
+}
+
+// ChildrenEvent 是子节点监听的事件
+type ChildrenEvent struct {
+	Type        EventType
+	Path        string
+	Children    []string // 当前子节点，按名称排序，节点不存在时为nil
+	OldChildren []string // 变化前的子节点
+	Added       []string // 新增的子节点
+	Removed     []string // 删除的子节点
+	Err         error    // EventError时的错误
+}
+
+// WatchNode 持续监听节点的创建、数据变化和删除，ctx结束后停止监听并关闭返回的channel。
+// 第一个事件为EventInit，节点不存在时也可以监听。读取失败时发送EventError并退避重试，
+// 会话过期后重新读取节点并补发期间发生的变化
+func (z *ZookeeperProxy) WatchNode(ctx context.Context, p string) <-chan NodeEvent {
+	ch := make(chan NodeEvent, watchBufferSize)
+	go z.watchNode(ctx, p, ch)
+	return ch
+}
+
+func (z *ZookeeperProxy) watchNode(ctx context.Context, p string, ch chan<- NodeEvent) {
+	defer close(ch)
+	send := func(e NodeEvent) bool {
+		select {
+		case ch <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var (
+		data    []byte
+		stat    *zk.Stat
+		inited  bool
+		backoff = minRetryBackoff
+	)
+	for ctx.Err() == nil {
+		newData, newStat, events, err := z.conn().GetW(p)
+		if err == zk.ErrNoNode {
+			// 节点不存在时等待其被创建
+			var exists bool
+			exists, _, events, err = z.conn().ExistsW(p)
+			if err == nil && exists {
+				continue
+			}
+			newData, newStat = nil, nil
+		}
+		if err != nil {
+			if !send(NodeEvent{Type: EventError, Path: p, Err: err}) {
+				return
+			}
+			sleep(ctx, backoff)
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = minRetryBackoff
+
+		for _, e := range nodeEvents(p, inited, data, stat, newData, newStat) {
+			if !send(e) {
+				return
+			}
+		}
+		inited = true
+		data, stat = newData, newStat
+
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if e.Type == zk.EventNotWatching {
+				log.Warnf("zk: watch %s lost: %v, watch again", p, e.Err)
+			}
+		}
+	}
+}
+
+// nodeEvents 比较节点的两次状态，Czxid变化说明节点被删除后又重新创建
+func nodeEvents(p string, inited bool, oldData []byte, oldStat *zk.Stat, data []byte, stat *zk.Stat) []NodeEvent {
+	if !inited {
+		return []NodeEvent{{Type: EventInit, Path: p, Data: data, Stat: stat}}
+	}
+	created := NodeEvent{Type: EventCreated, Path: p, Data: data, Stat: stat}
+	deleted := NodeEvent{Type: EventDeleted, Path: p, OldData: oldData}
+	switch {
+	case oldStat == nil && stat == nil:
+		return nil
+	case oldStat == nil:
+		return []NodeEvent{created}
+	case stat == nil:
+		return []NodeEvent{deleted}
+	case oldStat.Czxid != stat.Czxid:
+		return []NodeEvent{deleted, created}
+	case oldStat.Mzxid != stat.Mzxid:
+		return []NodeEvent{{Type: EventDataChanged, Path: p, Data: data, OldData: oldData, Stat: stat}}
+	}
+	return nil
+}
+
+// WatchChildren 持续监听节点的子节点变化，ctx结束后停止监听并关闭返回的channel。
+// 第一个事件为EventInit，节点不存在时子节点视为空。读取失败时发送EventError并退避重试，
+// 会话过期后重新读取子节点并补发期间发生的变化
+func (z *ZookeeperProxy) WatchChildren(ctx context.Context, p string) <-chan ChildrenEvent {
+	ch := make(chan ChildrenEvent, watchBufferSize)
+	go z.watchChildren(ctx, p, ch)
+	return ch
+}
+
+func (z *ZookeeperProxy) watchChildren(ctx context.Context, p string, ch chan<- ChildrenEvent) {
+	defer close(ch)
+	send := func(e ChildrenEvent) bool {
+		select {
+		case ch <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var (
+		children []string
+		inited   bool
+		backoff  = minRetryBackoff
+	)
+	for ctx.Err() == nil {
+		newChildren, _, events, err := z.conn().ChildrenW(p)
+		if err == zk.ErrNoNode {
+			var exists bool
+			exists, _, events, err = z.conn().ExistsW(p)
+			if err == nil && exists {
+				continue
+			}
+			newChildren = nil
+		}
+		if err != nil {
+			if !send(ChildrenEvent{Type: EventError, Path: p, Err: err}) {
+				return
+			}
+			sleep(ctx, backoff)
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = minRetryBackoff
+
+		newChildren = append([]string(nil), newChildren...)
+		sort.Strings(newChildren)
+		if !inited {
+			if !send(ChildrenEvent{Type: EventInit, Path: p, Children: newChildren}) {
+				return
+			}
+		} else if added, removed := diffChildren(children, newChildren); len(added) > 0 || len(removed) > 0 {
+			if !send(ChildrenEvent{
+				Type:        EventChildrenChanged,
+				Path:        p,
+				Children:    newChildren,
+				OldChildren: children,
+				Added:       added,
+				Removed:     removed,
+			}) {
+				return
+			}
+		}
+		inited = true
+		children = newChildren
+
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if e.Type == zk.EventNotWatching {
+				log.Warnf("zk: watch children of %s lost: %v, watch again", p, e.Err)
+			}
+		}
+	}
+}
+
+// diffChildren 返回两个有序子节点列表的差异
+func diffChildren(old, cur []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(old) || j < len(cur) {
+		switch {
+		case j == len(cur) || (i < len(old) && old[i] < cur[j]):
+			removed = append(removed, old[i])
+			i++
+		case i == len(old) || old[i] > cur[j]:
+			added = append(added, cur[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,158 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func nextNodeEvent(t *testing.T, ch <-chan NodeEvent) NodeEvent {
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no node event")
+	}
+	return NodeEvent{}
+}
+
+func nextChildrenEvent(t *testing.T, ch <-chan ChildrenEvent) ChildrenEvent {
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no children event")
+	}
+	return ChildrenEvent{}
+}
+
+func TestWatchNode(t *testing.T) {
+	f := newFakeZk()
+	c := f.proxy()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.WatchNode(ctx, "/node")
+
+	e := nextNodeEvent(t, ch)
+	assert.Equal(t, EventInit, e.Type)
+	assert.Nil(t, e.Stat)
+
+	_, err := c.conn().Create("/node", []byte("a"), 0, zk.WorldACL(zk.PermAll))
+	assert.NoError(t, err)
+	e = nextNodeEvent(t, ch)
+	assert.Equal(t, EventCreated, e.Type)
+	assert.Equal(t, "a", string(e.Data))
+
+	_, err = c.conn().Set("/node", []byte("b"), -1)
+	assert.NoError(t, err)
+	e = nextNodeEvent(t, ch)
+	assert.Equal(t, EventDataChanged, e.Type)
+	assert.Equal(t, "a", string(e.OldData))
+	assert.Equal(t, "b", string(e.Data))
+
+	// 会话过期期间节点被删除后重新创建
+	c.c.(*fakeConn).expire()
+	other := f.proxy()
+	assert.NoError(t, other.conn().Delete("/node", -1))
+	_, err = other.conn().Create("/node", []byte("c"), 0, zk.WorldACL(zk.PermAll))
+	assert.NoError(t, err)
+	e = nextNodeEvent(t, ch)
+	assert.Equal(t, EventDeleted, e.Type)
+	assert.Equal(t, "b", string(e.OldData))
+	e = nextNodeEvent(t, ch)
+	assert.Equal(t, EventCreated, e.Type)
+	assert.Equal(t, "c", string(e.Data))
+
+	assert.NoError(t, c.conn().Delete("/node", -1))
+	assert.Equal(t, EventDeleted, nextNodeEvent(t, ch).Type)
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchChildren(t *testing.T) {
+	f := newFakeZk()
+	c := f.proxy()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.WatchChildren(ctx, "/parent")
+
+	e := nextChildrenEvent(t, ch)
+	assert.Equal(t, EventInit, e.Type)
+	assert.Empty(t, e.Children)
+
+	assert.NoError(t, c.createParents("/parent/a"))
+	_, err := c.conn().Create("/parent/a", nil, 0, zk.WorldACL(zk.PermAll))
+	assert.NoError(t, err)
+	e = nextChildrenEvent(t, ch)
+	assert.Equal(t, EventChildrenChanged, e.Type)
+	assert.Equal(t, []string{"a"}, e.Children)
+	assert.Equal(t, []string{"a"}, e.Added)
+
+	_, err = c.conn().Create("/parent/b", nil, 0, zk.WorldACL(zk.PermAll))
+	assert.NoError(t, err)
+	e = nextChildrenEvent(t, ch)
+	assert.Equal(t, []string{"a", "b"}, e.Children)
+	assert.Equal(t, []string{"a"}, e.OldChildren)
+
+	assert.NoError(t, c.conn().Delete("/parent/a", -1))
+	e = nextChildrenEvent(t, ch)
+	assert.Equal(t, []string{"b"}, e.Children)
+	assert.Equal(t, []string{"a"}, e.Removed)
+	assert.Empty(t, e.Added)
+
+	cancel()
+	for range ch {
+	}
+}
+
+type errConn struct {
+	*fakeConn
+	err error
+}
+
+func (c *errConn) GetW(string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	return nil, nil, nil, c.err
+}
+
+func TestWatchError(t *testing.T) {
+	f := newFakeZk()
+	conn := &errConn{fakeConn: f.proxy().c.(*fakeConn), err: errors.New("connection lost")}
+	c := &ZookeeperProxy{c: conn}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.WatchNode(ctx, "/node")
+
+	// 失败时报告错误并退避重试，不会空转
+	e := nextNodeEvent(t, ch)
+	assert.Equal(t, EventError, e.Type)
+	assert.Equal(t, conn.err, e.Err)
+	select {
+	case <-ch:
+		t.Fatal("retry without backoff")
+	case <-time.After(minRetryBackoff / 2):
+	}
+	cancel()
+	for range ch {
+	}
+
+	added, removed := diffChildren([]string{"a", "b"}, []string{"b", "c"})
+	assert.Equal(t, []string{"c"}, added)
+	assert.Equal(t, []string{"a"}, removed)
+}
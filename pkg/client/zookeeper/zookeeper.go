@@ -15,6 +15,9 @@
 package zookeeper
 
 import (
+	"context"
+	"path"
+
 	"github.com/go-zookeeper/zk"
 )
 
@@ -23,55 +26,126 @@ func GetZkClient(name string) *ZookeeperProxy {
 	return zookeeperClients[name]
 }
 
+// AnyVersion 表示不检查节点版本
+const AnyVersion int32 = -1
+
+// ACL 返回创建节点时默认的ACL
+func (z *ZookeeperProxy) ACL() []zk.ACL {
+	if len(z.acl) == 0 {
+		return zk.WorldACL(zk.PermAll)
+	}
+	return z.acl
+}
+
+// Create 使用默认ACL创建节点，返回创建的路径，顺序节点的路径带有序号。
+// flags为0(永久)、zk.FlagEphemeral(临时)、zk.FlagSequence(顺序)或它们的组合
+func (z *ZookeeperProxy) Create(p string, data []byte, flags int32) (string, error) {
+	return z.conn().Create(p, data, flags, z.ACL())
+}
+
+// CreateWithACL 使用指定的ACL创建节点
+func (z *ZookeeperProxy) CreateWithACL(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	return z.conn().Create(p, data, flags, acl)
+}
+
+// CreateRecursive 创建节点，上级节点不存在时先创建永久的上级节点
+func (z *ZookeeperProxy) CreateRecursive(p string, data []byte, flags int32) (string, error) {
+	if err := z.createParents(p); err != nil {
+		return "", err
+	}
+	return z.Create(p, data, flags)
+}
+
+// Get 返回节点的数据和状态，节点不存在时返回zk.ErrNoNode
+func (z *ZookeeperProxy) Get(p string) ([]byte, *zk.Stat, error) {
+	return z.conn().Get(p)
+}
+
+// Exists 返回节点是否存在，存在时同时返回状态
+func (z *ZookeeperProxy) Exists(p string) (bool, *zk.Stat, error) {
+	return z.conn().Exists(p)
+}
+
+// Children 返回子节点名称
+func (z *ZookeeperProxy) Children(p string) ([]string, *zk.Stat, error) {
+	return z.conn().Children(p)
+}
+
+// Set 设置节点数据，version为期望的版本，版本不一致时返回zk.ErrBadVersion，AnyVersion时不检查
+func (z *ZookeeperProxy) Set(p string, data []byte, version int32) (*zk.Stat, error) {
+	return z.conn().Set(p, data, version)
+}
+
+// Remove 删除节点，version为期望的版本，AnyVersion时不检查，有子节点时返回zk.ErrNotEmpty
+func (z *ZookeeperProxy) Remove(p string, version int32) error {
+	return z.conn().Delete(p, version)
+}
+
+// RemoveRecursive 删除节点及其所有子孙节点，节点不存在时不返回错误。
+// 删除不是原子的，期间有新的子节点被创建时返回zk.ErrNotEmpty
+func (z *ZookeeperProxy) RemoveRecursive(p string) error {
+	children, _, err := z.conn().Children(p)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := z.RemoveRecursive(path.Join(p, child)); err != nil {
+			return err
+		}
+	}
+	if err := z.conn().Delete(p, AnyVersion); err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+// GetACL 返回节点的ACL
+func (z *ZookeeperProxy) GetACL(p string) ([]zk.ACL, *zk.Stat, error) {
+	return z.conn().GetACL(p)
+}
+
+// SetACL 设置节点的ACL，version为期望的ACL版本(Stat.Aversion)，AnyVersion时不检查
+func (z *ZookeeperProxy) SetACL(p string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	return z.conn().SetACL(p, acl, version)
+}
+
 // 创建节点
+//
+// Deprecated: 使用返回错误的Create
 func (z *ZookeeperProxy) CreateNode(path string, flags int32, s string) bool {
-	data := []byte(s)
-	acls := zk.WorldACL(zk.PermAll) // 获取访问控制权限
 	// flags有4种取值:
 	//   0:永久,除非手动删除
 	//   1:短暂,session断开则改节点也被删除
 	//   2:会自动在节点后面添加序号
 	//   3:即,短暂且自动添加序号
-	_, err := z.Conn.Create(path, data, flags, acls)
-	if err != nil {
-		return false
-	} else {
-		return true
-	}
+	_, err := z.Create(path, []byte(s), flags)
+	return err == nil
 }
 
 // 判断节点是否存在
+//
+// Deprecated: 使用返回错误的Exists
 func (z *ZookeeperProxy) Exist(path string) bool {
-	sign, _, _ := z.Conn.Exists(path)
+	sign, _, _ := z.conn().Exists(path)
 	return sign
 }
 
 // 设置节点值
+//
+// Deprecated: 使用返回错误的Set
 func (z *ZookeeperProxy) SetData(path string, s string) bool {
-	data := []byte(s)
-	_, stat, err := z.Conn.Get(path)
-	if err != nil {
-		return false
-	}
-	_, err = z.Conn.Set(path, data, stat.Version)
-	if err != nil {
-		return false
-	} else {
-		return true
-	}
+	_, err := z.Set(path, []byte(s), AnyVersion)
+	return err == nil
 }
 
 // 删除节点
+//
+// Deprecated: 使用返回错误的Remove
 func (z *ZookeeperProxy) Delete(path string) bool {
-	_, stat, err := z.Conn.Get(path)
-	if err != nil {
-		return false
-	}
-	err_ := z.Conn.Delete(path, stat.Version)
-	if err_ != nil {
-		return false
-	}
-	return true
+	return z.Remove(path, AnyVersion) == nil
 }
 
 // 用来反馈监听子节点的结果
@@ -82,23 +156,21 @@ type NodeChildResponse struct {
 	Error       error    // 连接错误标志
 }
 
-// 循环监听子节点                        TODO: 由于第三方包没有实现相应的功能的支持，因此未完全实现对子节点的动态监听。 需要后续进行改进
+// 循环监听子节点，每次子节点变化或监听失败时通过新的channel回调listener，不会返回
+//
+// Deprecated: 使用可以取消的WatchChildren
 func (z *ZookeeperProxy) ZkPathChildrenWatcher(path string, listener func(respChan <-chan *NodeChildResponse)) {
-	for {
+	for e := range z.WatchChildren(context.Background(), path) {
 		respChan := make(chan *NodeChildResponse, 1)
-		oldChildren, _, child_ch, err := z.Conn.ChildrenW(path)
-		if err != nil {
-			respChan <- &NodeChildResponse{[]string{}, []string{}, "Can Not Watch The Children", err}
-		}
-		select {
-		case e := <-child_ch:
-			if e.Type == zk.EventNodeChildrenChanged {
-				newChildren, _, err := z.Conn.Children(path)
-				respChan <- &NodeChildResponse{oldChildren, newChildren, "NodeChildren changed", err}
-			}
-
-			listener(respChan)
+		switch e.Type {
+		case EventChildrenChanged:
+			respChan <- &NodeChildResponse{e.OldChildren, e.Children, "NodeChildren changed", nil}
+		case EventError:
+			respChan <- &NodeChildResponse{[]string{}, []string{}, "Can Not Watch The Children", e.Err}
+		default:
+			continue
 		}
+		listener(respChan)
 	}
 }
 
@@ -110,30 +182,24 @@ type NodeResponse struct {
 	Error    error  // 连接错误标志
 }
 
-// 循环监听当前节点
+// 循环监听当前节点，每次节点变化或监听失败时通过新的channel回调listener，不会返回
+//
+// Deprecated: 使用可以取消的WatchNode
 func (z *ZookeeperProxy) ZkNodeWatcher(path string, listener func(respChan <-chan *NodeResponse)) {
-
-	for {
+	for e := range z.WatchNode(context.Background(), path) {
 		respChan := make(chan *NodeResponse, 1)
-		oldData, _, events, err := z.Conn.GetW(path)
-		if err != nil {
-			respChan <- &NodeResponse{"", "", "Can Not Watch This Node " + path, err}
-		}
-		select {
-		case e := <-events:
-			if e.Type == zk.EventNodeDataChanged {
-				newData, _, err := z.Conn.Get(path)
-				if err != nil {
-					respChan <- &NodeResponse{string(oldData), "", "Can Not Get New Data", err}
-				} else {
-					respChan <- &NodeResponse{string(oldData), string(newData), "This Node " + path + " Node Data Changed", nil}
-				}
-			}
-
-			if e.Type == zk.EventNodeDeleted {
-				respChan <- &NodeResponse{string(oldData), "", "This Node " + path + " Node was deleted", nil}
-			}
-			listener(respChan)
+		switch e.Type {
+		case EventCreated:
+			respChan <- &NodeResponse{"", string(e.Data), "This Node " + path + " Node was created", nil}
+		case EventDataChanged:
+			respChan <- &NodeResponse{string(e.OldData), string(e.Data), "This Node " + path + " Node Data Changed", nil}
+		case EventDeleted:
+			respChan <- &NodeResponse{string(e.OldData), "", "This Node " + path + " Node was deleted", nil}
+		case EventError:
+			respChan <- &NodeResponse{"", "", "Can Not Watch This Node " + path, e.Err}
+		default:
+			continue
 		}
+		listener(respChan)
 	}
 }
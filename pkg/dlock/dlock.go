@@ -16,11 +16,14 @@ package dlock
 
 import (
 	"errors"
+	"fmt"
 	"math/rand"
+	"path"
 	"time"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 	ngoredis "github.com/NetEase-Media/ngo/pkg/client/redis"
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
 	"github.com/NetEase-Media/ngo/pkg/dlock/redis"
 )
 
@@ -35,7 +38,7 @@ func Init(opt Options) error {
 	if defaultDlock != nil {
 		panic("duplicated init dlock")
 	}
-	if len(opt.Pools) == 0 {
+	if len(opt.Pools) == 0 && opt.Zookeeper == "" {
 		log.Info("empty dlock config, so skip init")
 		return nil
 	}
@@ -48,13 +51,26 @@ func Init(opt Options) error {
 			pools = append(pools, pool)
 		}
 	}
-	if len(pools) < 1 {
+	if len(opt.Pools) > 0 && len(pools) < 1 {
 		return errors.New("there must be at least one pool")
 	}
-	defaultDlock = New(pools...)
+	d := New(pools...)
+	if opt.Zookeeper != "" {
+		client := zookeeper.GetZkClient(opt.Zookeeper)
+		if client == nil {
+			return fmt.Errorf("zookeeper client %s not found", opt.Zookeeper)
+		}
+		d.WithZookeeper(client, opt.ZkRoot)
+	}
+	defaultDlock = d
 	return nil
 }
 
+// Default 返回Init创建的Dlock，未初始化时为nil
+func Default() *Dlock {
+	return defaultDlock
+}
+
 func New(pools ...redis.Pool) *Dlock {
 	return &Dlock{
 		pools: pools,
@@ -65,22 +81,54 @@ func NewMutex(key string, action Action) *Mutex {
 	return defaultDlock.NewMutex(key, action)
 }
 
+// NewZkMutex 使用配置的zookeeper创建锁
+func NewZkMutex(name string, action Action) *ZkMutex {
+	return defaultDlock.NewZkMutex(name, action)
+}
+
 type Options struct {
-	Pools []string
+	Pools     []string
+	Zookeeper string // 使用的zookeeper配置名，为空时不能使用zookeeper锁
+	ZkRoot    string // zookeeper锁节点的根路径，默认为DefaultZkRoot
 }
 
 type Dlock struct {
-	pools []redis.Pool
+	pools  []redis.Pool
+	zk     *zookeeper.ZookeeperProxy
+	zkRoot string
+}
+
+// WithZookeeper 设置zookeeper锁使用的客户端和根路径，root为空时为DefaultZkRoot
+func (d *Dlock) WithZookeeper(client *zookeeper.ZookeeperProxy, root string) *Dlock {
+	if root == "" {
+		root = DefaultZkRoot
+	}
+	d.zk = client
+	d.zkRoot = root
+	return d
+}
+
+// mustHavePools 只配置了zookeeper时，基于redis的信号量和限流器没有可用的pool，直接panic
+func (d *Dlock) mustHavePools() {
+	if len(d.pools) == 0 {
+		panic("redis of dlock is not configured")
+	}
+}
+
+// NewZkMutex 创建zookeeper锁，锁节点在 zkRoot/name 下
+func (d *Dlock) NewZkMutex(name string, action Action) *ZkMutex {
+	if d.zk == nil {
+		panic("zookeeper of dlock is not configured")
+	}
+	return newZkMutex(d.zk, name, path.Join(d.zkRoot, name), action)
 }
 
 func (d *Dlock) NewMutex(name string, action Action) *Mutex {
 	return &Mutex{
-		name:   name,
-		expiry: 8 * time.Second,
-		tries:  32,
-		delayFunc: func(tries int) time.Duration {
-			return time.Duration(rand.Intn(maxRetryDelayMilliSec-minRetryDelayMilliSec)+minRetryDelayMilliSec) * time.Millisecond
-		},
+		name:         name,
+		expiry:       8 * time.Second,
+		tries:        32,
+		delayFunc:    defaultDelay,
 		genValueFunc: genValue,
 		factor:       0.01,
 		quorum:       len(d.pools)/2 + 1,
@@ -88,3 +136,7 @@ func (d *Dlock) NewMutex(name string, action Action) *Mutex {
 		action:       action,
 	}
 }
+
+func defaultDelay(tries int) time.Duration {
+	return time.Duration(rand.Intn(maxRetryDelayMilliSec-minRetryDelayMilliSec)+minRetryDelayMilliSec) * time.Millisecond
+}
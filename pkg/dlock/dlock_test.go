@@ -19,13 +19,15 @@ import (
 	"fmt"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
 	ngoredis "github.com/NetEase-Media/ngo/pkg/client/redis"
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
 	"github.com/NetEase-Media/ngo/pkg/dlock/redis"
-	"github.com/alicebob/miniredis"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -144,3 +146,484 @@ func initDlock(rcs ...ngoredis.Redis) *Dlock {
 	dlock := New(pools...)
 	return dlock
 }
+
+func newTestDlock(t *testing.T, n int) (*Dlock, []*miniredis.Miniredis) {
+	rcs := make([]ngoredis.Redis, n)
+	servers := make([]*miniredis.Miniredis, n)
+	for i := range rcs {
+		s, err := miniredis.Run()
+		assert.NoError(t, err)
+		t.Cleanup(s.Close)
+		servers[i] = s
+		rcs[i] = ngoredis.NewClient(&ngoredis.Options{
+			Name: fmt.Sprintf("test client %d", i),
+			Addr: []string{s.Addr()},
+		})
+		t.Cleanup(func() { rcs[i].Close() })
+	}
+	return initDlock(rcs...), servers
+}
+
+func TestReentrant(t *testing.T) {
+	dlock, _ := newTestDlock(t, 3)
+
+	m1 := dlock.NewMutex("reentrant", nil).WithReentrant("owner1").WithTries(1)
+	m2 := dlock.NewMutex("reentrant", nil).WithReentrant("owner1").WithTries(1)
+	other := dlock.NewMutex("reentrant", nil).WithReentrant("owner2").WithTries(1)
+
+	succ, err := m1.Lock()
+	assert.True(t, succ)
+	assert.NoError(t, err)
+	// 同一owner可以重复获取
+	succ, err = m2.Lock()
+	assert.True(t, succ)
+	assert.NoError(t, err)
+	succ, _ = other.Lock()
+	assert.False(t, succ)
+
+	// 释放次数与获取次数相同后才真正释放
+	succ, _ = m2.Unlock()
+	assert.True(t, succ)
+	valid, _ := m1.Valid()
+	assert.True(t, valid)
+	succ, _ = other.Lock()
+	assert.False(t, succ)
+	succ, _ = m1.Unlock()
+	assert.True(t, succ)
+	valid, _ = m1.Valid()
+	assert.False(t, valid)
+	succ, _ = other.Lock()
+	assert.True(t, succ)
+	succ, _ = other.Extend()
+	assert.True(t, succ)
+
+	// 嵌套执行不会死锁
+	var executed bool
+	succ, _, err = dlock.NewMutex("nested", func() {
+		_, executed, _ = dlock.NewMutex("nested", func() {}).WithReentrant("job").WithTries(1).Do()
+	}).WithReentrant("job").Do()
+	assert.True(t, succ)
+	assert.NoError(t, err)
+	assert.True(t, executed)
+}
+
+func TestRWMutex(t *testing.T) {
+	dlock, _ := newTestDlock(t, 3)
+	rw := dlock.NewRWMutex("rw")
+
+	r1 := rw.RLocker(nil).WithTries(1)
+	r2 := rw.RLocker(nil).WithTries(1)
+	w1 := rw.Locker(nil).WithTries(1)
+	w2 := rw.Locker(nil).WithTries(1)
+
+	// 多个读者
+	succ, err := r1.Lock()
+	assert.True(t, succ)
+	assert.NoError(t, err)
+	succ, _ = r2.Lock()
+	assert.True(t, succ)
+	succ, _ = w1.Lock()
+	assert.False(t, succ)
+	succ, _ = r1.Unlock()
+	assert.True(t, succ)
+	succ, _ = w1.Lock()
+	assert.False(t, succ)
+	succ, _ = r2.Extend()
+	assert.True(t, succ)
+	succ, _ = r2.Unlock()
+	assert.True(t, succ)
+
+	// 一个写者
+	succ, _ = w1.Lock()
+	assert.True(t, succ)
+	succ, _ = w2.Lock()
+	assert.False(t, succ)
+	succ, _ = r1.Lock()
+	assert.False(t, succ)
+	valid, _ := w1.Valid()
+	assert.True(t, valid)
+	succ, _ = w1.Unlock()
+	assert.True(t, succ)
+	succ, _ = r1.Lock()
+	assert.True(t, succ)
+	succ, _ = r1.Unlock()
+	assert.True(t, succ)
+
+	// 写锁对同一owner可重入
+	w3 := rw.Locker(nil).WithReentrant("writer").WithTries(1)
+	w4 := rw.Locker(nil).WithReentrant("writer").WithTries(1)
+	succ, _ = w3.Lock()
+	assert.True(t, succ)
+	succ, _ = w4.Lock()
+	assert.True(t, succ)
+	succ, _ = w4.Unlock()
+	assert.True(t, succ)
+	succ, _ = r1.Lock()
+	assert.False(t, succ)
+	succ, _ = w3.Unlock()
+	assert.True(t, succ)
+
+	// 并发写
+	var n, running, conflicts int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			succ, executed, err := rw.Locker(func() {
+				if atomic.AddInt32(&running, 1) > 1 {
+					atomic.AddInt32(&conflicts, 1)
+				}
+				atomic.AddInt32(&n, 1)
+				atomic.AddInt32(&running, -1)
+			}).WithTries(100).WithRetryDelay(time.Millisecond * 10).Do()
+			assert.True(t, succ)
+			assert.True(t, executed)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(20), n)
+	assert.Equal(t, int32(0), conflicts)
+}
+
+func TestRWMutex_ReaderExpiry(t *testing.T) {
+	dlock, _ := newTestDlock(t, 3)
+	rw := dlock.NewRWMutex("rw-expiry")
+
+	long := rw.RLocker(nil).WithTries(1).WithExpiry(time.Second * 10)
+	short := rw.RLocker(nil).WithTries(1).WithExpiry(time.Millisecond * 100)
+	w := rw.Locker(nil).WithTries(1)
+
+	succ, _ := short.Lock()
+	assert.True(t, succ)
+	succ, _ = long.Lock()
+	assert.True(t, succ)
+
+	// 其他读者的获取和续租不会延长已过期读者的持有
+	time.Sleep(time.Millisecond * 150)
+	succ, _ = long.Extend()
+	assert.True(t, succ)
+	valid, _ := short.Valid()
+	assert.False(t, valid)
+	succ, _ = short.Extend()
+	assert.False(t, succ)
+	valid, _ = long.Valid()
+	assert.True(t, valid)
+	succ, _ = w.Lock()
+	assert.False(t, succ)
+
+	// 最后一个未过期的读者释放后，写者可以获取
+	succ, _ = long.Unlock()
+	assert.True(t, succ)
+	succ, _ = w.Lock()
+	assert.True(t, succ)
+	succ, _ = w.Unlock()
+	assert.True(t, succ)
+
+	// 读者均已过期时写者可以获取
+	succ, _ = short.Lock()
+	assert.True(t, succ)
+	time.Sleep(time.Millisecond * 150)
+	succ, _ = w.Lock()
+	assert.True(t, succ)
+}
+
+func TestFencing(t *testing.T) {
+	dlock, servers := newTestDlock(t, 3)
+	// 各pool的计数器不同
+	servers[0].Set("fencing:fencing", "10")
+
+	var last int64
+	for i := 0; i < 5; i++ {
+		m := dlock.NewMutex("fencing", nil).WithFencing().WithTries(1)
+		succ, err := m.Lock()
+		assert.True(t, succ)
+		assert.NoError(t, err)
+		assert.Greater(t, m.Token(), last)
+		last = m.Token()
+		succ, _ = m.Unlock()
+		assert.True(t, succ)
+	}
+	assert.Equal(t, int64(15), last)
+
+	// 不开启时没有token
+	m := dlock.NewMutex("no-fencing", nil).WithTries(1)
+	succ, _ := m.Lock()
+	assert.True(t, succ)
+	assert.Equal(t, int64(0), m.Token())
+}
+
+func TestLostNotify(t *testing.T) {
+	dlock, servers := newTestDlock(t, 3)
+
+	// 到期未续租
+	m := dlock.NewMutex("lost", nil).WithExpiry(time.Millisecond * 100).WithTries(1)
+	assert.Nil(t, m.LostNotify())
+	succ, _ := m.Lock()
+	assert.True(t, succ)
+	select {
+	case <-m.LostNotify():
+	case <-time.After(time.Second):
+		t.Fatal("lock not lost")
+	}
+
+	// 续租时发现锁被删除，任务的context被取消
+	var cancelled bool
+	succ, executed, err := dlock.NewMutex("deleted", nil).WithExpiry(time.Millisecond * 300).WithContextAction(func(ctx context.Context) {
+		for _, s := range servers {
+			s.Del("deleted")
+		}
+		select {
+		case <-ctx.Done():
+			cancelled = true
+		case <-time.After(time.Second):
+		}
+	}).Do()
+	assert.True(t, succ)
+	assert.True(t, executed)
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+
+	// 正常续租时不会丢失
+	m = dlock.NewMutex("renewed", nil).WithExpiry(time.Millisecond * 300)
+	succ, executed, err = m.WithContextAction(func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			t.Error("lock lost")
+		case <-time.After(time.Millisecond * 700):
+		}
+	}).Do()
+	assert.True(t, succ)
+	assert.True(t, executed)
+	assert.NoError(t, err)
+}
+
+func TestWait(t *testing.T) {
+	dlock, _ := newTestDlock(t, 3)
+
+	holder := dlock.NewMutex("wait", nil).WithTries(1)
+	succ, _ := holder.Lock()
+	assert.True(t, succ)
+
+	// 释放后立即唤醒，不需要等待一个expiry
+	done := make(chan time.Time)
+	go func() {
+		m := dlock.NewMutex("wait", nil).WithExpiry(time.Minute).WithWait(time.Minute)
+		succ, err := m.Lock()
+		assert.True(t, succ)
+		assert.NoError(t, err)
+		done <- time.Now()
+	}()
+	time.Sleep(time.Millisecond * 200)
+	released := time.Now()
+	succ, _ = holder.Unlock()
+	assert.True(t, succ)
+	select {
+	case acquired := <-done:
+		assert.Less(t, int64(acquired.Sub(released)), int64(time.Second))
+	case <-time.After(time.Second * 5):
+		t.Fatal("waiter not woken")
+	}
+
+	// 等待超时
+	start := time.Now()
+	succ, err := dlock.NewMutex("wait", nil).WithWait(time.Millisecond * 300).Lock()
+	assert.False(t, succ)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Millisecond*300))
+
+	// ctx结束时立即返回
+	for _, m := range []*Mutex{
+		dlock.NewMutex("wait", nil).WithWait(time.Minute),
+		dlock.NewMutex("wait", nil).WithRetryDelay(time.Minute),
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+		start := time.Now()
+		succ, err := m.LockContext(ctx)
+		cancel()
+		assert.False(t, succ)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	}
+}
+
+func TestFair(t *testing.T) {
+	dlock, servers := newTestDlock(t, 3)
+
+	holder := dlock.NewMutex("fair", nil).WithTries(1)
+	succ, _ := holder.Lock()
+	assert.True(t, succ)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			succ, executed, err := dlock.NewMutex("fair", func() {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+			}).WithWait(time.Second * 10).WithFair().Do()
+			assert.True(t, succ)
+			assert.True(t, executed)
+			assert.NoError(t, err)
+		}(i)
+		// 保证按顺序排队
+		time.Sleep(time.Millisecond * 100)
+	}
+	succ, _ = holder.Unlock()
+	assert.True(t, succ)
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+	for _, s := range servers {
+		assert.False(t, s.Exists("fair:queue"))
+	}
+
+	// 放弃等待时移出队列，不会阻塞后面的等待者
+	succ, _ = holder.Lock()
+	assert.True(t, succ)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	succ, err := dlock.NewMutex("fair", nil).WithWait(time.Minute).WithFair().LockContext(ctx)
+	assert.False(t, succ)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	succ, _ = holder.Unlock()
+	assert.True(t, succ)
+	succ, err = dlock.NewMutex("fair", nil).WithWait(time.Second).WithFair().Lock()
+	assert.True(t, succ)
+	assert.NoError(t, err)
+}
+
+func TestZookeeperOnly(t *testing.T) {
+	// 只配置zookeeper时没有redis pool，不能创建信号量和限流器
+	d := New().WithZookeeper(&zookeeper.ZookeeperProxy{}, "")
+	assert.PanicsWithValue(t, "redis of dlock is not configured", func() { d.NewSemaphore("sem", 1) })
+	assert.PanicsWithValue(t, "redis of dlock is not configured", func() {
+		d.NewLimiter("limiter", Limit{Rate: 1, Period: time.Second})
+	})
+}
+
+func TestSemaphore(t *testing.T) {
+	dlock, _ := newTestDlock(t, 3)
+	ctx := context.Background()
+
+	sem := dlock.NewSemaphore("sem", 2)
+	p1, err := sem.Acquire(ctx)
+	assert.NoError(t, err)
+	p2, err := sem.Acquire(ctx)
+	assert.NoError(t, err)
+	_, err = sem.Acquire(ctx)
+	assert.Equal(t, ErrNoPermit, err)
+	held, _ := sem.Held(ctx)
+	assert.Equal(t, 2, held)
+	ok, err := p1.Extend(ctx)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	// 释放后唤醒等待者
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		assert.NoError(t, p2.Release(ctx))
+	}()
+	start := time.Now()
+	p3, err := dlock.NewSemaphore("sem", 2).WithWait(time.Minute).WithExpiry(time.Minute).Acquire(ctx)
+	assert.NoError(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.NoError(t, p1.Release(ctx))
+	assert.NoError(t, p3.Release(ctx))
+	assert.Error(t, p3.Release(ctx))
+
+	// 过期的租约被回收
+	_, err = dlock.NewSemaphore("expired", 1).WithExpiry(time.Millisecond * 100).Acquire(ctx)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 150)
+	_, err = dlock.NewSemaphore("expired", 1).Acquire(ctx)
+	assert.NoError(t, err)
+
+	// 并发数不超过许可数
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			executed, err := dlock.NewSemaphore("concurrent", 3).WithWait(time.Second*10).Do(ctx, func(ctx context.Context) {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond * 50)
+				atomic.AddInt32(&running, -1)
+			})
+			assert.True(t, executed)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), max)
+}
+
+func TestLimiter(t *testing.T) {
+	dlock, _ := newTestDlock(t, 3)
+	ctx := context.Background()
+
+	for _, algorithm := range []string{GCRA, SlidingWindow} {
+		l := dlock.NewLimiter("limiter-"+algorithm, Limit{Rate: 5, Period: time.Second}).WithAlgorithm(algorithm)
+		for i := 0; i < 5; i++ {
+			res, err := l.Allow(ctx, "user1")
+			assert.NoError(t, err)
+			assert.True(t, res.Allowed, algorithm)
+			assert.Equal(t, 4-i, res.Remaining, algorithm)
+		}
+		res, err := l.Allow(ctx, "user1")
+		assert.NoError(t, err)
+		assert.False(t, res.Allowed, algorithm)
+		assert.Greater(t, int64(res.RetryAfter), int64(0), algorithm)
+		assert.LessOrEqual(t, int64(res.RetryAfter), int64(time.Second), algorithm)
+
+		// 不同key互不影响
+		res, err = l.Allow(ctx, "user2")
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed, algorithm)
+
+		start := time.Now()
+		assert.NoError(t, l.Wait(ctx, "user1"))
+		assert.Greater(t, int64(time.Since(start)), int64(time.Millisecond*100), algorithm)
+
+		assert.NoError(t, l.Reset(ctx, "user1"))
+		res, _ = l.AllowN(ctx, "user1", 5)
+		assert.True(t, res.Allowed, algorithm)
+	}
+
+	_, err := dlock.NewLimiter("unknown", PerSecond(1)).WithAlgorithm("unknown").Allow(ctx, "")
+	assert.Error(t, err)
+	_, err = dlock.NewLimiter("invalid", PerSecond(1)).AllowN(ctx, "", 0)
+	assert.Error(t, err)
+}
+
+func TestLimiter_Refund(t *testing.T) {
+	dlock, servers := newTestDlock(t, 3)
+	ctx := context.Background()
+	partial := &Dlock{pools: dlock.pools[1:]}
+
+	for _, algorithm := range []string{GCRA, SlidingWindow} {
+		name := "refund-" + algorithm
+		limit := Limit{Rate: 2, Period: time.Minute}
+		res, err := partial.NewLimiter(name, limit).WithAlgorithm(algorithm).AllowN(ctx, "", 2)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed, algorithm)
+
+		// 只有第一个pool放行，未达到quorum时归还其配额
+		l := dlock.NewLimiter(name, limit).WithAlgorithm(algorithm)
+		res, err = l.Allow(ctx, "")
+		assert.NoError(t, err)
+		assert.False(t, res.Allowed, algorithm)
+		assert.False(t, servers[0].Exists(name), algorithm)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/NetEase-Media/ngo/pkg/dlock/redis"
+)
+
+const (
+	// GCRA 是通用信元速率算法，请求按固定间隔平滑放行，允许Burst个请求的突发
+	GCRA = "gcra"
+	// SlidingWindow 是滑动窗口日志算法，任意Period内最多放行Rate个请求
+	SlidingWindow = "sliding_window"
+)
+
+// Limit 是限流的速率，每Period最多Rate个请求
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	// Burst 只对GCRA生效，为0时与Rate相同
+	Burst int
+}
+
+// PerSecond 返回每秒rate个请求的速率
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+// PerMinute 返回每分钟rate个请求的速率
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+// LimitResult 是一次限流判断的结果
+type LimitResult struct {
+	Allowed bool
+	// Remaining 是当前还可以放行的请求数
+	Remaining int
+	// RetryAfter 是未放行时到下次可能放行的时间
+	RetryAfter time.Duration
+}
+
+// A Limiter is a distributed rate limiter. Requests of the same key share the limit across processes.
+// With multiple pools a request is allowed when the quorum of pools allow it.
+type Limiter struct {
+	name      string
+	limit     Limit
+	algorithm string
+	quorum    int
+	pools     []redis.Pool
+}
+
+// NewLimiter 使用默认的Dlock创建限流器
+func NewLimiter(name string, limit Limit) *Limiter {
+	return defaultDlock.NewLimiter(name, limit)
+}
+
+// NewLimiter 创建限流器，默认使用GCRA算法。没有配置redis时panic
+func (d *Dlock) NewLimiter(name string, limit Limit) *Limiter {
+	d.mustHavePools()
+	return &Limiter{
+		name:      name,
+		limit:     limit,
+		algorithm: GCRA,
+		quorum:    len(d.pools)/2 + 1,
+		pools:     d.pools,
+	}
+}
+
+// Name returns limiter name.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// WithAlgorithm can be used to set the algorithm, GCRA or SlidingWindow.
+func (l *Limiter) WithAlgorithm(algorithm string) *Limiter {
+	l.algorithm = algorithm
+	return l
+}
+
+// Allow reports whether a request of key is allowed.
+func (l *Limiter) Allow(ctx context.Context, key string) (*LimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n requests of key are allowed at once.
+func (l *Limiter) AllowN(ctx context.Context, key string, n int) (*LimitResult, error) {
+	if l.limit.Rate <= 0 || l.limit.Period <= 0 {
+		return nil, fmt.Errorf("dlock: invalid limit %+v", l.limit)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("dlock: invalid request count %d", n)
+	}
+	script, args, err := l.script(n)
+	if err != nil {
+		return nil, err
+	}
+	name := l.key(key)
+	keysAndArgs := append([]interface{}{name}, args...)
+
+	var mu sync.Mutex
+	var res *LimitResult
+	allowed := make(map[redis.Pool]bool, len(l.pools))
+	succ, err := actOnPoolsAsync(l.pools, func(pool redis.Pool) (bool, error) {
+		conn, err := pool.Get(ctx)
+		if err != nil {
+			return false, err
+		}
+		defer conn.Close()
+		reply, err := conn.Eval(script, keysAndArgs...)
+		if err != nil {
+			return false, err
+		}
+		r := parseLimitResult(reply)
+		// 放行时取剩余最少的结果，拒绝时取等待最久的结果
+		mu.Lock()
+		if res == nil || r.Remaining < res.Remaining || r.RetryAfter > res.RetryAfter {
+			res = r
+		}
+		if r.Allowed {
+			allowed[pool] = true
+		}
+		mu.Unlock()
+		return r.Allowed, nil
+	})
+	if succ > 0 && succ < l.quorum {
+		// 未达到quorum时归还已放行的pool上消耗的配额
+		_, _ = actOnPoolsAsync(l.pools, func(pool redis.Pool) (bool, error) {
+			if !allowed[pool] {
+				return false, nil
+			}
+			return evalStatus(ctx, pool, l.refundScript(), keysAndArgs...)
+		})
+	}
+	if res == nil {
+		if err == nil {
+			err = errors.New("dlock: no limiter result")
+		}
+		return nil, err
+	}
+	res.Allowed = succ >= l.quorum
+	if res.Allowed {
+		res.RetryAfter = 0
+	} else if res.RetryAfter <= 0 {
+		res.RetryAfter = l.limit.Period / time.Duration(l.limit.Rate)
+	}
+	return res, nil
+}
+
+// Wait blocks until a request of key is allowed or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	for {
+		res, err := l.Allow(ctx, key)
+		if err != nil {
+			return err
+		}
+		if res.Allowed {
+			return nil
+		}
+		if err := sleep(ctx, res.RetryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+// Reset clears the state of key.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	name := l.key(key)
+	n, err := actOnPoolsAsync(l.pools, func(pool redis.Pool) (bool, error) {
+		return evalStatus(ctx, pool, limiterResetScript, name)
+	})
+	if n < len(l.pools) {
+		return err
+	}
+	return nil
+}
+
+func (l *Limiter) key(key string) string {
+	if key == "" {
+		return l.name
+	}
+	return l.name + ":" + key
+}
+
+func (l *Limiter) script(n int) (*redis.Script, []interface{}, error) {
+	period := int64(l.limit.Period / time.Millisecond)
+	switch l.algorithm {
+	case GCRA:
+		burst := l.limit.Burst
+		if burst <= 0 {
+			burst = l.limit.Rate
+		}
+		// 以微秒计算间隔，避免速率较高时间隔为0
+		emission := int64(l.limit.Period/time.Microsecond) / int64(l.limit.Rate)
+		now := time.Now().UnixNano() / int64(time.Microsecond)
+		return gcraScript, []interface{}{now, emission, burst, n}, nil
+	case SlidingWindow:
+		id, err := genValue()
+		if err != nil {
+			return nil, nil, err
+		}
+		return slidingWindowScript, []interface{}{nowMillis(), period, l.limit.Rate, n, id}, nil
+	default:
+		return nil, nil, fmt.Errorf("dlock: unknown limiter algorithm %q", l.algorithm)
+	}
+}
+
+// refundScript 返回归还配额的脚本，参数与script返回的相同
+func (l *Limiter) refundScript() *redis.Script {
+	if l.algorithm == SlidingWindow {
+		return slidingWindowRefundScript
+	}
+	return gcraRefundScript
+}
+
+// parseLimitResult 解析脚本返回的 {是否放行, 剩余数, 重试等待毫秒}
+func parseLimitResult(reply interface{}) *LimitResult {
+	values, _ := reply.([]interface{})
+	ints := make([]int64, 3)
+	for i := 0; i < len(values) && i < len(ints); i++ {
+		ints[i], _ = values[i].(int64)
+	}
+	return &LimitResult{
+		Allowed:    ints[0] == 1,
+		Remaining:  int(ints[1]),
+		RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+	}
+}
+
+// gcraScript KEYS[1]保存理论到达时间（微秒），ARGV为当前时间、放行间隔（微秒）、突发数和请求数
+var gcraScript = redis.NewScript(1, `
+	local now = tonumber(ARGV[1])
+	local emission = tonumber(ARGV[2])
+	local burst = tonumber(ARGV[3])
+	local cost = tonumber(ARGV[4])
+	local tat = tonumber(redis.call("GET", KEYS[1]) or ARGV[1])
+	if tat < now then
+		tat = now
+	end
+	local newTat = tat + emission * cost
+	local allowAt = newTat - emission * burst
+	if allowAt > now then
+		local remaining = math.floor((now - (tat - emission * burst)) / emission)
+		if remaining < 0 then
+			remaining = 0
+		end
+		return {0, remaining, math.ceil((allowAt - now) / 1000)}
+	end
+	redis.call("SET", KEYS[1], string.format("%d", newTat), "PX", math.ceil((newTat - now) / 1000))
+	return {1, math.floor((now - allowAt) / emission), 0}
+`)
+
+// gcraRefundScript 将理论到达时间回退请求数个间隔，参数同gcraScript
+var gcraRefundScript = redis.NewScript(1, `
+	local now = tonumber(ARGV[1])
+	local tat = tonumber(redis.call("GET", KEYS[1]) or ARGV[1]) - tonumber(ARGV[2]) * tonumber(ARGV[4])
+	if tat <= now then
+		redis.call("DEL", KEYS[1])
+		return 1
+	end
+	redis.call("SET", KEYS[1], string.format("%d", tat), "PX", math.ceil((tat - now) / 1000))
+	return 1
+`)
+
+// slidingWindowScript KEYS[1]为请求时间的有序集合，ARGV为当前时间、窗口（毫秒）、速率、请求数和请求id
+var slidingWindowScript = redis.NewScript(1, `
+	local now = tonumber(ARGV[1])
+	local period = tonumber(ARGV[2])
+	local rate = tonumber(ARGV[3])
+	local cost = tonumber(ARGV[4])
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - period)
+	local count = redis.call("ZCARD", KEYS[1])
+	if count + cost > rate then
+		local retry = period
+		local oldest = redis.call("ZRANGE", KEYS[1], count + cost - rate - 1, count + cost - rate - 1, "WITHSCORES")
+		if oldest[2] then
+			retry = tonumber(oldest[2]) + period - now
+		end
+		return {0, rate - count, retry}
+	end
+	for i = 1, cost do
+		redis.call("ZADD", KEYS[1], now, ARGV[5] .. ":" .. i)
+	end
+	redis.call("PEXPIRE", KEYS[1], period)
+	return {1, rate - count - cost, 0}
+`)
+
+// slidingWindowRefundScript 删除本次请求加入的记录，参数同slidingWindowScript
+var slidingWindowRefundScript = redis.NewScript(1, `
+	for i = 1, tonumber(ARGV[4]) do
+		redis.call("ZREM", KEYS[1], ARGV[5] .. ":" .. i)
+	end
+	return 1
+`)
+
+var limiterResetScript = redis.NewScript(1, `
+	redis.call("DEL", KEYS[1])
+	return 1
+`)
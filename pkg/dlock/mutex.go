@@ -18,6 +18,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"sync"
 	"time"
 
 	"github.com/NetEase-Media/ngo/pkg/adapter/log"
@@ -30,10 +31,24 @@ type DelayFunc func(tries int) time.Duration
 
 type Action func()
 
+// ContextAction 是接收context的任务，context在锁丢失时被取消
+type ContextAction func(ctx context.Context)
+
+type lockMode int
+
+const (
+	modeExclusive lockMode = iota // 互斥，key为string
+	modeReentrant                 // 可重入互斥，key为hash，field为owner，值为持有次数
+	modeRead                      // 读锁，与写锁共用hash，:mode字段为read
+	modeWrite                     // 写锁，:mode字段为write，同一owner可重入
+)
+
 // A Mutex is a distributed mutual exclusion lock.
 type Mutex struct {
 	name   string
 	expiry time.Duration
+	mode   lockMode
+	owner  string
 
 	tries     int
 	delayFunc DelayFunc
@@ -46,9 +61,21 @@ type Mutex struct {
 	value        string
 	until        time.Time
 
+	fencing bool
+	token   int64
+
+	wait time.Duration
+	fair bool
+
+	mu        sync.Mutex
+	lost      chan struct{}
+	lostTimer *time.Timer
+	closeLost func()
+
 	pools []redis.Pool
 
-	action Action
+	action        Action
+	contextAction ContextAction
 }
 
 // Name returns mutex name (i.e. the Redis key).
@@ -61,6 +88,20 @@ func (m *Mutex) Value() string {
 	return m.value
 }
 
+// Token returns the fencing token of the current lock, it is 0 unless WithFencing is used.
+// Tokens of the same name increase monotonically, storage can reject writes with a token less than the latest one.
+func (m *Mutex) Token() int64 {
+	return m.token
+}
+
+// LostNotify returns a channel which is closed when the lock is lost, i.e. it expires without extension
+// or an extension fails to reach the quorum. It is nil until a lock is acquired.
+func (m *Mutex) LostNotify() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
 // Lock locks m. In case it returns an error on failure, you may retry to acquire the lock by calling this method again.
 func (m *Mutex) Lock() (bool, error) {
 	return m.LockContext(context.TODO())
@@ -68,41 +109,195 @@ func (m *Mutex) Lock() (bool, error) {
 
 // Lock locks m. In case it returns an error on failure, you may retry to acquire the lock by calling this method again.
 func (m *Mutex) LockContext(ctx context.Context) (bool, error) {
-	value, err := m.genValueFunc()
-	if err != nil {
-		return false, err
+	value := m.owner
+	if value == "" {
+		var err error
+		if value, err = m.genValueFunc(); err != nil {
+			return false, err
+		}
+	}
+
+	if m.wait > 0 {
+		return m.lockWait(ctx, value)
 	}
 
 	for i := 0; i < m.tries; i++ {
 		if i != 0 {
-			time.Sleep(m.delayFunc(i))
+			if err := sleep(ctx, m.delayFunc(i)); err != nil {
+				return false, err
+			}
 		}
 
-		start := time.Now()
-
-		n, err := m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
-			return m.acquire(ctx, pool, value)
-		})
+		ok, n, err := m.tryAcquire(ctx, value)
+		if ok {
+			return true, nil
+		}
 		if n == 0 && err != nil {
 			return false, err
 		}
+		if i == m.tries-1 && err != nil {
+			return false, err
+		}
+	}
 
-		now := time.Now()
-		until := now.Add(m.expiry - now.Sub(start) - time.Duration(int64(float64(m.expiry)*m.factor)))
-		if n >= m.quorum && now.Before(until) {
-			m.value = value
-			m.until = until
-			return true, nil
+	return false, nil
+}
+
+// lockWait 订阅释放频道后尝试获取锁，失败时等待释放消息、重试间隔或ctx结束。
+// 锁过期而没有释放时不会收到消息，因此最多等待一个expiry后重试
+func (m *Mutex) lockWait(ctx context.Context, value string) (bool, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, m.wait)
+	defer cancel()
+	released, unsubscribe := subscribe(waitCtx, m.pools, m.releaseChannel())
+	defer unsubscribe()
+
+	var lastErr error
+	for i := 1; ; i++ {
+		head := true
+		if m.fair {
+			var err error
+			if head, err = m.enqueue(waitCtx, value); err != nil {
+				lastErr = err
+			}
+		}
+		if head {
+			ok, _, err := m.tryAcquire(waitCtx, value)
+			if ok {
+				if m.fair {
+					m.dequeue(value)
+				}
+				return true, nil
+			}
+			if err != nil {
+				lastErr = err
+			}
+		}
+
+		interval := m.expiry
+		if released == nil || lastErr != nil {
+			interval = m.delayFunc(i)
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-waitCtx.Done():
+			timer.Stop()
+			if m.fair {
+				m.dequeue(value)
+			}
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			return false, lastErr
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+		}
+		lastErr = nil
+	}
+}
+
+// tryAcquire 在所有pool上获取一次锁，未达到quorum时回滚，返回获取成功的pool数
+func (m *Mutex) tryAcquire(ctx context.Context, value string) (bool, int, error) {
+	start := time.Now()
+
+	// 只在获取成功的pool上回滚，避免可重入时减少之前的持有次数
+	var mu sync.Mutex
+	acquired := make(map[redis.Pool]bool, len(m.pools))
+	var token int64
+	n, err := m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		ok, t, err := m.acquire(ctx, pool, value)
+		if ok {
+			mu.Lock()
+			acquired[pool] = true
+			if t > token {
+				token = t
+			}
+			mu.Unlock()
 		}
+		return ok, err
+	})
+	if n == 0 {
+		return false, n, err
+	}
+
+	if n >= m.quorum && m.fencing {
+		// 各pool的计数器可能不同，取最大值并同步回去，保证任意两个quorum得到的token递增
 		_, _ = m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
-			return m.release(ctx, pool, value)
+			if !acquired[pool] {
+				return false, nil
+			}
+			return m.syncToken(ctx, pool, token)
 		})
-		if i == m.tries-1 && err != nil {
-			return false, err
+	}
+
+	now := time.Now()
+	until := now.Add(m.expiry - now.Sub(start) - time.Duration(int64(float64(m.expiry)*m.factor)))
+	if n >= m.quorum && now.Before(until) {
+		m.value = value
+		m.token = token
+		m.hold(until, false)
+		return true, n, nil
+	}
+	_, _ = m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		if !acquired[pool] {
+			return false, nil
+		}
+		return m.release(ctx, pool, value)
+	})
+	return false, n, err
+}
+
+// subscribe 在支持订阅的pool上订阅频道，任意pool上有消息时返回的channel可读。
+// 没有pool支持订阅时返回nil
+func subscribe(ctx context.Context, pools []redis.Pool, channel string) (<-chan struct{}, func()) {
+	var subs []redis.Subscription
+	for _, pool := range pools {
+		s, ok := pool.(redis.Subscriber)
+		if !ok {
+			continue
+		}
+		sub, err := s.Subscribe(ctx, channel)
+		if err != nil {
+			log.Warnf("failed to subscribe channel %s, err: %+v", channel, err)
+			continue
 		}
+		subs = append(subs, sub)
+	}
+	if len(subs) == 0 {
+		return nil, func() {}
 	}
 
-	return false, nil
+	notify := make(chan struct{}, 1)
+	for _, sub := range subs {
+		go func(sub redis.Subscription) {
+			for range sub.Channel() {
+				select {
+				case notify <- struct{}{}:
+				default:
+				}
+			}
+		}(sub)
+	}
+	return notify, func() {
+		for _, sub := range subs {
+			_ = sub.Close()
+		}
+	}
+}
+
+func (m *Mutex) releaseChannel() string {
+	return m.name + releaseSuffix
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 // Unlock unlocks m and returns the status of unlock.
@@ -112,6 +307,11 @@ func (m *Mutex) Unlock() (bool, error) {
 
 // Unlock unlocks m and returns the status of unlock.
 func (m *Mutex) UnlockContext(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	if m.lostTimer != nil {
+		m.lostTimer.Stop()
+	}
+	m.mu.Unlock()
 	n, err := m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
 		return m.release(ctx, pool, m.value)
 	})
@@ -128,12 +328,19 @@ func (m *Mutex) Extend() (bool, error) {
 
 // Extend resets the mutex's expiry and returns the status of expiry extension.
 func (m *Mutex) ExtendContext(ctx context.Context) (bool, error) {
+	start := time.Now()
 	n, err := m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
 		return m.touch(ctx, pool, m.value, int(m.expiry/time.Millisecond))
 	})
 	if n < m.quorum {
+		if err == nil {
+			// 没有出错但未达到quorum，说明锁已过期或被其他人持有
+			m.markLost()
+		}
 		return false, err
 	}
+	now := time.Now()
+	m.hold(now.Add(m.expiry-now.Sub(start)-time.Duration(int64(float64(m.expiry)*m.factor))), true)
 	return true, nil
 }
 
@@ -148,6 +355,8 @@ func (m *Mutex) ValidContext(ctx context.Context) (bool, error) {
 	return n >= m.quorum, err
 }
 
+// DoContext locks m, runs the action and unlocks m. The lock is extended in background while the action is running,
+// and the context passed to the ContextAction is cancelled once the lock is lost.
 func (m *Mutex) DoContext(ctx context.Context) (bool, bool, error) {
 	var executed bool
 	succ, err := m.LockContext(ctx)
@@ -155,19 +364,20 @@ func (m *Mutex) DoContext(ctx context.Context) (bool, bool, error) {
 		return succ, executed, err
 	}
 
-	var cancel context.CancelFunc
+	childCtx, cancel := context.WithCancel(ctx)
 	defer func() {
-		if cancel != nil {
-			cancel()
-		}
+		cancel()
 		succ, err := m.UnlockContext(ctx)
 		if !succ {
 			log.Errorf("failed to unlock. name: %s, err: %+v", m.name, err)
 		}
 	}()
-	childCtx, cancel := context.WithCancel(ctx)
-	m.renew(childCtx)
-	m.action()
+	m.renew(childCtx, cancel)
+	if m.contextAction != nil {
+		m.contextAction(childCtx)
+	} else {
+		m.action()
+	}
 	executed = true
 
 	return succ, executed, err
@@ -215,18 +425,66 @@ func (m *Mutex) WithGenValueFunc(genValueFunc func() (string, error)) *Mutex {
 	return m
 }
 
+// WithWait makes Lock block for at most wait instead of retrying for the configured tries.
+// Waiters subscribe to the release channel of the lock and retry as soon as it is released,
+// the lock is also retried every expiry in case it expires without being released.
+// Lock returns false without error if the lock is still held by others after waiting.
+func (m *Mutex) WithWait(wait time.Duration) *Mutex {
+	m.wait = wait
+	return m
+}
+
+// WithFair makes waiters acquire the lock in FIFO order, it only takes effect with WithWait.
+// Waiters queue in the hash "name:queue", a waiter which stops refreshing its entry
+// for 2*expiry is removed from the queue.
+func (m *Mutex) WithFair() *Mutex {
+	m.fair = true
+	return m
+}
+
+// WithFencing makes m generate a fencing token by INCR on acquisition, see Token.
+// The counter key is the mutex name with suffix ":fencing" and never expires.
+func (m *Mutex) WithFencing() *Mutex {
+	m.fencing = true
+	return m
+}
+
+// WithContextAction sets the action which receives a context cancelled when the lock is lost.
+// It takes the place of the action passed to NewMutex.
+func (m *Mutex) WithContextAction(action ContextAction) *Mutex {
+	m.contextAction = action
+	return m
+}
+
+// WithReentrant makes m reentrant for the given owner token: mutexes with the same name and owner can
+// acquire the lock again while it is held, and every Lock must be paired with an Unlock.
+// For read and write locks of RWMutex, the owner token identifies the reader or writer.
+func (m *Mutex) WithReentrant(owner string) *Mutex {
+	if m.mode == modeExclusive {
+		m.mode = modeReentrant
+	}
+	m.owner = owner
+	return m
+}
+
 // WithValue can be used to assign the random value without having to call lock. This allows the ownership of a lock to be "transfered" and allows the lock to be unlocked from elsewhere.
 func (m *Mutex) WithValue(v string) *Mutex {
 	m.value = v
 	return m
 }
 
-func (m *Mutex) renew(ctx context.Context) {
+// renew 定期续租，锁丢失时调用cancel
+func (m *Mutex) renew(ctx context.Context, cancel context.CancelFunc) {
+	lost := m.LostNotify()
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-lost:
+				log.Errorf("lock lost. name: %s", m.name)
+				cancel()
+				return
 			case <-time.After(m.expiry / 3):
 				succ, err := m.ExtendContext(ctx)
 				if !succ {
@@ -237,7 +495,42 @@ func (m *Mutex) renew(ctx context.Context) {
 			}
 		}
 	}()
+}
+
+// hold 记录锁的有效期，到期未续租时锁丢失，renewed为false时是新获取的锁
+func (m *Mutex) hold(until time.Time, renewed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.until = until
+	if renewed && m.lost != nil {
+		select {
+		case <-m.lost:
+			// 已经丢失的锁不会恢复
+		default:
+			m.lostTimer.Reset(time.Until(until))
+		}
+		return
+	}
+	if m.lostTimer != nil {
+		m.lostTimer.Stop()
+	}
+	lost := make(chan struct{})
+	var once sync.Once
+	m.lost = lost
+	m.closeLost = func() { once.Do(func() { close(lost) }) }
+	m.lostTimer = time.AfterFunc(time.Until(until), m.closeLost)
+}
 
+// markLost 立即标记锁丢失
+func (m *Mutex) markLost() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lostTimer != nil {
+		m.lostTimer.Stop()
+	}
+	if m.closeLost != nil {
+		m.closeLost()
+	}
 }
 
 func (m *Mutex) valid(ctx context.Context, pool redis.Pool) (bool, error) {
@@ -249,6 +542,18 @@ func (m *Mutex) valid(ctx context.Context, pool redis.Pool) (bool, error) {
 		return false, err
 	}
 	defer conn.Close()
+	if m.mode != modeExclusive {
+		var status interface{}
+		if m.mode == modeRead {
+			status, err = conn.Eval(readHoldScript, m.name, m.value, nowMillis())
+		} else {
+			status, err = conn.Eval(holdScript, m.name, m.value)
+		}
+		if err != nil {
+			return false, err
+		}
+		return status != int64(0), nil
+	}
 	reply, err := conn.Get(m.name)
 	if err != nil {
 		return false, err
@@ -265,22 +570,121 @@ func genValue() (string, error) {
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
-func (m *Mutex) acquire(ctx context.Context, pool redis.Pool, value string) (bool, error) {
+func (m *Mutex) acquire(ctx context.Context, pool redis.Pool, value string) (bool, int64, error) {
 	conn, err := pool.Get(ctx)
 	if err != nil {
-		return false, err
+		return false, 0, err
 	}
 	defer conn.Close()
-	reply, err := conn.SetNX(m.name, value, m.expiry)
+	var ok bool
+	if m.mode != modeExclusive {
+		script := reentrantAcquireScript
+		switch m.mode {
+		case modeRead:
+			script = readAcquireScript
+		case modeWrite:
+			script = writeAcquireScript
+		}
+		expiry := int64(m.expiry / time.Millisecond)
+		now := nowMillis()
+		status, err := conn.Eval(script, m.name, value, expiry, now, now+expiry)
+		if err != nil {
+			return false, 0, err
+		}
+		ok = status != int64(0)
+	} else if ok, err = conn.SetNX(m.name, value, m.expiry); err != nil {
+		return false, 0, err
+	}
+	if !ok || !m.fencing {
+		return ok, 0, nil
+	}
+
+	reply, err := conn.Eval(incrScript, m.name+fencingSuffix)
+	if err != nil {
+		_, _ = m.release(ctx, pool, value)
+		return false, 0, err
+	}
+	token, _ := reply.(int64)
+	return true, token, nil
+}
+
+const fencingSuffix = ":fencing"
+
+var incrScript = redis.NewScript(1, `
+	return redis.call("INCR", KEYS[1])
+`)
+
+var syncTokenScript = redis.NewScript(1, `
+	if tonumber(redis.call("GET", KEYS[1]) or "0") < tonumber(ARGV[1]) then
+		redis.call("SET", KEYS[1], ARGV[1])
+	end
+	return 1
+`)
+
+func (m *Mutex) syncToken(ctx context.Context, pool redis.Pool, token int64) (bool, error) {
+	conn, err := pool.Get(ctx)
 	if err != nil {
 		return false, err
 	}
-	return reply, nil
+	defer conn.Close()
+	_, err = conn.Eval(syncTokenScript, m.name+fencingSuffix, token)
+	return err == nil, err
 }
 
+var reentrantAcquireScript = redis.NewScript(1, `
+	if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+		redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	else
+		return 0
+	end
+`)
+
+// hashReleaseScript 减少owner的持有次数，没有持有者时删除锁、发布释放消息并返回2，用于可重入锁和读写锁。
+// ARGV为owner、当前时间（毫秒）和释放频道，读锁会同时清理过期的读者
+var hashReleaseScript = redis.NewScript(1, readPurge+`
+	if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+		return 0
+	end
+	if redis.call("HINCRBY", KEYS[1], ARGV[1], -1) <= 0 then
+		redis.call("HDEL", KEYS[1], ARGV[1], ":until:" .. ARGV[1])
+	end
+	if redis.call("HGET", KEYS[1], ":mode") == "read" then
+		if purge(KEYS[1], tonumber(ARGV[2])) > 0 then
+			return 1
+		end
+		redis.call("DEL", KEYS[1])
+		redis.call("PUBLISH", ARGV[3], ARGV[1])
+		return 2
+	end
+	local n = redis.call("HLEN", KEYS[1])
+	if n == 0 or (n == 1 and redis.call("HEXISTS", KEYS[1], ":mode") == 1) then
+		redis.call("DEL", KEYS[1])
+		redis.call("PUBLISH", ARGV[3], ARGV[1])
+		return 2
+	end
+	return 1
+`)
+
+var hashTouchScript = redis.NewScript(1, `
+	if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	else
+		return 0
+	end
+`)
+
+var holdScript = redis.NewScript(1, `
+	return redis.call("HEXISTS", KEYS[1], ARGV[1])
+`)
+
+// deleteScript 删除持有的锁并发布释放消息，ARGV同hashReleaseScript。
+// 在脚本中发布，只访问一个key，分片客户端也可以使用
 var deleteScript = redis.NewScript(1, `
 	if redis.call("GET", KEYS[1]) == ARGV[1] then
-		return redis.call("DEL", KEYS[1])
+		redis.call("DEL", KEYS[1])
+		redis.call("PUBLISH", ARGV[3], ARGV[1])
+		return 1
 	else
 		return 0
 	end
@@ -292,13 +696,136 @@ func (m *Mutex) release(ctx context.Context, pool redis.Pool, value string) (boo
 		return false, err
 	}
 	defer conn.Close()
-	status, err := conn.Eval(deleteScript, m.name, value)
+	script := deleteScript
+	if m.mode != modeExclusive {
+		script = hashReleaseScript
+	}
+	status, err := conn.Eval(script, m.name, value, nowMillis(), m.releaseChannel())
 	if err != nil {
 		return false, err
 	}
 	return status != int64(0), nil
 }
 
+const (
+	releaseSuffix = ":release"
+	queueSuffix   = ":queue"
+)
+
+// queueLoad 读取公平锁队列，队列为一个hash，":seq"为排队计数器，
+// "s:{value}"和"d:{value}"分别为等待者的排队序号和超时时间（毫秒）
+const queueLoad = `
+	local function load(key)
+		local kv = redis.call("HGETALL", key)
+		local seqs, deadlines = {}, {}
+		for i = 1, #kv, 2 do
+			local kind, value = string.sub(kv[i], 1, 2), string.sub(kv[i], 3)
+			if kind == "s:" then
+				seqs[value] = tonumber(kv[i + 1])
+			elseif kind == "d:" then
+				deadlines[value] = tonumber(kv[i + 1])
+			end
+		end
+		return seqs, deadlines
+	end
+`
+
+// enqueueScript 清理超时的等待者，将value加入队尾或刷新它的超时时间，返回value是否在队首。
+// ARGV为value、当前时间、超时时长和超时时间（毫秒）
+var enqueueScript = redis.NewScript(1, queueLoad+`
+	local seqs, deadlines = load(KEYS[1])
+	if not seqs[ARGV[1]] then
+		seqs[ARGV[1]] = redis.call("HINCRBY", KEYS[1], ":seq", 1)
+		redis.call("HSET", KEYS[1], "s:" .. ARGV[1], seqs[ARGV[1]])
+	end
+	redis.call("HSET", KEYS[1], "d:" .. ARGV[1], ARGV[4])
+	local head, min
+	for value, seq in pairs(seqs) do
+		local deadline = deadlines[value]
+		if value ~= ARGV[1] and (not deadline or deadline < tonumber(ARGV[2])) then
+			redis.call("HDEL", KEYS[1], "s:" .. value, "d:" .. value)
+		elseif not min or seq < min then
+			head, min = value, seq
+		end
+	end
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	if head == ARGV[1] then
+		return 1
+	end
+	return 0
+`)
+
+// dequeueScript 将value移出队列，value原来在队首时发布释放消息唤醒下一个等待者。ARGV为value和释放频道
+var dequeueScript = redis.NewScript(1, queueLoad+`
+	local seqs = load(KEYS[1])
+	local seq = seqs[ARGV[1]]
+	if not seq then
+		return 0
+	end
+	redis.call("HDEL", KEYS[1], "s:" .. ARGV[1], "d:" .. ARGV[1])
+	local head = true
+	local rest = 0
+	for value, s in pairs(seqs) do
+		if value ~= ARGV[1] then
+			rest = rest + 1
+			if s < seq then
+				head = false
+			end
+		end
+	end
+	if rest == 0 then
+		redis.call("DEL", KEYS[1])
+	end
+	if head then
+		redis.call("PUBLISH", ARGV[2], ARGV[1])
+	end
+	return 1
+`)
+
+func (m *Mutex) queueKey() string {
+	return m.name + queueSuffix
+}
+
+// enqueue 排队并返回是否在quorum个pool上位于队首
+func (m *Mutex) enqueue(ctx context.Context, value string) (bool, error) {
+	now := nowMillis()
+	ttl := int64(2 * m.expiry / time.Millisecond)
+	n, err := m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		conn, err := pool.Get(ctx)
+		if err != nil {
+			return false, err
+		}
+		defer conn.Close()
+		status, err := conn.Eval(enqueueScript, m.queueKey(), value, now, ttl, now+ttl)
+		if err != nil {
+			return false, err
+		}
+		return status != int64(0), nil
+	})
+	return n >= m.quorum, err
+}
+
+// dequeue 获取成功或放弃等待时移出队列，原来在队首时唤醒下一个等待者。
+// ctx可能已经结束，因此使用新的context
+func (m *Mutex) dequeue(value string) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.expiry)
+	defer cancel()
+	_, err := m.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		conn, err := pool.Get(ctx)
+		if err != nil {
+			return false, err
+		}
+		defer conn.Close()
+		if _, err := conn.Eval(dequeueScript, m.queueKey(), value, m.releaseChannel()); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		log.Errorf("failed to dequeue. name: %s, err: %+v", m.name, err)
+	}
+}
+
 var touchScript = redis.NewScript(1, `
 	if redis.call("GET", KEYS[1]) == ARGV[1] then
 		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
@@ -313,21 +840,38 @@ func (m *Mutex) touch(ctx context.Context, pool redis.Pool, value string, expiry
 		return false, err
 	}
 	defer conn.Close()
-	status, err := conn.Eval(touchScript, m.name, value, expiry)
+	script := touchScript
+	switch m.mode {
+	case modeRead:
+		script = readTouchScript
+	case modeReentrant, modeWrite:
+		script = hashTouchScript
+	}
+	now := nowMillis()
+	status, err := conn.Eval(script, m.name, value, expiry, now, now+int64(expiry))
 	if err != nil {
 		return false, err
 	}
 	return status != int64(0), nil
 }
 
+// nowMillis 返回当前的毫秒时间戳
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
 func (m *Mutex) actOnPoolsAsync(actFn func(redis.Pool) (bool, error)) (int, error) {
+	return actOnPoolsAsync(m.pools, actFn)
+}
+
+func actOnPoolsAsync(pools []redis.Pool, actFn func(redis.Pool) (bool, error)) (int, error) {
 	type result struct {
 		Status bool
 		Err    error
 	}
 
 	ch := make(chan result)
-	for _, pool := range m.pools {
+	for _, pool := range pools {
 		go func(pool redis.Pool) {
 			r := result{}
 			r.Status, r.Err = actFn(pool)
@@ -336,7 +880,7 @@ func (m *Mutex) actOnPoolsAsync(actFn func(redis.Pool) (bool, error)) (int, erro
 	}
 	n := 0
 	var err error
-	for range m.pools {
+	for range pools {
 		r := <-ch
 		if r.Status {
 			n++
@@ -35,6 +35,45 @@ func NewPool(delegate redis.Redis) Pool {
 	return &pool{delegate}
 }
 
+// Subscribe 订阅频道，返回时订阅已经生效
+func (p *pool) Subscribe(ctx context.Context, channel string) (Subscription, error) {
+	pubsub, err := redis.Subscribe(ctx, p.delegate, channel)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	s := &subscription{pubsub: pubsub, ch: make(chan string, 1)}
+	go s.receive()
+	return s, nil
+}
+
+type subscription struct {
+	pubsub *redisv8.PubSub
+	ch     chan string
+}
+
+func (s *subscription) Channel() <-chan string {
+	return s.ch
+}
+
+func (s *subscription) Close() error {
+	return s.pubsub.Close()
+}
+
+// receive 转发消息，未及时接收的消息被丢弃
+func (s *subscription) receive() {
+	defer close(s.ch)
+	for msg := range s.pubsub.Channel() {
+		select {
+		case s.ch <- msg.Payload:
+		default:
+		}
+	}
+}
+
 type conn struct {
 	delegate redis.Redis
 	ctx      context.Context
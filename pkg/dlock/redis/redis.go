@@ -27,6 +27,18 @@ type Pool interface {
 	Get(ctx context.Context) (Conn, error)
 }
 
+// A Subscriber is a Pool which supports pub/sub, waiters of a lock subscribe to its release channel.
+type Subscriber interface {
+	Subscribe(ctx context.Context, channel string) (Subscription, error)
+}
+
+// A Subscription receives the payloads published to the channel.
+// Payloads may be dropped when they are not received in time, so they can only be used as notifications.
+type Subscription interface {
+	Channel() <-chan string
+	Close() error
+}
+
 type Conn interface {
 	Get(name string) (string, error)
 	Set(name string, value string) (bool, error)
@@ -0,0 +1,141 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dlock
+
+import (
+	"github.com/NetEase-Media/ngo/pkg/dlock/redis"
+)
+
+// A RWMutex is a distributed reader/writer mutual exclusion lock.
+// The lock can be held by an arbitrary number of readers or a single writer.
+// It is stored as a redis hash, so the name must not be shared with a Mutex.
+// Every reader has its own expiry, expired readers are removed before the lock is granted or released.
+type RWMutex struct {
+	d    *Dlock
+	name string
+}
+
+// NewRWMutex 使用默认的Dlock创建读写锁
+func NewRWMutex(name string) *RWMutex {
+	return defaultDlock.NewRWMutex(name)
+}
+
+func (d *Dlock) NewRWMutex(name string) *RWMutex {
+	return &RWMutex{d: d, name: name}
+}
+
+// Name returns mutex name (i.e. the Redis key).
+func (rw *RWMutex) Name() string {
+	return rw.name
+}
+
+// RLocker returns a Mutex which acquires the read lock, the read lock is reentrant by nature.
+func (rw *RWMutex) RLocker(action Action) *Mutex {
+	m := rw.d.NewMutex(rw.name, action)
+	m.mode = modeRead
+	return m
+}
+
+// Locker returns a Mutex which acquires the write lock.
+// The write lock is reentrant only for mutexes with the same owner set by WithReentrant.
+func (rw *RWMutex) Locker(action Action) *Mutex {
+	m := rw.d.NewMutex(rw.name, action)
+	m.mode = modeWrite
+	return m
+}
+
+// readPurge 删除已过期的读者并返回剩余的读者数。
+// 每个读者的过期时间保存在字段 ":until:{owner}" 中，整个key的过期时间不短于最晚的读者
+const readPurge = `
+	local function purge(key, now)
+		local kv = redis.call("HGETALL", key)
+		local readers = 0
+		for i = 1, #kv, 2 do
+			if string.sub(kv[i], 1, 7) == ":until:" then
+				if tonumber(kv[i + 1]) < now then
+					redis.call("HDEL", key, kv[i], string.sub(kv[i], 8))
+				else
+					readers = readers + 1
+				end
+			end
+		end
+		return readers
+	end
+`
+
+// 读锁：清理过期的读者，没有锁或已被读者持有时增加读者的持有次数并设置它的过期时间。
+// ARGV为owner、过期时长、当前时间和过期时间（毫秒）
+var readAcquireScript = redis.NewScript(1, readPurge+`
+	local mode = redis.call("HGET", KEYS[1], ":mode")
+	if mode == "read" and purge(KEYS[1], tonumber(ARGV[3])) == 0 then
+		redis.call("DEL", KEYS[1])
+		mode = false
+	end
+	if mode == false then
+		redis.call("HSET", KEYS[1], ":mode", "read")
+	elseif mode ~= "read" then
+		return 0
+	end
+	redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+	redis.call("HSET", KEYS[1], ":until:" .. ARGV[1], ARGV[4])
+	if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[2]) then
+		redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+	return 1
+`)
+
+// readTouchScript 只刷新读者自己的过期时间，ARGV同readAcquireScript
+var readTouchScript = redis.NewScript(1, readPurge+`
+	if redis.call("HGET", KEYS[1], ":mode") ~= "read" then
+		return 0
+	end
+	if purge(KEYS[1], tonumber(ARGV[3])) == 0 then
+		redis.call("DEL", KEYS[1])
+		return 0
+	end
+	if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("HSET", KEYS[1], ":until:" .. ARGV[1], ARGV[4])
+	if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[2]) then
+		redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+	return 1
+`)
+
+// readHoldScript 判断读者是否持有未过期的读锁，ARGV为owner和当前时间
+var readHoldScript = redis.NewScript(1, `
+	local deadline = redis.call("HGET", KEYS[1], ":until:" .. ARGV[1])
+	if deadline and tonumber(deadline) >= tonumber(ARGV[2]) then
+		return 1
+	end
+	return 0
+`)
+
+// 写锁：没有锁或已被同一个写者持有时增加持有次数，读者均已过期时视为没有锁
+var writeAcquireScript = redis.NewScript(1, readPurge+`
+	local mode = redis.call("HGET", KEYS[1], ":mode")
+	if mode == "read" and purge(KEYS[1], tonumber(ARGV[3])) == 0 then
+		redis.call("DEL", KEYS[1])
+		mode = false
+	end
+	if mode == false then
+		redis.call("HSET", KEYS[1], ":mode", "write")
+	elseif mode ~= "write" or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+`)
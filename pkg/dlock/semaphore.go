@@ -0,0 +1,336 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dlock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/dlock/redis"
+)
+
+var ErrNoPermit = errors.New("dlock: no permit available")
+
+// A Semaphore is a distributed counting semaphore with the given number of permits.
+// Every permit is a lease stored in a redis sorted set scored by its deadline, leases which are not extended
+// before the deadline are reclaimed, so permits held by crashed processes are not leaked.
+// With multiple pools a permit must be granted by all pools, a quorum can not bound the number of holders.
+type Semaphore struct {
+	name    string
+	permits int
+	expiry  time.Duration
+	wait    time.Duration
+	factor  float64
+	quorum  int
+	pools   []redis.Pool
+}
+
+// NewSemaphore 使用默认的Dlock创建信号量
+func NewSemaphore(name string, permits int) *Semaphore {
+	return defaultDlock.NewSemaphore(name, permits)
+}
+
+// NewSemaphore 创建信号量，租约默认8s过期，默认不等待。没有配置redis时panic
+func (d *Dlock) NewSemaphore(name string, permits int) *Semaphore {
+	d.mustHavePools()
+	return &Semaphore{
+		name:    name,
+		permits: permits,
+		expiry:  8 * time.Second,
+		factor:  0.01,
+		quorum:  len(d.pools),
+		pools:   d.pools,
+	}
+}
+
+// Name returns semaphore name (i.e. the Redis key).
+func (s *Semaphore) Name() string {
+	return s.name
+}
+
+// WithExpiry can be used to set the lease TTL of permits.
+func (s *Semaphore) WithExpiry(expiry time.Duration) *Semaphore {
+	s.expiry = expiry
+	return s
+}
+
+// WithWait can be used to set the max time to wait for a permit, it only tries once if wait <= 0.
+// Waiters are woken when a permit is released, and retry every expiry in case leases expire.
+func (s *Semaphore) WithWait(wait time.Duration) *Semaphore {
+	s.wait = wait
+	return s
+}
+
+// Acquire acquires a permit. It returns ErrNoPermit if all permits are held after waiting,
+// or the error of ctx if ctx is done while waiting.
+func (s *Semaphore) Acquire(ctx context.Context) (*Permit, error) {
+	id, err := genValue()
+	if err != nil {
+		return nil, err
+	}
+	p := &Permit{s: s, id: id}
+	if s.wait <= 0 {
+		ok, err := p.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNoPermit
+		}
+		return p, nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, s.wait)
+	defer cancel()
+	released, unsubscribe := subscribe(waitCtx, s.pools, s.releaseChannel())
+	defer unsubscribe()
+	for i := 1; ; i++ {
+		ok, err := p.acquire(waitCtx)
+		if ok {
+			return p, nil
+		}
+		interval := s.expiry
+		if released == nil || err != nil {
+			interval = defaultDelay(i)
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-waitCtx.Done():
+			timer.Stop()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, ErrNoPermit
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Do acquires a permit, runs the action and releases the permit. The lease is extended in background while
+// the action is running, and the context passed to the action is cancelled once the lease is lost.
+// It returns whether the action is executed.
+func (s *Semaphore) Do(ctx context.Context, action ContextAction) (bool, error) {
+	p, err := s.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	childCtx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		if err := p.Release(context.Background()); err != nil {
+			log.Errorf("failed to release permit. name: %s, err: %+v", s.name, err)
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case <-childCtx.Done():
+				return
+			case <-time.After(s.expiry / 3):
+				ok, err := p.Extend(childCtx)
+				if !ok && err == nil {
+					log.Errorf("permit lost. name: %s", s.name)
+					cancel()
+					return
+				}
+				if err != nil {
+					log.Errorf("failed to renew permit. name: %s, err: %+v", s.name, err)
+				}
+			}
+		}
+	}()
+	action(childCtx)
+	return true, nil
+}
+
+// Held returns the number of permits held on the first pool.
+func (s *Semaphore) Held(ctx context.Context) (int, error) {
+	conn, err := s.pools[0].Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	n, err := conn.Eval(semaphoreCountScript, s.name, nowMillis())
+	if err != nil {
+		return 0, err
+	}
+	count, _ := n.(int64)
+	return int(count), nil
+}
+
+func (s *Semaphore) releaseChannel() string {
+	return s.name + releaseSuffix
+}
+
+// A Permit is a lease of a Semaphore.
+type Permit struct {
+	s  *Semaphore
+	id string
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// ID returns the lease id of the permit.
+func (p *Permit) ID() string {
+	return p.id
+}
+
+// Until returns the time until which the permit is valid without extension.
+func (p *Permit) Until() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.until
+}
+
+// Extend resets the lease TTL and returns whether the permit is still held.
+func (p *Permit) Extend(ctx context.Context) (bool, error) {
+	start := time.Now()
+	expiry := int64(p.s.expiry / time.Millisecond)
+	n, err := p.s.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		return evalStatus(ctx, pool, semaphoreTouchScript, p.s.name, p.id, nowMillis(), expiry)
+	})
+	if n < p.s.quorum {
+		return false, err
+	}
+	p.hold(start)
+	return true, nil
+}
+
+// Release releases the permit and wakes up waiters.
+func (p *Permit) Release(ctx context.Context) error {
+	n, err := p.s.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		return p.release(ctx, pool)
+	})
+	if n < p.s.quorum {
+		if err == nil {
+			err = errors.New("dlock: permit is not held")
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *Permit) acquire(ctx context.Context) (bool, error) {
+	start := time.Now()
+	expiry := int64(p.s.expiry / time.Millisecond)
+	var mu sync.Mutex
+	acquired := make(map[redis.Pool]bool, len(p.s.pools))
+	n, err := p.s.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		ok, err := evalStatus(ctx, pool, semaphoreAcquireScript, p.s.name, p.id, nowMillis(), expiry, p.s.permits)
+		if ok {
+			mu.Lock()
+			acquired[pool] = true
+			mu.Unlock()
+		}
+		return ok, err
+	})
+	if n >= p.s.quorum && p.hold(start) {
+		return true, nil
+	}
+	_, _ = p.s.actOnPoolsAsync(func(pool redis.Pool) (bool, error) {
+		if !acquired[pool] {
+			return false, nil
+		}
+		return p.release(ctx, pool)
+	})
+	return false, err
+}
+
+// hold 记录租约的有效期，已经过期时返回false
+func (p *Permit) hold(start time.Time) bool {
+	now := time.Now()
+	until := now.Add(p.s.expiry - now.Sub(start) - time.Duration(int64(float64(p.s.expiry)*p.s.factor)))
+	p.mu.Lock()
+	p.until = until
+	p.mu.Unlock()
+	return now.Before(until)
+}
+
+func (p *Permit) release(ctx context.Context, pool redis.Pool) (bool, error) {
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	status, err := conn.Eval(semaphoreReleaseScript, p.s.name, p.id, p.s.releaseChannel())
+	if err != nil {
+		return false, err
+	}
+	return status != int64(0), nil
+}
+
+func (s *Semaphore) actOnPoolsAsync(actFn func(redis.Pool) (bool, error)) (int, error) {
+	return actOnPoolsAsync(s.pools, actFn)
+}
+
+func evalStatus(ctx context.Context, pool redis.Pool, script *redis.Script, keysAndArgs ...interface{}) (bool, error) {
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	status, err := conn.Eval(script, keysAndArgs...)
+	if err != nil {
+		return false, err
+	}
+	return status != int64(0), nil
+}
+
+// semaphoreAcquireScript 清理过期的租约，有空闲时加入租约。ARGV为租约id、当前时间、过期时长（毫秒）和许可数
+var semaphoreAcquireScript = redis.NewScript(1, `
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[2])
+	if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[4]) then
+		return 0
+	end
+	redis.call("ZADD", KEYS[1], tonumber(ARGV[2]) + tonumber(ARGV[3]), ARGV[1])
+	if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[3]) then
+		redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	end
+	return 1
+`)
+
+var semaphoreTouchScript = redis.NewScript(1, `
+	local deadline = redis.call("ZSCORE", KEYS[1], ARGV[1])
+	if not deadline or tonumber(deadline) <= tonumber(ARGV[2]) then
+		return 0
+	end
+	redis.call("ZADD", KEYS[1], tonumber(ARGV[2]) + tonumber(ARGV[3]), ARGV[1])
+	if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[3]) then
+		redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	end
+	return 1
+`)
+
+// semaphoreReleaseScript 删除租约并发布释放消息，ARGV为租约id和释放频道
+var semaphoreReleaseScript = redis.NewScript(1, `
+	if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("PUBLISH", ARGV[2], ARGV[1])
+	return 1
+`)
+
+var semaphoreCountScript = redis.NewScript(1, `
+	return redis.call("ZCOUNT", KEYS[1], "(" .. ARGV[1], "+inf")
+`)
@@ -0,0 +1,146 @@
+// Copyright Ngo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dlock
+
+import (
+	"context"
+	"time"
+
+	"github.com/NetEase-Media/ngo/pkg/adapter/log"
+	"github.com/NetEase-Media/ngo/pkg/client/zookeeper"
+)
+
+const (
+	// DefaultZkRoot 是zookeeper锁节点的默认根路径
+	DefaultZkRoot = "/ngo/dlock"
+
+	defaultZkWait = 5 * time.Second
+)
+
+// A ZkMutex is a distributed mutual exclusion lock based on zookeeper ephemeral sequential nodes.
+// It is held as long as the zookeeper session is alive, so there is no expiry and renewal.
+type ZkMutex struct {
+	name          string
+	lock          *zookeeper.Lock
+	wait          time.Duration
+	action        Action
+	contextAction ContextAction
+}
+
+func newZkMutex(client *zookeeper.ZookeeperProxy, name, p string, action Action) *ZkMutex {
+	return &ZkMutex{
+		name:   name,
+		lock:   client.NewLock(p),
+		wait:   defaultZkWait,
+		action: action,
+	}
+}
+
+// Name returns mutex name.
+func (m *ZkMutex) Name() string {
+	return m.name
+}
+
+// Lock locks m. It returns false without error if the lock is held by others after waiting.
+func (m *ZkMutex) Lock() (bool, error) {
+	return m.LockContext(context.TODO())
+}
+
+// LockContext locks m. It returns false without error if the lock is held by others after waiting.
+func (m *ZkMutex) LockContext(ctx context.Context) (bool, error) {
+	if m.wait <= 0 {
+		return m.lock.TryLock()
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, m.wait)
+	defer cancel()
+	err := m.lock.Lock(waitCtx)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Unlock unlocks m and returns the status of unlock.
+func (m *ZkMutex) Unlock() (bool, error) {
+	return m.UnlockContext(context.TODO())
+}
+
+// UnlockContext unlocks m and returns the status of unlock.
+func (m *ZkMutex) UnlockContext(ctx context.Context) (bool, error) {
+	err := m.lock.Unlock()
+	return err == nil, err
+}
+
+// LostNotify returns a channel which is closed when the held lock is lost because of session expiration.
+func (m *ZkMutex) LostNotify() <-chan struct{} {
+	return m.lock.Lost()
+}
+
+// Token returns the fencing token of the current lock, i.e. the sequence number of the lock node.
+func (m *ZkMutex) Token() int64 {
+	return m.lock.Sequence()
+}
+
+// DoContext locks m, runs the action and unlocks m.
+// The context passed to the ContextAction is cancelled once the lock is lost.
+func (m *ZkMutex) DoContext(ctx context.Context) (bool, bool, error) {
+	var executed bool
+	succ, err := m.LockContext(ctx)
+	if !succ {
+		return succ, executed, err
+	}
+
+	childCtx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		succ, err := m.UnlockContext(ctx)
+		if !succ {
+			log.Errorf("failed to unlock. name: %s, err: %+v", m.name, err)
+		}
+	}()
+	lost := m.LostNotify()
+	go func() {
+		select {
+		case <-childCtx.Done():
+		case <-lost:
+			log.Errorf("lock lost. name: %s", m.name)
+			cancel()
+		}
+	}()
+	if m.contextAction != nil {
+		m.contextAction(childCtx)
+	} else {
+		m.action()
+	}
+	executed = true
+
+	return succ, executed, err
+}
+
+func (m *ZkMutex) Do() (bool, bool, error) {
+	return m.DoContext(context.TODO())
+}
+
+// WithContextAction sets the action which receives a context cancelled when the lock is lost.
+func (m *ZkMutex) WithContextAction(action ContextAction) *ZkMutex {
+	m.contextAction = action
+	return m
+}
+
+// WithWait can be used to set the max time to wait for the lock, it only tries once if wait <= 0.
+func (m *ZkMutex) WithWait(wait time.Duration) *ZkMutex {
+	m.wait = wait
+	return m
+}